@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -10,6 +11,9 @@ import (
 // AppConfig 全局配置实例
 var AppConfig *Config
 
+// DefaultJWTSecret 默认JWT密钥，仅用于本地开发
+const DefaultJWTSecret = "gin-starter-secret-key"
+
 // Config 应用配置结构体
 type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
@@ -17,6 +21,13 @@ type Config struct {
 	Log      LogConfig      `mapstructure:"log"`
 	JWT      JWTConfig      `mapstructure:"jwt"`
 	S3       S3Config       `mapstructure:"s3"`
+	Mail     MailConfig     `mapstructure:"mail"`
+	MFA      MFAConfig      `mapstructure:"mfa"`
+	Lockout  LockoutConfig  `mapstructure:"lockout"`
+	OIDC     OIDCConfig     `mapstructure:"oidc"`
+	Auth     AuthConfig     `mapstructure:"auth"`
+	LDAP     LDAPConfig     `mapstructure:"ldap"`
+	RBAC     RBACConfig     `mapstructure:"rbac"`
 }
 
 // ServerConfig 服务器配置
@@ -59,9 +70,90 @@ type S3Config struct {
 	Endpoint        string `mapstructure:"endpoint"`
 }
 
+// MailConfig 邮件配置
+type MailConfig struct {
+	Driver      string `mapstructure:"driver"` // smtp, file, memory
+	Host        string `mapstructure:"host"`
+	Port        string `mapstructure:"port"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	From        string `mapstructure:"from"`
+	SSL         bool   `mapstructure:"ssl"`
+	Dir         string `mapstructure:"dir"`
+	LinkBaseURL string `mapstructure:"link_base_url"`
+}
+
+// MFAConfig 双因素认证配置
+type MFAConfig struct {
+	Issuer        string   `mapstructure:"issuer"`
+	RequiredRoles []string `mapstructure:"required_roles"` // 必须启用双因素认证的角色
+}
+
+// LockoutConfig 登录失败锁定配置
+type LockoutConfig struct {
+	MaxAttempts   int           `mapstructure:"max_attempts"`    // 同一用户名连续失败多少次后锁定
+	IPMaxAttempts int           `mapstructure:"ip_max_attempts"` // 同一IP连续失败多少次后锁定，0 表示不限制
+	Window        time.Duration `mapstructure:"window"`          // 失败计数的统计窗口，超过该时间未再失败则重新计数
+	BaseDuration  time.Duration `mapstructure:"base_duration"`   // 首次锁定时长，之后每次锁定翻倍
+	MaxDuration   time.Duration `mapstructure:"max_duration"`    // 最长锁定时长
+}
+
+// OIDCConfig OpenID Connect 登录配置
+type OIDCConfig struct {
+	Enabled              bool                `mapstructure:"enabled"`
+	Issuer               string              `mapstructure:"issuer"` // 身份提供方地址，通过 /.well-known/openid-configuration 自动发现
+	ClientID             string              `mapstructure:"client_id"`
+	ClientSecret         string              `mapstructure:"client_secret"`
+	RedirectURL          string              `mapstructure:"redirect_url"`
+	Scopes               []string            `mapstructure:"scopes"`
+	AutoProvision        bool                `mapstructure:"auto_provision"`         // 首次登录时自动创建本地用户
+	RequireVerifiedEmail bool                `mapstructure:"require_verified_email"` // 只有 email_verified 为 true 时才按邮箱关联已有用户
+	RoleClaim            string              `mapstructure:"role_claim"`             // 用于映射角色和部门的声明，如 groups
+	RoleMapping          map[string][]string `mapstructure:"role_mapping"`           // 声明值 -> 角色
+	DepartmentMapping    map[string][]string `mapstructure:"department_mapping"`     // 声明值 -> 部门
+}
+
+// AuthConfig 用户名密码认证配置
+type AuthConfig struct {
+	Backends []string `mapstructure:"backends"` // 认证后端，按顺序尝试: local, ldap
+}
+
+// LDAPConfig LDAP / Active Directory 认证配置
+type LDAPConfig struct {
+	URL                string              `mapstructure:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool                `mapstructure:"start_tls"`
+	InsecureSkipVerify bool                `mapstructure:"insecure_skip_verify"`
+	BindDN             string              `mapstructure:"bind_dn"` // 用于查询用户的服务账号
+	BindPassword       string              `mapstructure:"bind_password"`
+	BaseDN             string              `mapstructure:"base_dn"`
+	UserFilter         string              `mapstructure:"user_filter"` // 用户查询条件，%s 会被替换为转义后的用户名
+	UsernameAttribute  string              `mapstructure:"username_attribute"`
+	EmailAttribute     string              `mapstructure:"email_attribute"`
+	NameAttribute      string              `mapstructure:"name_attribute"`
+	GroupAttribute     string              `mapstructure:"group_attribute"`    // 用户所属组的属性，如 memberOf
+	RoleMapping        map[string][]string `mapstructure:"role_mapping"`       // 组DN -> 角色
+	DepartmentBaseDN   string              `mapstructure:"department_base_dn"` // 该DN下的OU结构同步为部门，为空时不同步
+	AutoProvision      bool                `mapstructure:"auto_provision"`
+	TrustEmail         bool                `mapstructure:"trust_email"`   // 目录中的邮箱是否视为已验证，为 true 时按邮箱关联已有本地账号
+	SyncInterval       time.Duration       `mapstructure:"sync_interval"` // 定期同步角色和部门的周期，0 表示只在登录时同步
+	Timeout            time.Duration       `mapstructure:"timeout"`
+}
+
+// RBACConfig 权限策略配置
+type RBACConfig struct {
+	Watcher            bool          `mapstructure:"watcher"`              // 是否通过 PostgreSQL LISTEN/NOTIFY 在多个实例之间同步策略变更
+	WatcherChannel     string        `mapstructure:"watcher_channel"`      // 同步使用的通知频道，共用数据库的实例必须一致
+	GrantSweepInterval time.Duration `mapstructure:"grant_sweep_interval"` // 清理过期的角色和部门分配的周期，0 表示不清理
+}
+
 // JWTConfig JWT配置
 type JWTConfig struct {
-	Secret string `mapstructure:"secret"`
+	Algorithm        string        `mapstructure:"algorithm"`
+	Secret           string        `mapstructure:"secret"`
+	KeyDir           string        `mapstructure:"key_dir"`
+	RotationInterval time.Duration `mapstructure:"rotation_interval"`
+	AccessTokenTTL   time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `mapstructure:"refresh_token_ttl"`
 }
 
 // Init 初始化配置
@@ -133,8 +225,57 @@ func setDefaults() {
 	viper.SetDefault("log.enable_colors", true)
 	viper.SetDefault("log.timestamp_format", "2006-01-02 15:04:05")
 
+	// 邮件配置默认值
+	viper.SetDefault("mail.driver", "file")
+	viper.SetDefault("mail.port", "587")
+	viper.SetDefault("mail.from", "no-reply@localhost")
+	viper.SetDefault("mail.dir", "./mails")
+	viper.SetDefault("mail.link_base_url", "http://localhost:7070")
+
+	// 双因素认证配置默认值
+	viper.SetDefault("mfa.issuer", "gin-starter")
+	viper.SetDefault("mfa.required_roles", []string{"super_admin"})
+
+	// 登录锁定配置默认值
+	viper.SetDefault("lockout.max_attempts", 5)
+	viper.SetDefault("lockout.ip_max_attempts", 50)
+	viper.SetDefault("lockout.window", "15m")
+	viper.SetDefault("lockout.base_duration", "1m")
+	viper.SetDefault("lockout.max_duration", "24h")
+
+	// OIDC配置默认值
+	viper.SetDefault("oidc.enabled", false)
+	viper.SetDefault("oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("oidc.auto_provision", true)
+	viper.SetDefault("oidc.require_verified_email", true)
+	viper.SetDefault("oidc.role_claim", "groups")
+
+	// 认证后端默认值
+	viper.SetDefault("auth.backends", []string{"local"})
+
+	// LDAP配置默认值
+	viper.SetDefault("ldap.user_filter", "(&(objectClass=person)(uid=%s))")
+	viper.SetDefault("ldap.username_attribute", "uid")
+	viper.SetDefault("ldap.email_attribute", "mail")
+	viper.SetDefault("ldap.name_attribute", "cn")
+	viper.SetDefault("ldap.group_attribute", "memberOf")
+	viper.SetDefault("ldap.auto_provision", true)
+	viper.SetDefault("ldap.trust_email", false)
+	viper.SetDefault("ldap.sync_interval", "0")
+	viper.SetDefault("ldap.timeout", "10s")
+
+	// 权限策略配置默认值
+	viper.SetDefault("rbac.watcher", true)
+	viper.SetDefault("rbac.watcher_channel", "casbin_policy")
+	viper.SetDefault("rbac.grant_sweep_interval", "1m")
+
 	// JWT配置默认值
-	viper.SetDefault("jwt.secret", "gin-starter-secret-key")
+	viper.SetDefault("jwt.algorithm", "HS256")
+	viper.SetDefault("jwt.secret", DefaultJWTSecret)
+	viper.SetDefault("jwt.key_dir", "./keys")
+	viper.SetDefault("jwt.rotation_interval", "0")
+	viper.SetDefault("jwt.access_token_ttl", "15m")
+	viper.SetDefault("jwt.refresh_token_ttl", "720h")
 }
 
 // bindEnvs 绑定环境变量
@@ -166,13 +307,53 @@ func bindEnvs() {
 	viper.BindEnv("log.timestamp_format", "STARTER_LOG_TIMESTAMP_FORMAT")
 
 	// JWT配置环境变量绑定
+	viper.BindEnv("jwt.algorithm", "STARTER_JWT_ALGORITHM")
 	viper.BindEnv("jwt.secret", "STARTER_JWT_SECRET")
+	viper.BindEnv("jwt.key_dir", "STARTER_JWT_KEY_DIR")
+	viper.BindEnv("jwt.rotation_interval", "STARTER_JWT_ROTATION_INTERVAL")
+	viper.BindEnv("jwt.access_token_ttl", "STARTER_JWT_ACCESS_TOKEN_TTL")
+	viper.BindEnv("jwt.refresh_token_ttl", "STARTER_JWT_REFRESH_TOKEN_TTL")
+
+	// 邮件配置环境变量绑定
+	viper.BindEnv("mail.driver", "STARTER_MAIL_DRIVER")
+	viper.BindEnv("mail.host", "STARTER_MAIL_HOST")
+	viper.BindEnv("mail.port", "STARTER_MAIL_PORT")
+	viper.BindEnv("mail.username", "STARTER_MAIL_USERNAME")
+	viper.BindEnv("mail.password", "STARTER_MAIL_PASSWORD")
+	viper.BindEnv("mail.from", "STARTER_MAIL_FROM")
+	viper.BindEnv("mail.ssl", "STARTER_MAIL_SSL")
+	viper.BindEnv("mail.dir", "STARTER_MAIL_DIR")
+	viper.BindEnv("mail.link_base_url", "STARTER_MAIL_LINK_BASE_URL")
+
+	// 双因素认证配置环境变量绑定
+	viper.BindEnv("mfa.issuer", "STARTER_MFA_ISSUER")
+
+	// 登录锁定配置环境变量绑定
+	viper.BindEnv("lockout.max_attempts", "STARTER_LOCKOUT_MAX_ATTEMPTS")
+	viper.BindEnv("lockout.ip_max_attempts", "STARTER_LOCKOUT_IP_MAX_ATTEMPTS")
+
+	// OIDC配置环境变量绑定
+	viper.BindEnv("oidc.enabled", "STARTER_OIDC_ENABLED")
+	viper.BindEnv("oidc.issuer", "STARTER_OIDC_ISSUER")
+	viper.BindEnv("oidc.client_id", "STARTER_OIDC_CLIENT_ID")
+	viper.BindEnv("oidc.client_secret", "STARTER_OIDC_CLIENT_SECRET")
+	viper.BindEnv("oidc.redirect_url", "STARTER_OIDC_REDIRECT_URL")
+
+	// LDAP配置环境变量绑定
+	viper.BindEnv("ldap.url", "STARTER_LDAP_URL")
+	viper.BindEnv("ldap.bind_dn", "STARTER_LDAP_BIND_DN")
+	viper.BindEnv("ldap.bind_password", "STARTER_LDAP_BIND_PASSWORD")
 
 	// S3配置环境变量绑定
 	viper.BindEnv("s3.access_key_id", "STARTER_S3_ACCESS_KEY_ID")
 	viper.BindEnv("s3.secret_access_key", "STARTER_S3_SECRET_ACCESS_KEY")
 	viper.BindEnv("s3.region", "STARTER_S3_REGION")
 	viper.BindEnv("s3.endpoint", "STARTER_S3_ENDPOINT")
+
+	// 权限策略配置环境变量绑定
+	viper.BindEnv("rbac.watcher", "STARTER_RBAC_WATCHER")
+	viper.BindEnv("rbac.watcher_channel", "STARTER_RBAC_WATCHER_CHANNEL")
+	viper.BindEnv("rbac.grant_sweep_interval", "STARTER_RBAC_GRANT_SWEEP_INTERVAL")
 }
 
 // GetJWTSecret 获取JWT密钥
@@ -180,5 +361,21 @@ func GetJWTSecret() string {
 	if AppConfig != nil {
 		return AppConfig.JWT.Secret
 	}
-	return "gin-starter-secret-key"
+	return DefaultJWTSecret
+}
+
+// GetJWTAccessTokenTTL 获取访问令牌有效期
+func GetJWTAccessTokenTTL() time.Duration {
+	if AppConfig != nil && AppConfig.JWT.AccessTokenTTL > 0 {
+		return AppConfig.JWT.AccessTokenTTL
+	}
+	return 15 * time.Minute
+}
+
+// GetJWTRefreshTokenTTL 获取刷新令牌有效期
+func GetJWTRefreshTokenTTL() time.Duration {
+	if AppConfig != nil && AppConfig.JWT.RefreshTokenTTL > 0 {
+		return AppConfig.JWT.RefreshTokenTTL
+	}
+	return 30 * 24 * time.Hour
 }
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/mail"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// passwordResetTTL 密码重置链接有效期
+	passwordResetTTL = 30 * time.Minute
+	// emailVerifyTTL 邮箱验证链接有效期
+	emailVerifyTTL = 24 * time.Hour
+)
+
+// AccountService 找回密码、邮箱验证等账号操作，在登录前或按用户ID进行，不限制租户
+type AccountService struct{}
+
+var Account = &AccountService{}
+
+// ForgotPassword 发送密码重置邮件
+// 邮箱不存在时同样返回成功，避免泄露账号是否存在
+func (s *AccountService) ForgotPassword(email string) error {
+	db := database.WithoutTenant(database.GetDB())
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+	if !user.IsActive {
+		return nil
+	}
+	token, err := s.issueActionToken(db, &user, jwt.PurposePasswordReset, user.Email, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mail.Send(&mail.Message{
+		To:      []string{user.Email},
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，您好：\n\n请在%d分钟内点击以下链接重置密码：\n%s\n\n如果这不是您本人的操作，请忽略本邮件。\n",
+			user.Username, int(passwordResetTTL.Minutes()), actionLink("/reset-password", token)),
+	})
+}
+
+// ResetPassword 使用重置令牌设置新密码，成功后吊销该用户的全部会话
+func (s *AccountService) ResetPassword(token, password string) error {
+	claims, err := jwt.ParseActionToken(token, jwt.PurposePasswordReset)
+	if err != nil {
+		return res.ErrInvalidActionToken
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	err = database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err := s.consumeActionToken(tx, claims)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		// 同一用户其他未使用的重置链接一并作废
+		return tx.Model(&models.ActionToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, jwt.PurposePasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+	return Session.RevokeAllSessions(claims.UserID)
+}
+
+// SendEmailVerification 向用户的待验证邮箱（没有时为当前邮箱）发送验证邮件
+func (s *AccountService) SendEmailVerification(userID uint) error {
+	db := database.WithoutTenant(database.GetDB())
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return res.ErrUserNotFound
+	}
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified {
+			return res.ErrInvalidParam.WithMessage("邮箱已验证")
+		}
+		email = user.Email
+	}
+	token, err := s.issueActionToken(db, &user, jwt.PurposeEmailVerify, email, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+	return mail.Send(&mail.Message{
+		To:      []string{email},
+		Subject: "验证邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n请在%d小时内点击以下链接验证邮箱 %s：\n%s\n",
+			user.Username, int(emailVerifyTTL.Hours()), email, actionLink("/verify-email", token)),
+	})
+}
+
+// VerifyEmail 使用验证令牌确认邮箱
+func (s *AccountService) VerifyEmail(token string) error {
+	claims, err := jwt.ParseActionToken(token, jwt.PurposeEmailVerify)
+	if err != nil {
+		return res.ErrInvalidActionToken
+	}
+	return database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err := s.consumeActionToken(tx, claims)
+		if err != nil {
+			return err
+		}
+		if claims.Email == user.PendingEmail {
+			var existingUser models.User
+			if err := tx.Where("email = ? AND id != ?", claims.Email, user.ID).First(&existingUser).Error; err == nil {
+				return res.ErrEmailAlreadyUsed
+			}
+		}
+		if err := user.ConfirmEmail(claims.Email); err != nil {
+			return res.ErrInvalidActionToken.WithMessage(err.Error())
+		}
+		return tx.Select("email", "pending_email", "email_verified", "email_verified_at").Save(user).Error
+	})
+}
+
+// sendEmailVerificationAsync 发送验证邮件，失败只记录日志
+func (s *AccountService) sendEmailVerificationAsync(userID uint) {
+	go func() {
+		if err := s.SendEmailVerification(userID); err != nil {
+			utils.Log.Errorf("验证邮件发送失败, user_id=%d: %v", userID, err)
+		}
+	}()
+}
+
+// issueActionToken 签发一次性操作令牌并记录 jti
+func (s *AccountService) issueActionToken(db *gorm.DB, user *models.User, purpose, email string, ttl time.Duration) (string, error) {
+	token, tokenID, expiresAt, err := jwt.GenerateActionToken(user.ID, purpose, email, ttl)
+	if err != nil {
+		return "", err
+	}
+	record := &models.ActionToken{
+		JTI:       tokenID,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeActionToken 将令牌标记为已使用，并返回令牌所属用户
+func (s *AccountService) consumeActionToken(tx *gorm.DB, claims *jwt.ActionClaims) (*models.User, error) {
+	var record models.ActionToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("jti = ? AND purpose = ?", claims.ID, claims.Purpose).
+		First(&record).Error; err != nil {
+		return nil, res.ErrInvalidActionToken
+	}
+	if record.UsedAt != nil || record.UserID != claims.UserID || time.Now().After(record.ExpiresAt) {
+		return nil, res.ErrInvalidActionToken
+	}
+	if err := tx.Model(&record).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := tx.First(&user, record.UserID).Error; err != nil {
+		return nil, res.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// actionLink 拼接邮件中的操作链接
+func actionLink(path, token string) string {
+	base := strings.TrimRight(config.AppConfig.Mail.LinkBaseURL, "/")
+	return base + path + "?token=" + url.QueryEscape(token)
+}
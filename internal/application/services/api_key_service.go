@@ -0,0 +1,207 @@
+package services
+
+import (
+	"crypto/subtle"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/util"
+	"gorm.io/gorm"
+)
+
+// apiKeyTouchInterval 最近使用时间的更新间隔，避免每个请求都写库
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyService struct{}
+
+var APIKey = &APIKeyService{}
+
+// CreateAPIKeyInput 创建API密钥参数
+type CreateAPIKeyInput struct {
+	Name           string
+	Scopes         []string
+	ExpiresAt      *time.Time
+	ServiceAccount bool
+	Roles          []string // 服务账号的角色，只能是所属用户已拥有的角色
+}
+
+// Create 创建API密钥，返回的明文密钥只在此时可见
+func (s *APIKeyService) Create(userID uint, input CreateAPIKeyInput) (*models.APIKey, string, error) {
+	scopes := input.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"*"}
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", res.ErrInvalidParam.WithMessage("无效的范围: " + scope)
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", res.ErrInvalidParam.WithMessage("过期时间必须晚于当前时间")
+	}
+	if !input.ServiceAccount && len(input.Roles) > 0 {
+		return nil, "", res.ErrInvalidParam.WithMessage("只有服务账号可以指定角色")
+	}
+	// 服务账号的角色分配在所属用户的租户域中
+	var owner models.User
+	if err := database.WithoutTenant(database.GetDB()).Select("id", "tenant_id").First(&owner, userID).Error; err != nil {
+		return nil, "", res.ErrUserNotFound
+	}
+	dom := rbac.GetTenantDomain(owner.TenantID)
+	if len(input.Roles) > 0 {
+		owned, err := rbac.GetImplicitRolesForUser(rbac.GetUserID(userID), dom)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, role := range input.Roles {
+			if !slices.Contains(owned, role) {
+				return nil, "", res.ErrForbidden.WithMessage("不能授予自己没有的角色: " + role)
+			}
+		}
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := &models.APIKey{
+		UserID:         userID,
+		Name:           input.Name,
+		Prefix:         prefix,
+		SecretHash:     hashToken(secret),
+		Scopes:         scopes,
+		ServiceAccount: input.ServiceAccount,
+		ExpiresAt:      input.ExpiresAt,
+	}
+	db := database.GetDB()
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	// Casbin 规则在密钥提交后添加，分配失败时移除已添加的角色并删除密钥，避免之后复用该ID的密钥继承这些角色
+	sub := rbac.GetAPIKeySubject(key.ID)
+	var notify rbac.NotifyErrors
+	for _, role := range input.Roles {
+		if _, err := rbac.AddRoleForUser(sub, role, dom); notify.Check(err) != nil {
+			if rollbackErr := rbac.DeleteSubject(sub); notify.Check(rollbackErr) != nil {
+				utils.Log.Errorf("服务账号角色回滚失败, %s: %v", sub, rollbackErr)
+			}
+			if rollbackErr := db.Delete(key).Error; rollbackErr != nil {
+				utils.Log.Errorf("API密钥回滚失败, id=%d: %v", key.ID, rollbackErr)
+			}
+			return nil, "", err
+		}
+	}
+	// 明文密钥只能在此时返回，角色已保存时不因通知其他实例失败而报错
+	if err := notify.Err(); err != nil {
+		utils.Log.Errorf("服务账号角色已保存，但通知其他实例失败, %s: %v", sub, err)
+	}
+	return key, models.APIKeyPrefix + "_" + prefix + "_" + secret, nil
+}
+
+// List 获取用户的API密钥
+func (s *APIKeyService) List(userID uint) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	if err := database.GetDB().Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke 吊销用户的API密钥，服务账号的角色一并移除
+func (s *APIKeyService) Revoke(userID, keyID uint) error {
+	db := database.GetDB()
+	var key models.APIKey
+	if err := db.Where("id = ? AND user_id = ?", keyID, userID).First(&key).Error; err != nil {
+		return res.ErrNotFound.WithMessage("API密钥不存在")
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	if err := db.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if key.ServiceAccount {
+		return rbac.DeleteSubject(rbac.GetAPIKeySubject(key.ID))
+	}
+	return nil
+}
+
+// Authenticate 校验明文密钥，返回对应的密钥记录
+func (s *APIKeyService) Authenticate(raw string) (*models.APIKey, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != models.APIKeyPrefix {
+		return nil, res.ErrInvalidAPIKey
+	}
+	// 密钥在登录前校验，此时还不知道所属租户
+	db := database.WithoutTenant(database.GetDB())
+	var key models.APIKey
+	if err := db.Preload("User", func(tx *gorm.DB) *gorm.DB {
+		return tx.Select("id", "username", "tenant_id")
+	}).Where("prefix = ?", parts[1]).First(&key).Error; err != nil {
+		return nil, res.ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashToken(parts[2]))) != 1 || !key.IsActive() {
+		return nil, res.ErrInvalidAPIKey
+	}
+	if key.User == nil {
+		return nil, res.ErrUserInactive
+	}
+	if err := Session.ValidateUser(key.UserID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := db.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			utils.Log.Warnf("API密钥使用时间更新失败, id=%d: %v", key.ID, err)
+		}
+	}
+	return &key, nil
+}
+
+// Subject 密钥在Casbin中的主体：服务账号使用独立主体，否则与所属用户一致
+func (s *APIKeyService) Subject(key *models.APIKey) string {
+	if key.ServiceAccount {
+		return rbac.GetAPIKeySubject(key.ID)
+	}
+	return rbac.GetUserID(key.UserID)
+}
+
+// Allows 请求是否在密钥的范围内
+// 范围格式为 "<方法正则> <路径>"，路径支持 keyMatch2 模式；单独的 "*" 表示不限制
+func (s *APIKeyService) Allows(key *models.APIKey, method, path string) bool {
+	for _, scope := range key.Scopes {
+		if scope == "*" {
+			return true
+		}
+		act, obj, _ := strings.Cut(scope, " ")
+		if (act == "*" || util.RegexMatch(method, "^("+act+")$")) && (obj == "*" || util.KeyMatch2(path, obj)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validScope 校验范围格式
+func validScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	act, obj, ok := strings.Cut(scope, " ")
+	if !ok || act == "" || (obj != "*" && !strings.HasPrefix(obj, "/")) {
+		return false
+	}
+	_, err := regexp.Compile(act)
+	return act == "*" || err == nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	setupRBAC(t)
+	user := createUser(t, "alice")
+	key, raw, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !slices.Equal(key.Scopes, []string{"*"}) {
+		t.Fatalf("default scopes = %v, want *", key.Scopes)
+	}
+	got, err := APIKey.Authenticate(raw)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.ID != key.ID || got.User == nil || got.User.Username != "alice" {
+		t.Fatalf("Authenticate returned key %d for %v, want key %d for alice", got.ID, got.User, key.ID)
+	}
+	if APIKey.Subject(got) != rbac.GetUserID(user.ID) {
+		t.Fatalf("Subject = %s, want the owner", APIKey.Subject(got))
+	}
+
+	prefix := raw[:strings.LastIndex(raw, "_")]
+	for _, invalid := range []string{"", "gsk_only", "xyz" + raw[3:], prefix + "_wrong-secret"} {
+		_, err := APIKey.Authenticate(invalid)
+		assertCode(t, err, res.ErrInvalidAPIKey)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	_, expiring, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "temp", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	database.GetDB().Model(&models.APIKey{}).Where("name = ?", "temp").Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = APIKey.Authenticate(expiring)
+	assertCode(t, err, res.ErrInvalidAPIKey)
+
+	// 所属用户停用后密钥不能使用
+	database.WithoutTenant(database.GetDB()).Model(&models.User{}).Where("id = ?", user.ID).Update("is_active", false)
+	Session.InvalidateUser(user.ID)
+	_, err = APIKey.Authenticate(raw)
+	assertCode(t, err, res.ErrUserInactive)
+}
+
+func TestAPIKeyAllows(t *testing.T) {
+	key := &models.APIKey{Scopes: []string{"GET /users/*", "POST|PUT /rbac/policy"}}
+	cases := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/users/1", true},
+		{"DELETE", "/users/1", false},
+		{"GET", "/users", false},
+		{"POST", "/rbac/policy", true},
+		{"PUT", "/rbac/policy", true},
+		{"XPOSTX", "/rbac/policy", false},
+		{"GET", "/rbac/policy", false},
+	}
+	for _, tc := range cases {
+		if got := APIKey.Allows(key, tc.method, tc.path); got != tc.want {
+			t.Errorf("Allows(%s %s) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+	if !APIKey.Allows(&models.APIKey{Scopes: []string{"*"}}, "DELETE", "/anything") {
+		t.Fatal("* scope does not allow everything")
+	}
+	for _, scope := range []string{"GET", "GET users", "( /users"} {
+		_, _, err := APIKey.Create(1, CreateAPIKeyInput{Name: "bad", Scopes: []string{scope}})
+		assertCode(t, err, res.ErrInvalidParam)
+	}
+}
+
+func TestAPIKeyServiceAccountRoles(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, "viewer", "editor")
+	user := createUser(t, "alice")
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddRoleForUser(rbac.GetUserID(user.ID), "viewer", dom); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci", Roles: []string{"viewer"}})
+	assertCode(t, err, res.ErrInvalidParam)
+	_, _, err = APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci", ServiceAccount: true, Roles: []string{"editor"}})
+	assertCode(t, err, res.ErrForbidden)
+
+	key, raw, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci", ServiceAccount: true, Roles: []string{"viewer"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	sub := rbac.GetAPIKeySubject(key.ID)
+	authenticated, err := APIKey.Authenticate(raw)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if APIKey.Subject(authenticated) != sub {
+		t.Fatalf("Subject = %s, want %s", APIKey.Subject(authenticated), sub)
+	}
+	if roles, _ := rbac.GetRolesForUser(sub, dom); !slices.Equal(roles, []string{"viewer"}) {
+		t.Fatalf("service account roles = %v, want viewer", roles)
+	}
+
+	// 只能吊销自己的密钥，吊销后服务账号的角色一并移除
+	assertCode(t, APIKey.Revoke(user.ID+1, key.ID), res.ErrNotFound)
+	if err := APIKey.Revoke(user.ID, key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	_, err = APIKey.Authenticate(raw)
+	assertCode(t, err, res.ErrInvalidAPIKey)
+	if roles, _ := rbac.GetRolesForUser(sub, dom); len(roles) != 0 {
+		t.Fatalf("revoked service account still has roles %v", roles)
+	}
+}
+
+func TestAPIKeyCreateRollsBackRoles(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, "viewer", "ghost")
+	user := createUser(t, "alice")
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	for _, role := range []string{"viewer", "ghost"} {
+		if _, err := rbac.AddRoleForUser(rbac.GetUserID(user.ID), role, dom); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 用户仍拥有已从角色表删除的角色，分配给服务账号时失败
+	if err := database.GetDB().Unscoped().Where("name = ?", "ghost").Delete(&rbacModels.Role{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci", ServiceAccount: true, Roles: []string{"viewer", "ghost"}})
+	assertCode(t, err, res.ErrRoleNotFound)
+	var count int64
+	database.GetDB().Model(&models.APIKey{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d API keys left after a failed create", count)
+	}
+
+	// 复用同一ID的新密钥不能继承失败时添加的角色
+	key, _, err := APIKey.Create(user.ID, CreateAPIKeyInput{Name: "ci", ServiceAccount: true})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if roles, _ := rbac.GetRolesForUser(rbac.GetAPIKeySubject(key.ID), dom); len(roles) != 0 {
+		t.Fatalf("new key %d inherited roles %v", key.ID, roles)
+	}
+	rules, _ := rbac.ListRules(rbac.RoleRule)
+	for _, rule := range rules {
+		if strings.HasPrefix(rule[0], "apikey:") {
+			t.Fatalf("stale service account rule %v", rule)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator 用户名密码认证后端
+// 凭据不匹配或用户不存在时返回 res.ErrInvalidCredentials，此时会继续尝试下一个后端
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// authenticators 按顺序尝试的认证后端
+var authenticators = []Authenticator{&LocalAuthenticator{}}
+
+// InitAuthenticators 根据 auth.backends 配置初始化认证后端
+func InitAuthenticators() error {
+	list := make([]Authenticator, 0, len(config.AppConfig.Auth.Backends))
+	for _, name := range config.AppConfig.Auth.Backends {
+		switch name {
+		case "local":
+			list = append(list, &LocalAuthenticator{})
+		case "ldap":
+			list = append(list, LDAP)
+		default:
+			return fmt.Errorf("未知的认证后端: %s", name)
+		}
+	}
+	if len(list) == 0 {
+		return errors.New("未配置认证后端")
+	}
+	SetAuthenticators(list...)
+	return nil
+}
+
+// SetAuthenticators 替换认证后端
+func SetAuthenticators(list ...Authenticator) {
+	authenticators = list
+}
+
+// authenticate 依次尝试各认证后端
+// 所有后端都因凭据错误失败时返回 ErrInvalidCredentials；只有后端自身故障时返回故障原因，不计入登录失败次数
+func authenticate(username, password string) (*models.User, error) {
+	var lastErr error
+	credentialsRejected := false
+	for _, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, res.ErrInvalidCredentials) {
+			credentialsRejected = true
+			continue
+		}
+		utils.Log.Warnf("认证后端 %s 失败: %v", authenticator.Name(), err)
+		lastErr = err
+	}
+	if credentialsRejected || lastErr == nil {
+		return nil, res.ErrInvalidCredentials
+	}
+	return nil, lastErr
+}
+
+// LocalAuthenticator 使用本地数据库中的 bcrypt 密码认证
+type LocalAuthenticator struct{}
+
+// Name 后端名称
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+// Authenticate 校验本地密码
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	// 用户名全局唯一，登录时还不知道用户所属的租户
+	if err := database.WithoutTenant(database.GetDB()).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, res.ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, res.ErrInvalidCredentials
+	}
+	return &user, nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"gin-starter/internal/application/services/rbac"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// DataScopeService 按角色的数据范围限制列表查询能看到的用户
+type DataScopeService struct{}
+
+var DataScope = &DataScopeService{}
+
+// actorContextKey 上下文中当前操作者的键
+type actorContextKey struct{}
+
+// Actor 发起请求的操作者，由认证中间件写入请求上下文
+type Actor struct {
+	UserID  uint   // 用户ID，服务账号为其所属用户
+	Subject string // Casbin主体
+	Domain  string // 租户域
+}
+
+// WithActor 返回携带操作者的上下文
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext 获取上下文中的操作者
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	if ctx == nil {
+		return Actor{}, false
+	}
+	actor, ok := ctx.Value(actorContextKey{}).(Actor)
+	return actor, ok
+}
+
+// VisibleUsers 操作者可见的用户，All 为 true 时不做限制
+type VisibleUsers struct {
+	All     bool
+	UserIDs []uint
+}
+
+// Resolve 计算上下文中的操作者可见的用户
+// 操作者在租户域中的各个角色的数据范围取并集，本人总是可见
+// 没有操作者（如后台任务）、超级管理员或任一角色的数据范围为全部时不做限制
+// 没有任何角色时只能看到本人，角色表中不存在的角色和无法识别的数据范围不扩大可见范围
+func (s *DataScopeService) Resolve(ctx context.Context) (*VisibleUsers, error) {
+	actor, ok := ActorFromContext(ctx)
+	if !ok {
+		return &VisibleUsers{All: true}, nil
+	}
+	super, err := rbac.IsSuperAdmin(actor.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if super {
+		return &VisibleUsers{All: true}, nil
+	}
+	names, err := rbac.GetImplicitRolesForUser(actor.Subject, actor.Domain)
+	if err != nil {
+		return nil, err
+	}
+	var roles []*rbacModels.Role
+	if len(names) > 0 {
+		if err := database.GetDB().Where("name IN ?", names).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var departmentIDs, subtreeIDs []uint
+	for _, role := range roles {
+		switch role.DataScope {
+		case rbacModels.DataScopeAll:
+			return &VisibleUsers{All: true}, nil
+		case rbacModels.DataScopeCustom:
+			departmentIDs = append(departmentIDs, role.DataScopeDepartmentIDs...)
+		case rbacModels.DataScopeDept, rbacModels.DataScopeDeptAndChildren:
+			own, err := s.ownDepartments(actor.Subject)
+			if err != nil {
+				return nil, err
+			}
+			if role.DataScope == rbacModels.DataScopeDept {
+				departmentIDs = append(departmentIDs, own...)
+			} else {
+				subtreeIDs = append(subtreeIDs, own...)
+			}
+		}
+	}
+	if len(subtreeIDs) > 0 {
+		descendants, err := s.descendants(ctx, subtreeIDs)
+		if err != nil {
+			return nil, err
+		}
+		departmentIDs = append(departmentIDs, descendants...)
+	}
+	userIDs, err := s.members(departmentIDs)
+	if err != nil {
+		return nil, err
+	}
+	if actor.UserID != 0 && !slices.Contains(userIDs, actor.UserID) {
+		userIDs = append(userIDs, actor.UserID)
+	}
+	return &VisibleUsers{UserIDs: userIDs}, nil
+}
+
+// Users 返回按数据范围过滤用户的GORM作用域，用于 Scopes
+func (s *DataScopeService) Users(ctx context.Context) (func(*gorm.DB) *gorm.DB, error) {
+	visible, err := s.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		if visible.All {
+			return db
+		}
+		return db.Where("users.id IN ?", visible.UserIDs)
+	}, nil
+}
+
+// FilterSubjects 过滤Casbin主体列表中不可见的用户，部门、API密钥等非用户主体保留
+func (s *DataScopeService) FilterSubjects(ctx context.Context, subjects []string) ([]string, error) {
+	visible, err := s.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if visible.All {
+		return subjects, nil
+	}
+	filtered := make([]string, 0, len(subjects))
+	for _, sub := range subjects {
+		id, err := strconv.ParseUint(sub, 10, 64)
+		if err != nil || slices.Contains(visible.UserIDs, uint(id)) {
+			filtered = append(filtered, sub)
+		}
+	}
+	return filtered, nil
+}
+
+// SetRoleDataScope 设置角色的数据范围，custom 时 departmentIDs 为可见的部门
+// 角色在各租户间共享，只有超级管理员可以设置；自定义部门可以来自多个租户，每个租户中只会看到本租户部门的成员
+func (s *DataScopeService) SetRoleDataScope(ctx context.Context, roleID uint, scope string, departmentIDs []uint) (*rbacModels.Role, error) {
+	role, err := Role.GetRoleByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == rbac.SuperAdminRole && scope != rbacModels.DataScopeAll {
+		return nil, res.ErrInvalidParam.WithMessage("超级管理员角色的数据范围只能是全部数据")
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		super, err := rbac.IsSuperAdmin(actor.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !super {
+			return nil, res.ErrInsufficientPermissions.WithMessage("角色的数据范围作用于所有租户，只有超级管理员可以设置")
+		}
+	}
+	if scope != rbacModels.DataScopeCustom {
+		departmentIDs = nil
+	}
+	if len(departmentIDs) > 0 {
+		slices.Sort(departmentIDs)
+		departmentIDs = slices.Compact(departmentIDs)
+		var count int64
+		if err := database.WithoutTenant(database.GetDB().WithContext(ctx)).Model(&rbacModels.Department{}).Where("id IN ?", departmentIDs).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int(count) != len(departmentIDs) {
+			return nil, res.ErrNotFound.WithMessage("部门不存在")
+		}
+	}
+	role.DataScope = scope
+	role.DataScopeDepartmentIDs = departmentIDs
+	if err := database.GetDB().Model(role).Select("data_scope", "data_scope_department_ids").Updates(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// ownDepartments 主体直接所属的部门ID
+func (s *DataScopeService) ownDepartments(sub string) ([]uint, error) {
+	subjects, err := rbac.GetDepartmentsForUser(sub)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(subjects))
+	for _, subject := range subjects {
+		if id, ok := rbac.ParseDepartmentSubject(subject); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// descendants 按部门树展开为部门自身及其全部下级部门
+func (s *DataScopeService) descendants(ctx context.Context, ids []uint) ([]uint, error) {
+	departments, err := Department.GetAllDepartments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[uint][]uint, len(departments))
+	for _, department := range departments {
+		if department.ParentID != nil {
+			children[*department.ParentID] = append(children[*department.ParentID], department.ID)
+		}
+	}
+	visited := make(map[uint]bool, len(ids))
+	queue := slices.Clone(ids)
+	result := make([]uint, 0, len(ids))
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		result = append(result, id)
+		queue = append(queue, children[id]...)
+	}
+	return result, nil
+}
+
+// members 部门中直接分配的用户ID，API密钥等其他主体不计入
+func (s *DataScopeService) members(departmentIDs []uint) ([]uint, error) {
+	seen := make(map[uint]bool)
+	userIDs := []uint{}
+	for _, departmentID := range departmentIDs {
+		subjects, err := rbac.GetUsersForDepartment(rbac.GetDepartmentSubject(departmentID))
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subjects {
+			id, err := strconv.ParseUint(sub, 10, 64)
+			if err != nil || seen[uint(id)] {
+				continue
+			}
+			seen[uint(id)] = true
+			userIDs = append(userIDs, uint(id))
+		}
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"testing"
+)
+
+// actorContext 默认租户中以指定用户为操作者的请求上下文
+func actorContext(userID uint) context.Context {
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	return WithActor(ctx, Actor{
+		UserID:  userID,
+		Subject: rbac.GetUserID(userID),
+		Domain:  rbac.GetTenantDomain(models.DefaultTenantID),
+	})
+}
+
+func TestResolveDefaultsToSelf(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, "viewer", "ghost")
+	if err := database.GetDB().Create(&rbacModels.Role{Name: "auditor", DataScope: rbacModels.DataScopeAll}).Error; err != nil {
+		t.Fatal(err)
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	must := func(_ bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 3 只拥有角色表中不存在的角色，4 拥有默认数据范围的角色，5 拥有数据范围为全部的角色
+	must(rbac.AddRoleForUser("3", "ghost", dom))
+	must(rbac.AddRoleForUser("4", "viewer", dom))
+	must(rbac.AddRoleForUser("5", "auditor", dom))
+	// 角色被直接从角色表中删除后，规则仍留在Casbin中
+	if err := database.GetDB().Unscoped().Where("name = ?", "ghost").Delete(&rbacModels.Role{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		all    bool
+		userID uint
+	}{
+		{"background task", context.Background(), true, 0},
+		{"no roles", actorContext(2), false, 2},
+		{"role missing from catalog", actorContext(3), false, 3},
+		{"role with default scope", actorContext(4), false, 4},
+		{"role with all scope", actorContext(5), true, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			visible, err := DataScope.Resolve(tc.ctx)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if visible.All != tc.all {
+				t.Fatalf("All = %v, want %v", visible.All, tc.all)
+			}
+			if !tc.all && !slices.Equal(visible.UserIDs, []uint{tc.userID}) {
+				t.Fatalf("UserIDs = %v, want only %d", visible.UserIDs, tc.userID)
+			}
+		})
+	}
+}
+
+func TestSetRoleDataScopeRequiresSuperAdmin(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, rbac.SuperAdminRole, "viewer", "rbac_admin")
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddRoleForUser("1", rbac.SuperAdminRole, rbac.AllDomains); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rbac.AddRoleForUser("2", "rbac_admin", dom); err != nil {
+		t.Fatal(err)
+	}
+	var viewer rbacModels.Role
+	if err := database.GetDB().Where("name = ?", "viewer").First(&viewer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 自身数据范围为全部但不是超级管理员的用户不能修改各租户共用的角色
+	_, err := DataScope.SetRoleDataScope(actorContext(2), viewer.ID, rbacModels.DataScopeSelf, nil)
+	assertCode(t, err, res.ErrInsufficientPermissions)
+
+	tenant, err := Tenant.CreateTenant("acme", "")
+	if err != nil {
+		t.Fatalf("CreateTenant: %v", err)
+	}
+	own, err := Department.CreateDepartment(database.WithTenant(context.Background(), models.DefaultTenantID), "IT", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Department.CreateDepartment(database.WithTenant(context.Background(), tenant.ID), "IT", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, err := DataScope.SetRoleDataScope(actorContext(1), viewer.ID, rbacModels.DataScopeCustom, []uint{other.ID, own.ID})
+	if err != nil {
+		t.Fatalf("SetRoleDataScope: %v", err)
+	}
+	if role.DataScope != rbacModels.DataScopeCustom || !slices.Equal(role.DataScopeDepartmentIDs, []uint{own.ID, other.ID}) {
+		t.Fatalf("role = %s %v, want custom with departments from both tenants", role.DataScope, role.DataScopeDepartmentIDs)
+	}
+	_, err = DataScope.SetRoleDataScope(actorContext(1), viewer.ID, rbacModels.DataScopeCustom, []uint{other.ID + 100})
+	assertCode(t, err, res.ErrNotFound)
+}
+
+// legacyRole 旧版本的角色表，数据范围默认为 all
+type legacyRole struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"uniqueIndex;size:50;not null"`
+	DataScope string `gorm:"size:20;not null;default:all"`
+}
+
+func (legacyRole) TableName() string {
+	return "roles"
+}
+
+func TestMigrateRoleDataScopeDefault(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := db.Migrator().DropTable(&rbacModels.Role{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&legacyRole{}); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []legacyRole{{Name: "viewer"}, {Name: "manager", DataScope: rbacModels.DataScopeDept}}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	scopes := func() map[string]string {
+		t.Helper()
+		var roles []rbacModels.Role
+		if err := db.Find(&roles).Error; err != nil {
+			t.Fatal(err)
+		}
+		scopes := make(map[string]string, len(roles))
+		for _, role := range roles {
+			scopes[role.Name] = role.DataScope
+		}
+		return scopes
+	}
+
+	database.AutoMigrate()
+	if got := scopes(); got["viewer"] != rbacModels.DataScopeSelf || got["manager"] != rbacModels.DataScopeDept {
+		t.Fatalf("migrated scopes = %v, want viewer self and manager unchanged", got)
+	}
+	if err := db.Create(&rbacModels.Role{Name: "editor"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := scopes()["editor"]; got != rbacModels.DataScopeSelf {
+		t.Fatalf("new role scope = %s, want self", got)
+	}
+
+	// 迁移后重新设置为 all 的角色不会被再次迁移覆盖
+	if err := db.Model(&rbacModels.Role{}).Where("name = ?", "viewer").Update("data_scope", rbacModels.DataScopeAll).Error; err != nil {
+		t.Fatal(err)
+	}
+	database.AutoMigrate()
+	if got := scopes()["viewer"]; got != rbacModels.DataScopeAll {
+		t.Fatalf("scope after a second migration = %s, want all kept", got)
+	}
+}
@@ -1,7 +1,10 @@
 package services
 
 import (
-	"gin-starter/internal/domain/models/rbac"
+	"context"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
 	"gin-starter/internal/infra/database"
 	"gin-starter/pkg/utils/res"
 )
@@ -10,19 +13,19 @@ type DepartmentService struct{}
 
 var Department = &DepartmentService{}
 
-func (s *DepartmentService) CreateDepartment(name, description string, parentID *uint) (*rbac.Department, error) {
-	db := database.GetDB()
-	var existingDepartment rbac.Department
+func (s *DepartmentService) CreateDepartment(ctx context.Context, name, description string, parentID *uint) (*rbacModels.Department, error) {
+	db := database.GetDB().WithContext(ctx)
+	var existingDepartment rbacModels.Department
 	if err := db.Where("name = ?", name).First(&existingDepartment).Error; err == nil {
 		return nil, res.ErrInvalidParam.WithMessage("部门名称已存在")
 	}
 	if parentID != nil {
-		var parentDepartment rbac.Department
+		var parentDepartment rbacModels.Department
 		if err := db.First(&parentDepartment, *parentID).Error; err != nil {
 			return nil, res.ErrInvalidParam.WithMessage("父部门不存在")
 		}
 	}
-	department := &rbac.Department{
+	department := &rbacModels.Department{
 		Name:        name,
 		Description: description,
 		ParentID:    parentID,
@@ -30,45 +33,55 @@ func (s *DepartmentService) CreateDepartment(name, description string, parentID
 	if err := db.Create(department).Error; err != nil {
 		return nil, err
 	}
+	if err := s.syncParent(department); err != nil {
+		return nil, err
+	}
 	return department, nil
 }
 
-func (s *DepartmentService) GetAllDepartments() ([]*rbac.Department, error) {
-	db := database.GetDB()
-	var departments []*rbac.Department
+func (s *DepartmentService) GetAllDepartments(ctx context.Context) ([]*rbacModels.Department, error) {
+	db := database.GetDB().WithContext(ctx)
+	var departments []*rbacModels.Department
 	if err := db.Find(&departments).Error; err != nil {
 		return nil, err
 	}
 	return departments, nil
 }
 
-func (s *DepartmentService) GetDepartmentByID(id uint) (*rbac.Department, error) {
-	db := database.GetDB()
-	var department rbac.Department
+func (s *DepartmentService) GetDepartmentByID(ctx context.Context, id uint) (*rbacModels.Department, error) {
+	db := database.GetDB().WithContext(ctx)
+	var department rbacModels.Department
 	if err := db.First(&department, id).Error; err != nil {
 		return nil, res.ErrNotFound.WithMessage("部门不存在")
 	}
 	return &department, nil
 }
 
-func (s *DepartmentService) UpdateDepartment(id uint, name, description string, parentID *uint) (*rbac.Department, error) {
-	db := database.GetDB()
-	var department rbac.Department
+func (s *DepartmentService) UpdateDepartment(ctx context.Context, id uint, name, description string, parentID *uint) (*rbacModels.Department, error) {
+	db := database.GetDB().WithContext(ctx)
+	var department rbacModels.Department
 	if err := db.First(&department, id).Error; err != nil {
 		return nil, res.ErrNotFound.WithMessage("部门不存在")
 	}
-	var existingDepartment rbac.Department
+	var existingDepartment rbacModels.Department
 	if err := db.Where("name = ? AND id != ?", name, id).First(&existingDepartment).Error; err == nil {
 		return nil, res.ErrInvalidParam.WithMessage("部门名称已存在")
 	}
 	if parentID != nil {
-		var parentDepartment rbac.Department
+		var parentDepartment rbacModels.Department
 		if err := db.First(&parentDepartment, *parentID).Error; err != nil {
 			return nil, res.ErrInvalidParam.WithMessage("父部门不存在")
 		}
 		if *parentID == id {
 			return nil, res.ErrInvalidParam.WithMessage("不能将部门设置为自己的子部门")
 		}
+		descendant, err := s.isDescendant(ctx, *parentID, id)
+		if err != nil {
+			return nil, err
+		}
+		if descendant {
+			return nil, res.ErrInvalidParam.WithMessage("不能将部门移动到自己的下级部门下")
+		}
 	}
 	department.Name = name
 	department.Description = description
@@ -76,36 +89,195 @@ func (s *DepartmentService) UpdateDepartment(id uint, name, description string,
 	if err := db.Save(&department).Error; err != nil {
 		return nil, err
 	}
+	if err := s.syncParent(&department); err != nil {
+		return nil, err
+	}
 	return &department, nil
 }
 
-func (s *DepartmentService) DeleteDepartment(id uint) error {
-	db := database.GetDB()
-	var department rbac.Department
+func (s *DepartmentService) DeleteDepartment(ctx context.Context, id uint) error {
+	db := database.GetDB().WithContext(ctx)
+	var department rbacModels.Department
 	if err := db.First(&department, id).Error; err != nil {
 		return res.ErrNotFound.WithMessage("部门不存在")
 	}
-	var childDepartments []rbac.Department
+	var childDepartments []rbacModels.Department
 	if err := db.Where("parent_id = ?", id).Find(&childDepartments).Error; err != nil {
 		return err
 	}
 	if len(childDepartments) > 0 {
 		return res.ErrInvalidParam.WithMessage("该部门有子部门，不能删除")
 	}
-	return db.Delete(&department).Error
+	if err := db.Delete(&department).Error; err != nil {
+		return err
+	}
+	return rbac.DeleteDepartment(rbac.GetDepartmentSubject(department.ID))
+}
+
+// GetDepartmentsForSubject 获取主体直接所属的部门
+func (s *DepartmentService) GetDepartmentsForSubject(ctx context.Context, sub string) ([]*rbacModels.Department, error) {
+	subjects, err := rbac.GetDepartmentsForUser(sub)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(subjects))
+	for _, subject := range subjects {
+		if id, ok := rbac.ParseDepartmentSubject(subject); ok {
+			ids = append(ids, id)
+		}
+	}
+	departments := []*rbacModels.Department{}
+	if len(ids) == 0 {
+		return departments, nil
+	}
+	if err := database.GetDB().WithContext(ctx).Find(&departments, ids).Error; err != nil {
+		return nil, err
+	}
+	return departments, nil
+}
+
+// MigrateSubjects 将旧版本以部门名称作为主体的 g2 规则和策略迁移为 dept:<id> 主体
+// 只迁移仍以名称出现在 g2 规则中、或作为策略主体且不是角色的部门名称；迁移后这些名称不再出现，再次执行不会重复处理
+// 规则中引用但部门表中不存在的名称会在默认租户中自动创建为部门
+func (s *DepartmentService) MigrateSubjects() error {
+	rules, err := rbac.ListRules(rbac.DepartmentRule)
+	if err != nil {
+		return err
+	}
+	var departments []rbacModels.Department
+	if err := database.WithoutTenant(database.GetDB()).Where("tenant_id = ?", models.DefaultTenantID).Find(&departments).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(departments))
+	for _, department := range departments {
+		existing[department.Name] = true
+	}
+	legacy := map[string]bool{}
+	for _, rule := range rules {
+		// 第二个字段总是部门；第一个字段是用户或下级部门，只有部门表中的名称才是下级部门
+		if _, ok := rbac.ParseDepartmentSubject(rule[1]); !ok {
+			legacy[rule[1]] = true
+		}
+		if _, ok := rbac.ParseDepartmentSubject(rule[0]); !ok && existing[rule[0]] {
+			legacy[rule[0]] = true
+		}
+	}
+	// 与角色同名的名称无法从策略判断属于哪一方，只在出现于 g2 规则中时迁移
+	policies, err := rbac.ListRules(rbac.PolicyRule)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if !existing[policy[0]] || legacy[policy[0]] {
+			continue
+		}
+		isRole, err := rbac.RoleExists(policy[0])
+		if err != nil {
+			return err
+		}
+		if !isRole {
+			legacy[policy[0]] = true
+		}
+	}
+
+	db := database.WithoutTenant(database.GetDB())
+	for name := range legacy {
+		department := rbacModels.Department{Name: name, TenantID: models.DefaultTenantID}
+		if err := db.Where(rbacModels.Department{Name: name, TenantID: models.DefaultTenantID}).FirstOrCreate(&department).Error; err != nil {
+			return err
+		}
+		subject := rbac.GetDepartmentSubject(department.ID)
+		if err := rbac.ReplaceDepartmentSubject(name, subject); err != nil {
+			return err
+		}
+		if err := s.migratePolicies(name, subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePolicies 将授予部门名称的策略转移到部门主体
+// 与角色同名时无法区分策略属于哪一方，此时复制而不移除，保证迁移前后的授权结果一致
+func (s *DepartmentService) migratePolicies(name, subject string) error {
+	policies, err := rbac.GetAllPermissionsForSubject(name)
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+	isRole, err := rbac.RoleExists(name)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if _, err := rbac.AddPolicyRule(subject, policy[1], policy[2], policy[3], policy[4], policy[5]); err != nil {
+			return err
+		}
+		if isRole {
+			continue
+		}
+		if _, err := rbac.RemovePolicyRule(name, policy[1], policy[2], policy[3], policy[4], policy[5]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncHierarchy 将全部部门的上下级关系同步到Casbin，用于迁移已有数据
+func (s *DepartmentService) SyncHierarchy() error {
+	var departments []rbacModels.Department
+	if err := database.WithoutTenant(database.GetDB()).Find(&departments).Error; err != nil {
+		return err
+	}
+	for i := range departments {
+		if err := s.syncParent(&departments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncParent 按 ParentID 设置部门在Casbin中的上级部门，使下级部门的成员继承上级部门的权限
+func (s *DepartmentService) syncParent(department *rbacModels.Department) error {
+	parent := ""
+	if department.ParentID != nil {
+		parent = rbac.GetDepartmentSubject(*department.ParentID)
+	}
+	return rbac.SetDepartmentParent(rbac.GetDepartmentSubject(department.ID), parent)
+}
+
+// isDescendant 判断 id 对应的部门是否是 ancestorID 的下级部门
+func (s *DepartmentService) isDescendant(ctx context.Context, id, ancestorID uint) (bool, error) {
+	db := database.GetDB().WithContext(ctx)
+	// 记录已访问的部门，避免历史数据中已存在的环导致死循环
+	visited := map[uint]bool{}
+	for !visited[id] {
+		visited[id] = true
+		var department rbacModels.Department
+		if err := db.First(&department, id).Error; err != nil {
+			return false, err
+		}
+		if department.ParentID == nil {
+			return false, nil
+		}
+		if *department.ParentID == ancestorID {
+			return true, nil
+		}
+		id = *department.ParentID
+	}
+	return true, nil
 }
 
-func (s *DepartmentService) GetDepartmentTree() ([]*rbac.Department, error) {
-	db := database.GetDB()
-	var departments []rbac.Department
+func (s *DepartmentService) GetDepartmentTree(ctx context.Context) ([]*rbacModels.Department, error) {
+	db := database.GetDB().WithContext(ctx)
+	var departments []rbacModels.Department
 	if err := db.Find(&departments).Error; err != nil {
 		return nil, err
 	}
-	departmentMap := make(map[uint]*rbac.Department)
+	departmentMap := make(map[uint]*rbacModels.Department)
 	for i := range departments {
 		departmentMap[departments[i].ID] = &departments[i]
 	}
-	var rootDepartments []*rbac.Department
+	var rootDepartments []*rbacModels.Department
 	for i := range departments {
 		department := &departments[i]
 		if department.ParentID == nil {
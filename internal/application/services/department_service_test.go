@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"slices"
+	"testing"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+)
+
+func TestMigrateSubjectsOnlyMigratesLegacyNames(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, "support")
+	db := database.WithoutTenant(database.GetDB())
+	for _, name := range []string{"sales", "support"} {
+		if err := db.Create(&rbacModels.Department{Name: name, TenantID: models.DefaultTenantID}).Error; err != nil {
+			t.Fatalf("create department: %v", err)
+		}
+	}
+	// 旧版本的数据：用户 5 按名称属于 sales，sales 部门持有一条策略；support 只是与部门同名的角色
+	legacy := []gormadapter.CasbinRule{
+		{Ptype: "g2", V0: "5", V1: "sales"},
+		{Ptype: "p", V0: "sales", V1: "*", V2: "/crm/*", V3: "GET", V4: "*", V5: "allow"},
+		{Ptype: "p", V0: "support", V1: "*", V2: "/tickets/*", V3: "GET", V4: "*", V5: "allow"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("create rules: %v", err)
+	}
+	if err := rbac.LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	for range 2 {
+		if err := Department.MigrateSubjects(); err != nil {
+			t.Fatalf("MigrateSubjects: %v", err)
+		}
+	}
+
+	var sales, support rbacModels.Department
+	db.Where("name = ?", "sales").First(&sales)
+	db.Where("name = ?", "support").First(&support)
+	departments, err := rbac.GetDepartmentsForUser("5")
+	if err != nil {
+		t.Fatalf("GetDepartmentsForUser: %v", err)
+	}
+	if len(departments) != 1 || departments[0] != rbac.GetDepartmentSubject(sales.ID) {
+		t.Fatalf("departments = %v, want [%s]", departments, rbac.GetDepartmentSubject(sales.ID))
+	}
+	if allowed, err := rbac.Enforce("5", rbac.GetTenantDomain(models.DefaultTenantID), "/crm/1", "GET"); err != nil || !allowed {
+		t.Fatalf("migrated department policy not effective: %v %v", allowed, err)
+	}
+	if policies, _ := rbac.GetAllPermissionsForSubject("sales"); len(policies) != 0 {
+		t.Fatalf("legacy policies left on name: %v", policies)
+	}
+	// 角色的策略不会被复制到同名部门
+	if policies, _ := rbac.GetAllPermissionsForSubject(rbac.GetDepartmentSubject(support.ID)); len(policies) != 0 {
+		t.Fatalf("role policies copied to department: %v", policies)
+	}
+	if policies, _ := rbac.GetAllPermissionsForSubject("support"); len(policies) != 1 {
+		t.Fatalf("role policies = %v, want unchanged", policies)
+	}
+}
+
+func TestDepartmentHierarchyInheritsPermissions(t *testing.T) {
+	setupRBAC(t)
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	it, err := Department.CreateDepartment(ctx, "IT", "", nil)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	backend, err := Department.CreateDepartment(ctx, "IT/Backend", "", &it.ID)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	storage, err := Department.CreateDepartment(ctx, "IT/Backend/DB", "", &backend.ID)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddPolicy(rbac.GetDepartmentSubject(it.ID), dom, "/servers/*", "GET"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rbac.AddDepartmentForUser("7", rbac.GetDepartmentSubject(storage.ID)); err != nil {
+		t.Fatal(err)
+	}
+	allowed := func() bool {
+		t.Helper()
+		ok, err := rbac.Enforce("7", dom, "/servers/1", "GET")
+		if err != nil {
+			t.Fatalf("Enforce: %v", err)
+		}
+		return ok
+	}
+
+	// 权限沿部门树向下继承，隐式部门包含所有上级部门
+	if !allowed() {
+		t.Fatal("member of IT/Backend/DB does not inherit the IT policy")
+	}
+	departments, err := rbac.GetImplicitDepartmentsForUser("7")
+	if err != nil {
+		t.Fatalf("GetImplicitDepartmentsForUser: %v", err)
+	}
+	for _, department := range []uint{it.ID, backend.ID, storage.ID} {
+		if !slices.Contains(departments, rbac.GetDepartmentSubject(department)) {
+			t.Fatalf("implicit departments = %v, want %s included", departments, rbac.GetDepartmentSubject(department))
+		}
+	}
+
+	// 移出上级部门后不再继承，移回后恢复
+	if _, err := Department.UpdateDepartment(ctx, backend.ID, backend.Name, "", nil); err != nil {
+		t.Fatalf("UpdateDepartment: %v", err)
+	}
+	if allowed() {
+		t.Fatal("department moved out of IT still inherits its policy")
+	}
+	if _, err := Department.UpdateDepartment(ctx, backend.ID, backend.Name, "", &it.ID); err != nil {
+		t.Fatalf("UpdateDepartment: %v", err)
+	}
+	if !allowed() {
+		t.Fatal("department moved back under IT does not inherit its policy")
+	}
+	if _, err := Department.UpdateDepartment(ctx, it.ID, it.Name, "", &storage.ID); err == nil {
+		t.Fatal("moving IT under its own descendant succeeded")
+	}
+
+	// 删除的部门不再出现在层级中
+	if err := Department.DeleteDepartment(ctx, backend.ID); err == nil {
+		t.Fatal("deleted a department that still has children")
+	}
+	if err := Department.DeleteDepartment(ctx, storage.ID); err != nil {
+		t.Fatalf("DeleteDepartment: %v", err)
+	}
+	if allowed() {
+		t.Fatal("member of a deleted department still inherits the IT policy")
+	}
+	if rules, _ := rbac.ListRules(rbac.DepartmentRule, rbac.GetDepartmentSubject(storage.ID)); len(rules) != 0 {
+		t.Fatalf("rules left for the deleted department: %v", rules)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// usernameInvalidChars 用户名中不允许的字符
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// externalUserInfo 外部身份源（OIDC、LDAP）提供的用户信息
+type externalUserInfo struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// linkExternalUser 按外部身份查找本地用户，找不到时按邮箱关联，仍找不到且允许时自动创建
+// trustEmail 为 true 时即使外部身份源未声明邮箱已验证，也允许按邮箱关联已有账号
+// 登录时还不知道用户所属的租户，tx 需要通过 database.WithoutTenant 跳过租户隔离
+func linkExternalUser(tx *gorm.DB, issuer string, info externalUserInfo, autoProvision, trustEmail bool) (*models.User, error) {
+	var identity models.UserIdentity
+	err := tx.Where("issuer = ? AND subject = ?", issuer, info.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := tx.First(&user, identity.UserID).Error; err != nil {
+			return nil, res.ErrUserNotFound
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if info.Email == "" {
+		return nil, res.ErrInvalidParam.WithMessage("身份源未提供邮箱")
+	}
+	var user models.User
+	err = tx.Where("email = ?", info.Email).First(&user).Error
+	switch {
+	case err == nil:
+		// 未验证的邮箱可能被他人冒用，不能据此接管已有账号
+		if !trustEmail && !info.EmailVerified {
+			return nil, res.ErrEmailAlreadyUsed.WithMessage("邮箱已被使用，且身份源未验证该邮箱")
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !autoProvision {
+			return nil, res.ErrUserNotFound.WithMessage("本地用户不存在，请联系管理员开通")
+		}
+		created, err := provisionExternalUser(tx, info)
+		if err != nil {
+			return nil, err
+		}
+		user = *created
+	default:
+		return nil, err
+	}
+
+	identity = models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: info.Subject,
+		Email:   info.Email,
+	}
+	if err := tx.Create(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provisionExternalUser 为首次登录的外部账号创建本地用户，本地密码随机且不告知用户
+func provisionExternalUser(tx *gorm.DB, info externalUserInfo) (*models.User, error) {
+	base := info.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(info.Email, "@")
+	}
+	username, err := uniqueUsername(tx, base)
+	if err != nil {
+		return nil, err
+	}
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		Username:      username,
+		Email:         info.Email,
+		Password:      string(hashedPassword),
+		FullName:      info.Name,
+		IsActive:      true,
+		EmailVerified: info.EmailVerified,
+	}
+	if info.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// syncMapping 根据外部分组计算应有的角色或部门，补充缺少的并移除多余的受管项
+// 只有映射表中出现过的角色或部门才会被移除，手工授予的其他项不受影响
+func syncMapping(mapping map[string][]string, values, current []string,
+	add, remove func(user, group string) (bool, error), subject string) error {
+	var managed, desired []string
+	for value, groups := range mapping {
+		managed = append(managed, groups...)
+		// 配置文件中的键会被转为小写，匹配时忽略大小写
+		if slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) }) {
+			desired = append(desired, groups...)
+		}
+	}
+	return syncGroups(subject, managed, desired, current, add, remove)
+}
+
+// userTenant 用户所属的租户，外部账号的角色和部门在该租户中同步
+func userTenant(userID uint) (uint, error) {
+	var user models.User
+	if err := database.WithoutTenant(database.GetDB()).Select("id", "tenant_id").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	return user.TenantID, nil
+}
+
+// syncRoleMapping 在租户域中按映射表同步主体的角色
+func syncRoleMapping(mapping map[string][]string, values []string, subject string, tenantID uint) error {
+	dom := rbac.GetTenantDomain(tenantID)
+	roles, err := rbac.GetRolesForUser(subject, dom)
+	if err != nil {
+		return err
+	}
+	add := func(user, role string) (bool, error) { return rbac.AddRoleForUser(user, role, dom) }
+	remove := func(user, role string) (bool, error) { return rbac.DeleteRoleForUser(user, role, dom) }
+	return syncMapping(mapping, values, roles, add, remove, subject)
+}
+
+// departmentMapping 将映射表中的部门名称转换为租户中的部门主体，不存在的部门记录日志后忽略
+func departmentMapping(ctx context.Context, mapping map[string][]string) map[string][]string {
+	resolved := make(map[string][]string, len(mapping))
+	for value, names := range mapping {
+		for _, name := range names {
+			department, err := rbac.GetDepartmentSubjectByName(ctx, name)
+			if err != nil {
+				utils.Log.Warnf("部门映射中的部门不存在: %s", name)
+				continue
+			}
+			resolved[value] = append(resolved[value], department)
+		}
+	}
+	return resolved
+}
+
+// syncGroups 使主体的受管分组与期望一致
+func syncGroups(subject string, managed, desired, current []string,
+	add, remove func(user, group string) (bool, error)) error {
+	var notify rbac.NotifyErrors
+	for _, group := range desired {
+		if !slices.Contains(current, group) {
+			if _, err := add(subject, group); notify.Check(err) != nil {
+				return err
+			}
+		}
+	}
+	for _, group := range current {
+		if slices.Contains(managed, group) && !slices.Contains(desired, group) {
+			if _, err := remove(subject, group); notify.Check(err) != nil {
+				return err
+			}
+		}
+	}
+	return notify.Err()
+}
+
+// uniqueUsername 根据外部账号名生成不重复的本地用户名
+func uniqueUsername(tx *gorm.DB, base string) (string, error) {
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) > 15 {
+		base = base[:15]
+	}
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	username := base
+	for range 5 {
+		var count int64
+		// 软删除的用户仍占用唯一索引
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		suffix, err := randomHex(2)
+		if err != nil {
+			return "", err
+		}
+		username = base + "_" + suffix
+	}
+	return "", res.ErrUsernameTaken
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2/util"
+)
+
+// GrantGuardService 权限管理操作的防越权校验
+// 操作者只能在自己的租户域中授予自己拥有的角色、部门和权限，涉及超级管理员或其他租户的变更只能由超级管理员执行
+type GrantGuardService struct{}
+
+var GrantGuard = &GrantGuardService{}
+
+// plainAction 不含正则语法的单个操作名，如 GET
+var plainAction = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// CheckSubject 修改超级管理员角色本身或拥有超级管理员角色的主体时，要求操作者是超级管理员
+func (s *GrantGuardService) CheckSubject(actor, sub string) error {
+	target, err := rbac.IsSuperAdmin(sub)
+	if err != nil || !target {
+		return err
+	}
+	return s.requireSuperAdmin(actor)
+}
+
+// ResolveDomain 确定权限管理操作所在的域，未指定时为操作者自己的租户域
+// 只有超级管理员可以指定其他租户域或全局域 *
+func (s *GrantGuardService) ResolveDomain(actor, actorDomain, requested string) (string, error) {
+	if requested == "" || requested == actorDomain {
+		return actorDomain, nil
+	}
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil {
+		return "", err
+	}
+	if !super {
+		return "", res.ErrInsufficientPermissions.WithMessage("只有超级管理员可以管理其他租户")
+	}
+	if requested == rbac.AllDomains {
+		return requested, nil
+	}
+	id, err := strconv.ParseUint(requested, 10, 64)
+	if err != nil {
+		return "", res.ErrInvalidParam.WithMessage("无效的租户: " + requested)
+	}
+	if _, err := Tenant.GetTenantByID(uint(id)); err != nil {
+		return "", err
+	}
+	return requested, nil
+}
+
+// CheckUserDomain 用户和API密钥只能在所属租户域或全局域中分配角色
+func (s *GrantGuardService) CheckUserDomain(sub, dom string) error {
+	if dom == rbac.AllDomains {
+		return nil
+	}
+	var tenantID uint
+	db := database.WithoutTenant(database.GetDB())
+	if keyID, ok := strings.CutPrefix(sub, "apikey:"); ok {
+		if err := db.Model(&models.User{}).
+			Joins("JOIN api_keys ON api_keys.user_id = users.id").
+			Where("api_keys.id = ?", keyID).Pluck("users.tenant_id", &tenantID).Error; err != nil {
+			return err
+		}
+	} else if err := db.Model(&models.User{}).Where("id = ?", sub).Pluck("tenant_id", &tenantID).Error; err != nil {
+		return err
+	}
+	if tenantID == 0 {
+		return res.ErrUserNotFound
+	}
+	if rbac.GetTenantDomain(tenantID) != dom {
+		return res.ErrInvalidParam.WithMessage("用户不属于该租户")
+	}
+	return nil
+}
+
+// CheckRole 只能在域中授予自己拥有的角色，super_admin 只能由超级管理员授予
+func (s *GrantGuardService) CheckRole(actor, role, dom string) error {
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil || super {
+		return err
+	}
+	roles, err := rbac.GetImplicitRolesForUser(actor, dom)
+	if err != nil {
+		return err
+	}
+	if role == rbac.SuperAdminRole || !slices.Contains(roles, role) {
+		return res.ErrInsufficientPermissions.WithMessage("不能授予自己没有的角色: " + role)
+	}
+	return nil
+}
+
+// CheckDepartment 只能将用户加入自己所属的部门或其上级部门
+// 加入下级部门会同时获得该部门自身的权限，因此不允许
+func (s *GrantGuardService) CheckDepartment(actor, department string) error {
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil || super {
+		return err
+	}
+	departments, err := rbac.GetImplicitDepartmentsForUser(actor)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(departments, department) {
+		return res.ErrInsufficientPermissions.WithMessage("不能分配自己不属于的部门: " + department)
+	}
+	return nil
+}
+
+// CheckPolicy 只能在域中授予或拒绝被自己在该域中已有允许策略完全覆盖的权限
+// 自己的条件策略只覆盖相同条件的授权，无条件策略覆盖任意条件
+// 授予允许策略时，与自己的拒绝策略有重叠的权限也不能授予，否则会把自己被排除的操作交给别人
+func (s *GrantGuardService) CheckPolicy(actor, dom, obj, act, cond, eft string) error {
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil || super {
+		return err
+	}
+	held, err := rbac.GetImplicitPermissionsForSubject(actor, dom)
+	if err != nil {
+		return err
+	}
+	covered := false
+	for _, rule := range held {
+		if rule[5] == rbac.EffectDeny {
+			if eft == rbac.EffectAllow && policiesOverlap(rule[2], rule[3], obj, act) {
+				return res.ErrInsufficientPermissions.WithMessage("不能授予自己被拒绝的权限: " + act + " " + obj)
+			}
+			continue
+		}
+		if objectCovers(rule[2], obj) && actionCovers(rule[3], act) && (rule[4] == rbac.NoCondition || rule[4] == cond) {
+			covered = true
+		}
+	}
+	if !covered {
+		return res.ErrInsufficientPermissions.WithMessage("不能授予自己没有的权限: " + act + " " + obj)
+	}
+	return nil
+}
+
+// CheckRemovePolicy 不能删除作用于自己的拒绝策略，即主体为自己、自己的角色或所属部门的拒绝策略
+// 拒绝策略用来限制持有者，允许持有者删除就等于允许其解除对自己的限制
+func (s *GrantGuardService) CheckRemovePolicy(actor, sub, dom, eft string) error {
+	if eft != rbac.EffectDeny {
+		return nil
+	}
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil || super {
+		return err
+	}
+	applies, err := s.appliesTo(actor, sub, dom)
+	if err != nil {
+		return err
+	}
+	if applies {
+		return res.ErrInsufficientPermissions.WithMessage("不能删除作用于自己的拒绝策略")
+	}
+	return nil
+}
+
+// CheckRemoveLink 不能解除自己（或自己的角色、所属部门）与带有拒绝策略的角色或部门之间的关系
+// member、group 为 g 或 g2 规则的两端，dom 为 g 规则的域，g2 规则不区分域
+func (s *GrantGuardService) CheckRemoveLink(actor, member, group, dom string) error {
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil || super {
+		return err
+	}
+	applies, err := s.appliesTo(actor, member, dom)
+	if err != nil || !applies {
+		return err
+	}
+	rules, err := rbac.GetImplicitPermissionsForSubject(group, dom)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule[5] == rbac.EffectDeny {
+			return res.ErrInsufficientPermissions.WithMessage("不能解除自己与带有拒绝策略的角色或部门的关系: " + group)
+		}
+	}
+	return nil
+}
+
+// appliesTo 主体是否是操作者自己，或操作者在域中直接或继承的角色、所属的部门及其上级部门
+func (s *GrantGuardService) appliesTo(actor, sub, dom string) (bool, error) {
+	if sub == actor {
+		return true, nil
+	}
+	roles, err := rbac.GetImplicitRolesForUser(actor, dom)
+	if err != nil {
+		return false, err
+	}
+	departments, err := rbac.GetImplicitDepartmentsForUser(actor)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(roles, sub) || slices.Contains(departments, sub), nil
+}
+
+// requireSuperAdmin 要求操作者是超级管理员
+func (s *GrantGuardService) requireSuperAdmin(actor string) error {
+	super, err := rbac.IsSuperAdmin(actor)
+	if err != nil {
+		return err
+	}
+	if !super {
+		return res.ErrInsufficientPermissions.WithMessage("只有超级管理员可以修改超级管理员的权限")
+	}
+	return nil
+}
+
+// policiesOverlap 两条策略的资源和操作是否可能同时匹配某个请求，无法确定时按重叠处理
+func policiesOverlap(obj1, act1, obj2, act2 string) bool {
+	objects := objectCovers(obj1, obj2) || objectCovers(obj2, obj1) || util.KeyMatch2(obj1, obj2) || util.KeyMatch2(obj2, obj1)
+	actions := actionCovers(act1, act2) || actionCovers(act2, act1)
+	return objects && actions
+}
+
+// objectCovers 已有资源模式是否覆盖要授予的资源模式
+// 模式之间的包含关系无法精确判断，这里只认可通配、相同、前缀通配和具体路径这几种确定覆盖的情况
+func objectCovers(held, want string) bool {
+	switch {
+	case held == "*" || held == want:
+		return true
+	case want == "*":
+		return false
+	case strings.HasSuffix(held, "/*") && strings.HasPrefix(want, strings.TrimSuffix(held, "*")):
+		return true
+	case !strings.ContainsAny(want, ":*"):
+		return util.KeyMatch2(want, held)
+	}
+	return false
+}
+
+// actionCovers 已有操作是否覆盖要授予的操作，要授予的操作只接受 * 或 GET|POST 形式的方法列表
+func actionCovers(held, want string) bool {
+	if held == "*" || held == want {
+		return true
+	}
+	if want == "*" {
+		return false
+	}
+	for _, action := range strings.Split(want, "|") {
+		if !plainAction.MatchString(action) {
+			return false
+		}
+		// 与匹配器中的 actionMatch 语义一致
+		if !rbac.ActionMatch(action, held) {
+			return false
+		}
+	}
+	return true
+}
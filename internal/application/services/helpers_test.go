@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/res"
+	"testing"
+)
+
+// assertCode 断言错误为指定的业务异常
+func assertCode(t *testing.T, err error, want *res.BusinessError) {
+	t.Helper()
+	var got *res.BusinessError
+	if !errors.As(err, &got) || got.Code != want.Code {
+		t.Fatalf("error = %v, want %d %s", err, want.Code, want.Message)
+	}
+}
+
+// setupRBAC 初始化测试数据库、默认租户和 Casbin
+func setupRBAC(t *testing.T) {
+	t.Helper()
+	dbtest.Open(t)
+	if err := Tenant.EnsureDefaultTenant(); err != nil {
+		t.Fatalf("EnsureDefaultTenant: %v", err)
+	}
+	if err := rbac.InitRBAC(); err != nil {
+		t.Fatalf("InitRBAC: %v", err)
+	}
+}
+
+// createRoles 在角色表中定义角色
+func createRoles(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := database.GetDB().Create(&rbacModels.Role{Name: name}).Error; err != nil {
+			t.Fatalf("create role %s: %v", name, err)
+		}
+	}
+}
+
+// createUser 在默认租户中创建启用的用户
+func createUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: username + "@example.com", Password: "-", IsActive: true}
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	if err := database.GetDB().WithContext(ctx).Create(user).Error; err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	// 每个测试使用新的数据库，用户ID会重复，清除其他测试留下的状态缓存
+	Session.InvalidateUser(user.ID)
+	return user
+}
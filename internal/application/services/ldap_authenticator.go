@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// LDAPConn LDAP认证所需的连接操作，*ldap.Conn 即满足该接口，测试时可替换为进程内的模拟实现
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator 使用 LDAP / Active Directory 认证
+// 先用服务账号查询用户DN，再以用户DN和密码绑定校验密码
+type LDAPAuthenticator struct {
+	// Dial 建立LDAP连接，为空时按配置连接服务器
+	Dial func() (LDAPConn, error)
+}
+
+var LDAP = &LDAPAuthenticator{}
+
+// Name 后端名称
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+// Authenticate 校验LDAP密码，关联或创建本地用户，并同步角色和部门
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// 空密码会被服务器当作匿名绑定而成功，必须拒绝
+	if password == "" {
+		return nil, res.ErrInvalidCredentials
+	}
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.searchUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, res.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	cfg := config.AppConfig.LDAP
+	var user *models.User
+	err = database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		// 目录中的邮箱属性通常可由用户自行修改，默认不据此关联已有账号，配置 trust_email 后视为已验证
+		user, err = linkExternalUser(tx, ldapIssuer(), externalUserInfo{
+			Subject:           entry.DN,
+			Email:             entry.GetAttributeValue(cfg.EmailAttribute),
+			EmailVerified:     cfg.TrustEmail,
+			PreferredUsername: entry.GetAttributeValue(cfg.UsernameAttribute),
+			Name:              entry.GetAttributeValue(cfg.NameAttribute),
+		}, cfg.AutoProvision, cfg.TrustEmail)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := a.syncUser(user.ID, entry); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Sync 同步所有已关联LDAP用户的角色和部门，目录中已不存在的用户只记录日志
+func (a *LDAPAuthenticator) Sync() error {
+	var identities []models.UserIdentity
+	if err := database.GetDB().Where("issuer = ?", ldapIssuer()).Find(&identities).Error; err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		return nil
+	}
+	conn, err := a.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, identity := range identities {
+		entry, err := a.lookup(conn, identity.Subject)
+		if err != nil {
+			utils.Log.Warnf("LDAP用户同步失败, dn=%s: %v", identity.Subject, err)
+			continue
+		}
+		if err := a.syncUser(identity.UserID, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartSync 按配置的周期在后台同步，周期为 0 时不启动
+func (a *LDAPAuthenticator) StartSync(onError func(error)) {
+	interval := config.AppConfig.LDAP.SyncInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := a.Sync(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// connect 建立连接并以服务账号绑定
+func (a *LDAPAuthenticator) connect() (LDAPConn, error) {
+	cfg := config.AppConfig.LDAP
+	var conn LDAPConn
+	var err error
+	if a.Dial != nil {
+		conn, err = a.Dial()
+	} else {
+		conn, err = dialLDAP(cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LDAP连接失败: %w", err)
+	}
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP服务账号绑定失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// searchUser 按用户名查询唯一的用户条目
+func (a *LDAPAuthenticator) searchUser(conn LDAPConn, username string) (*ldap.Entry, error) {
+	cfg := config.AppConfig.LDAP
+	result, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(cfg.UserFilter, "%s", ldap.EscapeFilter(username)),
+		a.attributes(), nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, res.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, res.ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// lookup 按DN读取用户条目
+func (a *LDAPAuthenticator) lookup(conn LDAPConn, dn string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(config.AppConfig.LDAP.Timeout.Seconds()), false,
+		"(objectClass=*)", a.attributes(), nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, errors.New("用户不存在")
+	}
+	return result.Entries[0], nil
+}
+
+// attributes 需要读取的用户属性
+func (a *LDAPAuthenticator) attributes() []string {
+	cfg := config.AppConfig.LDAP
+	return []string{cfg.UsernameAttribute, cfg.EmailAttribute, cfg.NameAttribute, cfg.GroupAttribute}
+}
+
+// syncUser 在用户所属租户中按所属组同步角色，按OU结构同步部门
+func (a *LDAPAuthenticator) syncUser(userID uint, entry *ldap.Entry) error {
+	cfg := config.AppConfig.LDAP
+	subject := rbac.GetUserID(userID)
+	tenantID, err := userTenant(userID)
+	if err != nil {
+		return err
+	}
+
+	groups := entry.GetAttributeValues(cfg.GroupAttribute)
+	if err := syncRoleMapping(cfg.RoleMapping, groups, subject, tenantID); err != nil {
+		return err
+	}
+
+	if cfg.DepartmentBaseDN == "" {
+		return nil
+	}
+	path, err := ouPath(entry.DN, cfg.DepartmentBaseDN)
+	if err != nil {
+		return err
+	}
+	var desired []string
+	if len(path) > 0 {
+		department, err := ensureDepartmentPath(database.WithTenant(context.Background(), tenantID), path)
+		if err != nil {
+			return err
+		}
+		desired = []string{department}
+	}
+	// 部门完全由OU结构决定
+	departments, err := rbac.GetDepartmentsForUser(subject)
+	if err != nil {
+		return err
+	}
+	return syncGroups(subject, departments, desired, departments, rbac.AddDepartmentForUser, rbac.DeleteDepartmentForUser)
+}
+
+// ouPath 提取用户DN中位于部门根DN之下的OU，按从上到下的顺序返回
+func ouPath(userDN, baseDN string) ([]string, error) {
+	dn, err := ldap.ParseDN(userDN)
+	if err != nil {
+		return nil, err
+	}
+	base, err := ldap.ParseDN(baseDN)
+	if err != nil {
+		return nil, err
+	}
+	if !base.AncestorOfFold(dn) {
+		return nil, nil
+	}
+	var path []string
+	// 跳过用户自身的RDN和根DN部分
+	for _, rdn := range dn.RDNs[1 : len(dn.RDNs)-len(base.RDNs)] {
+		for _, attribute := range rdn.Attributes {
+			if strings.EqualFold(attribute.Type, "ou") {
+				path = append(path, attribute.Value)
+			}
+		}
+	}
+	slices.Reverse(path)
+	return path, nil
+}
+
+// ensureDepartmentPath 确保OU路径上的部门都在 ctx 的租户中存在并保持父子关系，返回最下层部门的主体
+func ensureDepartmentPath(ctx context.Context, path []string) (string, error) {
+	db := database.GetDB().WithContext(ctx)
+	var parentID *uint
+	for _, name := range path {
+		department := rbacModels.Department{Name: name, ParentID: parentID}
+		if err := db.Where(rbacModels.Department{Name: name}).Attrs(department).FirstOrCreate(&department).Error; err != nil {
+			return "", err
+		}
+		// 已存在的部门保留原有的上级部门
+		if err := Department.syncParent(&department); err != nil {
+			return "", err
+		}
+		id := department.ID
+		parentID = &id
+	}
+	return rbac.GetDepartmentSubject(*parentID), nil
+}
+
+// dialLDAP 按配置连接LDAP服务器
+func dialLDAP(cfg config.LDAPConfig) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ldapIssuer 外部身份关联中LDAP的来源标识
+func ldapIssuer() string {
+	return config.AppConfig.LDAP.URL
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBindDN     = "cn=readonly,dc=example,dc=com"
+	testEditorsDN  = "cn=editors,ou=groups,dc=example,dc=com"
+	testPeopleDN   = "ou=people,dc=example,dc=com"
+	testEngineerDN = "uid=dave,ou=dev,ou=eng," + testPeopleDN
+)
+
+// fakeDirectory 进程内的 LDAP 目录，按DN保存条目和密码
+type fakeDirectory struct {
+	passwords map[string]string
+	entries   map[string]map[string][]string
+}
+
+// fakeLDAPConn 满足 LDAPConn 的模拟连接，只支持认证器用到的查询
+type fakeLDAPConn struct {
+	dir   *fakeDirectory
+	bound string
+}
+
+// filterValue 从 (uid=xxx) 形式的查询条件中提取用户名
+var filterValue = regexp.MustCompile(`\(uid=([^)]*)\)`)
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	if password == "" || c.dir.passwords[username] != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+	c.bound = username
+	return nil
+}
+
+func (c *fakeLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.bound == "" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, nil)
+	}
+	result := &ldap.SearchResult{}
+	if request.Scope == ldap.ScopeBaseObject {
+		attributes, ok := c.dir.entries[request.BaseDN]
+		if !ok {
+			return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, nil)
+		}
+		result.Entries = append(result.Entries, ldap.NewEntry(request.BaseDN, attributes))
+		return result, nil
+	}
+	match := filterValue.FindStringSubmatch(request.Filter)
+	for dn, attributes := range c.dir.entries {
+		if match != nil && slices.Contains(attributes["uid"], match[1]) && strings.HasSuffix(dn, request.BaseDN) {
+			result.Entries = append(result.Entries, ldap.NewEntry(dn, attributes))
+		}
+	}
+	return result, nil
+}
+
+func (c *fakeLDAPConn) Close() error {
+	return nil
+}
+
+// setupLDAP 初始化数据库、RBAC、LDAP配置和包含一个用户的模拟目录
+func setupLDAP(t *testing.T) (*LDAPAuthenticator, *fakeDirectory) {
+	t.Helper()
+	setupRBAC(t)
+	createRoles(t, "editor")
+	dir := &fakeDirectory{
+		passwords: map[string]string{testBindDN: "service", testEngineerDN: "secret"},
+		entries: map[string]map[string][]string{
+			testEngineerDN: {
+				"uid":      {"dave"},
+				"mail":     {"dave@example.com"},
+				"cn":       {"Dave"},
+				"memberOf": {testEditorsDN},
+			},
+		},
+	}
+	previous := config.AppConfig.LDAP
+	cfg := previous
+	cfg.URL = "ldap://directory.test"
+	cfg.BindDN = testBindDN
+	cfg.BindPassword = "service"
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.RoleMapping = map[string][]string{testEditorsDN: {"editor"}}
+	cfg.DepartmentBaseDN = testPeopleDN
+	cfg.AutoProvision = true
+	cfg.TrustEmail = false
+	config.AppConfig.LDAP = cfg
+	t.Cleanup(func() { config.AppConfig.LDAP = previous })
+	return &LDAPAuthenticator{Dial: func() (LDAPConn, error) {
+		return &fakeLDAPConn{dir: dir}, nil
+	}}, dir
+}
+
+func TestLDAPAuthenticateProvisionsAndSyncs(t *testing.T) {
+	a, _ := setupLDAP(t)
+	user, err := a.Authenticate("dave", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Email != "dave@example.com" || user.EmailVerified {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	subject := rbac.GetUserID(user.ID)
+	roles, err := rbac.GetRolesForUser(subject, rbac.GetTenantDomain(models.DefaultTenantID))
+	if err != nil {
+		t.Fatalf("GetRolesForUser: %v", err)
+	}
+	if !slices.Contains(roles, "editor") {
+		t.Fatalf("roles = %v, want editor", roles)
+	}
+
+	// OU 结构 eng/dev 同步为部门树，用户归属最下层的 dev
+	departments, err := rbac.GetDepartmentsForUser(subject)
+	if err != nil {
+		t.Fatalf("GetDepartmentsForUser: %v", err)
+	}
+	if len(departments) != 1 {
+		t.Fatalf("departments = %v, want one", departments)
+	}
+	id, _ := rbac.ParseDepartmentSubject(departments[0])
+	var dev rbacModels.Department
+	if err := database.WithoutTenant(database.GetDB()).Preload("Parent").First(&dev, id).Error; err != nil {
+		t.Fatalf("load department: %v", err)
+	}
+	if dev.Name != "dev" || dev.Parent == nil || dev.Parent.Name != "eng" {
+		t.Fatalf("unexpected department: %+v", dev)
+	}
+}
+
+func TestLDAPAuthenticateRejectsInvalidCredentials(t *testing.T) {
+	a, _ := setupLDAP(t)
+	for _, tc := range []struct{ username, password string }{
+		{"dave", "wrong"},
+		{"dave", ""},
+		{"nobody", "secret"},
+		{"dave)(uid=*", "secret"},
+	} {
+		_, err := a.Authenticate(tc.username, tc.password)
+		assertCode(t, err, res.ErrInvalidCredentials)
+	}
+}
+
+func TestLDAPEmailLinkingRequiresTrustEmail(t *testing.T) {
+	a, _ := setupLDAP(t)
+	local := &models.User{Username: "dave-local", Email: "dave@example.com", Password: "-", IsActive: true}
+	if err := database.GetDB().WithContext(database.WithTenant(context.Background(), models.DefaultTenantID)).Create(local).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	_, err := a.Authenticate("dave", "secret")
+	assertCode(t, err, res.ErrEmailAlreadyUsed)
+
+	config.AppConfig.LDAP.TrustEmail = true
+	user, err := a.Authenticate("dave", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate with trust_email: %v", err)
+	}
+	if user.ID != local.ID {
+		t.Fatalf("linked user %d, want %d", user.ID, local.ID)
+	}
+}
+
+func TestLDAPSyncRemovesRevokedGroups(t *testing.T) {
+	a, dir := setupLDAP(t)
+	user, err := a.Authenticate("dave", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	dir.entries[testEngineerDN]["memberOf"] = nil
+	if err := a.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	roles, err := rbac.GetRolesForUser(rbac.GetUserID(user.ID), rbac.GetTenantDomain(models.DefaultTenantID))
+	if err != nil {
+		t.Fatalf("GetRolesForUser: %v", err)
+	}
+	if slices.Contains(roles, "editor") {
+		t.Fatalf("roles = %v, editor should have been removed", roles)
+	}
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	if _, err := rbac.GetDepartmentSubjectByName(ctx, "dev"); err != nil {
+		t.Fatalf("department removed by sync: %v", err)
+	}
+}
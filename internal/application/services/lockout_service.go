@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LockoutService struct{}
+
+var Lockout = &LockoutService{}
+
+// Check 检查用户名和客户端IP是否处于锁定状态
+func (s *LockoutService) Check(username, clientIP string) error {
+	var locks []models.LoginLock
+	now := time.Now()
+	if err := database.GetDB().
+		Where("key IN ? AND locked_until > ?", []string{userLockKey(username), ipLockKey(clientIP)}, now).
+		Find(&locks).Error; err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		remaining := formatRemaining(lock.LockedUntil.Sub(now))
+		if lock.Key == userLockKey(username) {
+			return res.ErrAccountLocked.WithMessage("账号已锁定，请在" + remaining + "后重试")
+		}
+		return res.ErrTooManyAttempts.WithMessage("登录尝试过于频繁，请在" + remaining + "后重试")
+	}
+	return nil
+}
+
+// RecordFailure 记录一次登录失败，达到阈值时按指数退避锁定
+func (s *LockoutService) RecordFailure(username, clientIP string) error {
+	cfg := config.AppConfig.Lockout
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := s.recordFailure(tx, userLockKey(username), cfg.MaxAttempts, cfg); err != nil {
+			return err
+		}
+		return s.recordFailure(tx, ipLockKey(clientIP), cfg.IPMaxAttempts, cfg)
+	})
+}
+
+// RecordSuccess 登录成功后清除该用户名的失败记录
+// IP 的失败记录不清除，避免攻击者用自己的账号登录来重置计数
+func (s *LockoutService) RecordSuccess(username string) error {
+	return database.GetDB().Where("key = ?", userLockKey(username)).Delete(&models.LoginLock{}).Error
+}
+
+// Unlock 管理员解除用户的登录锁定，清除该用户名的失败次数和锁定次数
+// 用户只对应 user:<用户名> 一个键；IP 的锁定由该IP上所有用户名的失败累计而来，不属于某个用户，
+// 不随之清除，否则攻击者可以借任一受害账号被解锁来重置对整个IP的限制
+// 调用方负责校验用户属于操作者的租户
+func (s *LockoutService) Unlock(userID uint) error {
+	db := database.GetDB()
+	var user models.User
+	if err := database.WithoutTenant(db).Select("id", "username").First(&user, userID).Error; err != nil {
+		return res.ErrUserNotFound
+	}
+	return db.Where("key = ?", userLockKey(user.Username)).Delete(&models.LoginLock{}).Error
+}
+
+// recordFailure 累加指定键的失败次数，threshold 为 0 时不统计
+func (s *LockoutService) recordFailure(tx *gorm.DB, key string, threshold int, cfg config.LockoutConfig) error {
+	if threshold <= 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginLock{Key: key}).Error; err != nil {
+		return err
+	}
+	var lock models.LoginLock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&lock).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if lock.IsLocked(now) {
+		return nil
+	}
+	// 超过统计窗口重新计数，长时间没有失败时锁定次数也随之清零
+	if now.Sub(lock.LastFailedAt) > cfg.Window {
+		lock.Failures = 0
+	}
+	if now.Sub(lock.LastFailedAt) > cfg.MaxDuration {
+		lock.LockCount = 0
+	}
+	lock.Failures++
+	lock.LastFailedAt = now
+	if lock.Failures >= threshold {
+		lock.LockCount++
+		lockedUntil := now.Add(lockDuration(lock.LockCount, cfg))
+		lock.LockedUntil = &lockedUntil
+		lock.Failures = 0
+	}
+	return tx.Select("failures", "lock_count", "last_failed_at", "locked_until").Save(&lock).Error
+}
+
+// lockDuration 第 n 次锁定的时长：BaseDuration * 2^(n-1)，不超过 MaxDuration
+func lockDuration(lockCount int, cfg config.LockoutConfig) time.Duration {
+	duration := cfg.BaseDuration
+	for i := 1; i < lockCount && duration < cfg.MaxDuration; i++ {
+		duration *= 2
+	}
+	if cfg.MaxDuration > 0 && duration > cfg.MaxDuration {
+		duration = cfg.MaxDuration
+	}
+	return duration
+}
+
+// formatRemaining 将剩余锁定时间格式化为提示文字
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d秒", int(d.Seconds())+1)
+	}
+	return fmt.Sprintf("%d分钟", int(d.Minutes()+0.999))
+}
+
+func userLockKey(username string) string {
+	return "user:" + username
+}
+
+func ipLockKey(clientIP string) string {
+	return "ip:" + clientIP
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/res"
+	"testing"
+	"time"
+)
+
+// setupLockout 使用较小的阈值，测试结束时恢复配置
+func setupLockout(t *testing.T) config.LockoutConfig {
+	t.Helper()
+	dbtest.Open(t)
+	previous := config.AppConfig.Lockout
+	t.Cleanup(func() { config.AppConfig.Lockout = previous })
+	config.AppConfig.Lockout = config.LockoutConfig{
+		MaxAttempts:   3,
+		IPMaxAttempts: 10,
+		Window:        15 * time.Minute,
+		BaseDuration:  time.Minute,
+		MaxDuration:   10 * time.Minute,
+	}
+	return config.AppConfig.Lockout
+}
+
+// failTimes 记录 n 次登录失败
+func failTimes(t *testing.T, username, clientIP string, n int) {
+	t.Helper()
+	for range n {
+		if err := Lockout.RecordFailure(username, clientIP); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+}
+
+// loginLock 读取指定键的锁定记录
+func loginLock(t *testing.T, key string) models.LoginLock {
+	t.Helper()
+	var lock models.LoginLock
+	if err := database.GetDB().Where("key = ?", key).First(&lock).Error; err != nil {
+		t.Fatalf("load lock %s: %v", key, err)
+	}
+	return lock
+}
+
+// expireLock 将锁定时间改为已过期，模拟等待锁定结束
+func expireLock(t *testing.T, key string) {
+	t.Helper()
+	if err := database.GetDB().Model(&models.LoginLock{}).Where("key = ?", key).
+		Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockDurationBackoff(t *testing.T) {
+	cfg := config.LockoutConfig{BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, duration := range want {
+		if got := lockDuration(i+1, cfg); got != duration {
+			t.Errorf("lockDuration(%d) = %v, want %v", i+1, got, duration)
+		}
+	}
+}
+
+func TestLockoutBackoffAndExpiry(t *testing.T) {
+	cfg := setupLockout(t)
+	key := userLockKey("alice")
+
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts-1)
+	if err := Lockout.Check("alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Check below the threshold: %v", err)
+	}
+	failTimes(t, "alice", "10.0.0.1", 1)
+	assertCode(t, Lockout.Check("alice", "10.0.0.1"), res.ErrAccountLocked)
+	// 其他用户名不受影响
+	if err := Lockout.Check("bob", "10.0.0.2"); err != nil {
+		t.Fatalf("Check for another user: %v", err)
+	}
+	first := loginLock(t, key)
+	if d := time.Until(*first.LockedUntil); d <= 0 || d > cfg.BaseDuration {
+		t.Fatalf("first lock lasts %v, want up to %v", d, cfg.BaseDuration)
+	}
+	// 锁定期间的失败不计数
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts)
+	if lock := loginLock(t, key); lock.LockCount != 1 || lock.Failures != 0 {
+		t.Fatalf("lock during lockout = %d locks, %d failures; want unchanged", lock.LockCount, lock.Failures)
+	}
+
+	// 锁定到期后可以再次尝试，再次达到阈值时锁定时长翻倍
+	expireLock(t, key)
+	if err := Lockout.Check("alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Check after the lock expired: %v", err)
+	}
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts)
+	second := loginLock(t, key)
+	if d := time.Until(*second.LockedUntil); second.LockCount != 2 || d <= cfg.BaseDuration || d > 2*cfg.BaseDuration {
+		t.Fatalf("second lock = count %d lasting %v, want count 2 lasting up to %v", second.LockCount, d, 2*cfg.BaseDuration)
+	}
+}
+
+func TestLockoutSuccessResetsUserOnly(t *testing.T) {
+	cfg := setupLockout(t)
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts-1)
+	if err := Lockout.RecordSuccess("alice"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	// 成功后重新计数，再失败一次不会锁定
+	failTimes(t, "alice", "10.0.0.1", 1)
+	if err := Lockout.Check("alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Check after success: %v", err)
+	}
+	// IP 的计数不因成功登录清零
+	if lock := loginLock(t, ipLockKey("10.0.0.1")); lock.Failures != cfg.MaxAttempts {
+		t.Fatalf("ip failures = %d, want %d", lock.Failures, cfg.MaxAttempts)
+	}
+	failTimes(t, "mallory", "10.0.0.1", cfg.IPMaxAttempts-cfg.MaxAttempts)
+	assertCode(t, Lockout.Check("carol", "10.0.0.1"), res.ErrTooManyAttempts)
+}
+
+func TestUnlockClearsUserLock(t *testing.T) {
+	cfg := setupLockout(t)
+	user := createUser(t, "alice")
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts)
+	assertCode(t, Lockout.Check("alice", "10.0.0.2"), res.ErrAccountLocked)
+
+	if err := Lockout.Unlock(user.ID); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := Lockout.Check("alice", "10.0.0.2"); err != nil {
+		t.Fatalf("Check after unlock: %v", err)
+	}
+	// 锁定次数一并清零，下次锁定重新从基础时长开始
+	failTimes(t, "alice", "10.0.0.1", cfg.MaxAttempts)
+	if lock := loginLock(t, userLockKey("alice")); lock.LockCount != 1 {
+		t.Fatalf("lock count after unlock = %d, want 1", lock.LockCount)
+	}
+	assertCode(t, Lockout.Unlock(user.ID+1), res.ErrUserNotFound)
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"gin-starter/pkg/utils/totp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// mfaChallengeTTL 登录第二步挑战令牌有效期
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeMaxAttempts 同一挑战令牌允许输错验证码的次数
+	mfaChallengeMaxAttempts = 5
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+)
+
+// MFAService 双因素认证，按用户ID操作用户自己的数据（管理员重置前由调用方校验租户），不限制租户
+type MFAService struct{}
+
+var MFA = &MFAService{}
+
+// MFAEnrollment 双因素认证绑定信息
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// Enroll 生成新的TOTP密钥，确认前不会生效
+func (s *MFAService) Enroll(userID uint) (*MFAEnrollment, error) {
+	db := database.WithoutTenant(database.GetDB())
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, res.ErrUserNotFound
+	}
+	if user.MFAEnabled {
+		return nil, res.ErrInvalidParam.WithMessage("已启用双因素认证")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Model(&user).Update("mfa_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(config.AppConfig.MFA.Issuer, user.Username, secret),
+	}, nil
+}
+
+// Confirm 使用验证码确认绑定，启用双因素认证并返回恢复码
+// 当前会话同时被标记为已通过双因素认证
+func (s *MFAService) Confirm(userID uint, sessionID, code string) ([]string, error) {
+	var codes []string
+	err := database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err := s.lockUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.MFAEnabled {
+			return res.ErrInvalidParam.WithMessage("已启用双因素认证")
+		}
+		if user.MFASecret == "" {
+			return res.ErrInvalidParam.WithMessage("请先获取绑定密钥")
+		}
+		if err := s.verifyTOTP(tx, user, code); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sessionID != "" {
+		if err := Session.MarkMFA(userID, sessionID); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// Disable 用户验证后关闭双因素认证
+func (s *MFAService) Disable(userID uint, code string) error {
+	return database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err := s.lockUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !user.MFAEnabled {
+			return res.ErrInvalidParam.WithMessage("未启用双因素认证")
+		}
+		if err := s.verifyCode(tx, user, code); err != nil {
+			return err
+		}
+		return s.clear(tx, user.ID)
+	})
+}
+
+// RegenerateRecoveryCodes 用户验证后重新生成恢复码，旧恢复码全部失效
+func (s *MFAService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err := s.lockUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !user.MFAEnabled {
+			return res.ErrInvalidParam.WithMessage("未启用双因素认证")
+		}
+		if err := s.verifyTOTP(tx, user, code); err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Reset 管理员重置用户的双因素认证，并吊销该用户的全部会话
+func (s *MFAService) Reset(userID uint) error {
+	err := database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.lockUser(tx, userID); err != nil {
+			return err
+		}
+		return s.clear(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	return Session.RevokeAllSessions(userID)
+}
+
+// CreateChallenge 为已启用双因素认证的用户签发登录第二步的挑战令牌
+func (s *MFAService) CreateChallenge(user *models.User) (string, error) {
+	return Account.issueActionToken(database.WithoutTenant(database.GetDB()), user, jwt.PurposeMFAChallenge, "", mfaChallengeTTL)
+}
+
+// VerifyChallenge 校验挑战令牌和验证码（TOTP或恢复码），返回通过认证的用户
+// 验证码错误计入登录锁定，同一挑战令牌输错 mfaChallengeMaxAttempts 次后作废，需要重新登录
+func (s *MFAService) VerifyChallenge(token, code, clientIP string) (*models.User, error) {
+	claims, err := jwt.ParseActionToken(token, jwt.PurposeMFAChallenge)
+	if err != nil {
+		return nil, res.ErrInvalidActionToken.WithMessage("登录已过期，请重新登录")
+	}
+	db := database.WithoutTenant(database.GetDB())
+	var account models.User
+	if err := db.Select("id", "username").First(&account, claims.UserID).Error; err != nil {
+		return nil, res.ErrUserNotFound
+	}
+	username := account.Username
+	if err := Lockout.Check(username, clientIP); err != nil {
+		return nil, err
+	}
+	var user *models.User
+	var codeErr error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var record models.ActionToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("jti = ? AND purpose = ?", claims.ID, claims.Purpose).
+			First(&record).Error; err != nil {
+			return res.ErrInvalidActionToken.WithMessage("登录已过期，请重新登录")
+		}
+		if record.UsedAt != nil || record.UserID != claims.UserID || time.Now().After(record.ExpiresAt) {
+			return res.ErrInvalidActionToken.WithMessage("登录已过期，请重新登录")
+		}
+		var err error
+		user, err = s.lockUser(tx, claims.UserID)
+		if err != nil {
+			return err
+		}
+		if codeErr = s.verifyCode(tx, user, code); codeErr != nil {
+			if !errors.Is(codeErr, res.ErrInvalidMFACode) {
+				return codeErr
+			}
+			// 输错的次数随事务提交，达到上限时挑战令牌作废
+			updates := map[string]any{"attempts": record.Attempts + 1}
+			if record.Attempts+1 >= mfaChallengeMaxAttempts {
+				updates["used_at"] = time.Now()
+			}
+			return tx.Model(&record).Updates(updates).Error
+		}
+		_, err = Account.consumeActionToken(tx, claims)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if codeErr != nil {
+		if err := Lockout.RecordFailure(username, clientIP); err != nil {
+			return nil, err
+		}
+		return nil, codeErr
+	}
+	if err := Lockout.RecordSuccess(username); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// IsRequired 用户在租户域中是否属于必须启用双因素认证的角色，无法获取角色时返回错误，调用方应拒绝请求
+func (s *MFAService) IsRequired(userID uint, dom string) (bool, error) {
+	required := config.AppConfig.MFA.RequiredRoles
+	if len(required) == 0 {
+		return false, nil
+	}
+	roles, err := rbac.GetImplicitRolesForUser(rbac.GetUserID(userID), dom)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(required, role)
+	}), nil
+}
+
+// lockUser 加锁读取用户，避免并发校验同一验证码
+func (s *MFAService) lockUser(tx *gorm.DB, userID uint) (*models.User, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, res.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// verifyCode 校验TOTP验证码，不是6位数字时按恢复码处理
+func (s *MFAService) verifyCode(tx *gorm.DB, user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.verifyTOTP(tx, user, code)
+	}
+	return s.useRecoveryCode(tx, user.ID, code)
+}
+
+// verifyTOTP 校验TOTP验证码，同一时间步的验证码只能使用一次
+func (s *MFAService) verifyTOTP(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := totp.Validate(user.MFASecret, code, time.Now(), 1)
+	if !ok || step <= user.MFALastStep {
+		return res.ErrInvalidMFACode
+	}
+	user.MFALastStep = step
+	return tx.Model(user).Update("mfa_last_step", step).Error
+}
+
+// useRecoveryCode 使用恢复码
+func (s *MFAService) useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	normalized := normalizeRecoveryCode(code)
+	var recoveryCodes []models.RecoveryCode
+	if err := tx.Where("user_id = ? AND used_at IS NULL", userID).Find(&recoveryCodes).Error; err != nil {
+		return err
+	}
+	for _, recoveryCode := range recoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.CodeHash), []byte(normalized)) == nil {
+			return tx.Model(&recoveryCode).Update("used_at", time.Now()).Error
+		}
+	}
+	return res.ErrInvalidMFACode
+}
+
+// replaceRecoveryCodes 删除旧恢复码并生成新的恢复码，明文只在此时返回一次
+func (s *MFAService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: string(hash)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// clear 清除用户的双因素认证数据
+func (s *MFAService) clear(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"mfa_enabled":   false,
+		"mfa_secret":    "",
+		"mfa_last_step": 0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// normalizeRecoveryCode 忽略恢复码中的分隔符和大小写
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/res"
+	"gin-starter/pkg/utils/totp"
+	"testing"
+	"time"
+)
+
+func newMFAUser(t *testing.T) *models.User {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	user := &models.User{
+		Username:   "alice",
+		Email:      "alice@example.com",
+		Password:   "-",
+		IsActive:   true,
+		MFAEnabled: true,
+		MFASecret:  secret,
+	}
+	if err := database.GetDB().WithContext(database.WithTenant(context.Background(), models.DefaultTenantID)).Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestVerifyChallengeInvalidatedAfterMaxAttempts(t *testing.T) {
+	dbtest.Open(t)
+	user := newMFAUser(t)
+	token, err := MFA.CreateChallenge(user)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	for range mfaChallengeMaxAttempts {
+		_, err := MFA.VerifyChallenge(token, "wrong-code", "10.0.0.1")
+		assertCode(t, err, res.ErrInvalidMFACode)
+	}
+
+	// 输错的次数计入登录锁定
+	assertCode(t, Lockout.Check(user.Username, "10.0.0.1"), res.ErrAccountLocked)
+
+	// 解除锁定后，正确的验证码也不能再使用已作废的挑战令牌
+	if err := Lockout.Unlock(user.ID); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	code, err := totp.GenerateCode(user.MFASecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	_, err = MFA.VerifyChallenge(token, code, "10.0.0.1")
+	assertCode(t, err, res.ErrInvalidActionToken)
+}
+
+func TestVerifyChallengeAllowsRetry(t *testing.T) {
+	dbtest.Open(t)
+	user := newMFAUser(t)
+	token, err := MFA.CreateChallenge(user)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	_, err = MFA.VerifyChallenge(token, "wrong-code", "10.0.0.1")
+	assertCode(t, err, res.ErrInvalidMFACode)
+
+	code, err := totp.GenerateCode(user.MFASecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	verified, err := MFA.VerifyChallenge(token, code, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("VerifyChallenge: %v", err)
+	}
+	if verified.ID != user.ID {
+		t.Fatalf("verified user %d, want %d", verified.ID, user.ID)
+	}
+	// 挑战令牌只能使用一次
+	_, err = MFA.VerifyChallenge(token, code, "10.0.0.1")
+	assertCode(t, err, res.ErrInvalidActionToken)
+}
+
+func TestVerifyChallengeRejectsReplayedCode(t *testing.T) {
+	dbtest.Open(t)
+	user := newMFAUser(t)
+	code, err := totp.GenerateCode(user.MFASecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("GenerateCode: %v", err)
+	}
+	first, err := MFA.CreateChallenge(user)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	// 最后一次机会输入正确的验证码仍然通过
+	for range mfaChallengeMaxAttempts - 1 {
+		_, err := MFA.VerifyChallenge(first, "wrong-code", "10.0.0.1")
+		assertCode(t, err, res.ErrInvalidMFACode)
+	}
+	if _, err := MFA.VerifyChallenge(first, code, "10.0.0.1"); err != nil {
+		t.Fatalf("VerifyChallenge: %v", err)
+	}
+
+	// 同一时间步的验证码不能在新的挑战中再次使用
+	second, err := MFA.CreateChallenge(user)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	_, err = MFA.VerifyChallenge(second, code, "10.0.0.1")
+	assertCode(t, err, res.ErrInvalidMFACode)
+}
+
+func TestIsRequiredFailsClosed(t *testing.T) {
+	setupRBAC(t)
+	createRoles(t, "admin")
+	required := config.AppConfig.MFA.RequiredRoles
+	config.AppConfig.MFA.RequiredRoles = []string{"admin"}
+	t.Cleanup(func() { config.AppConfig.MFA.RequiredRoles = required })
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddRoleForUser("1", "admin", dom); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := MFA.IsRequired(1, dom); err != nil || !ok {
+		t.Fatalf("IsRequired = %v, %v; want true", ok, err)
+	}
+	if ok, err := MFA.IsRequired(2, dom); err != nil || ok {
+		t.Fatalf("IsRequired for a user without the role = %v, %v; want false", ok, err)
+	}
+
+	// 分配的有效期无法读取时角色未知，返回错误而不是跳过双因素认证
+	if err := database.GetDB().Migrator().DropTable(&rbacModels.TimedGrant{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MFA.IsRequired(1, dom); err == nil {
+		t.Fatal("IsRequired returned no error when roles could not be resolved")
+	}
+}
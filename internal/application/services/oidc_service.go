@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// oidcFlowTTL 第三方登录流程的有效期
+const oidcFlowTTL = 10 * time.Minute
+
+type OIDCService struct {
+	mu       sync.Mutex
+	provider *oidc.Provider
+
+	// HTTPClient 访问身份提供方使用的客户端，为空时使用默认客户端，测试时可指向本地模拟服务器
+	HTTPClient *http.Client
+}
+
+var OIDC = &OIDCService{}
+
+// OIDCAuthRequest 第三方登录跳转信息
+type OIDCAuthRequest struct {
+	URL       string // 身份提供方授权地址
+	FlowToken string // 流程状态令牌，需要保存到 Cookie 中
+}
+
+// OIDCLoginResult 第三方登录结果
+type OIDCLoginResult struct {
+	User *models.User
+	MFA  bool // 身份提供方是否声明已完成多因素认证
+}
+
+// AuthCodeURL 生成授权码 + PKCE 登录跳转地址
+func (s *OIDCService) AuthCodeURL(ctx context.Context) (*OIDCAuthRequest, error) {
+	oauthConfig, _, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+	flowToken, err := jwt.GenerateOIDCState(state, nonce, verifier, oidcFlowTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCAuthRequest{
+		URL:       oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+		FlowToken: flowToken,
+	}, nil
+}
+
+// Callback 处理授权回调：校验 state、换取并校验ID令牌、关联或创建本地用户，并同步角色和部门
+func (s *OIDCService) Callback(ctx context.Context, flowToken, state, code string) (*OIDCLoginResult, error) {
+	flow, err := jwt.ParseOIDCState(flowToken)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return nil, res.ErrOIDCLogin.WithMessage("登录状态无效或已过期，请重新登录")
+	}
+	oauthConfig, provider, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = s.context(ctx)
+
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		utils.Log.Warnf("OIDC授权码换取失败: %v", err)
+		return nil, res.ErrOIDCLogin.WithMessage("授权码无效")
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, res.ErrOIDCLogin.WithMessage("身份提供方未返回ID令牌")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		utils.Log.Warnf("OIDC ID令牌校验失败: %v", err)
+		return nil, res.ErrOIDCLogin.WithMessage("ID令牌无效")
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return nil, res.ErrOIDCLogin.WithMessage("ID令牌无效")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	info := parseOIDCUserInfo(idToken.Subject, claims)
+
+	var user *models.User
+	err = database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		user, err = linkExternalUser(tx, idToken.Issuer, info, config.AppConfig.OIDC.AutoProvision, !config.AppConfig.OIDC.RequireVerifiedEmail)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, res.ErrUserInactive
+	}
+	if err := s.syncMappings(user.ID, claimValues(claims[config.AppConfig.OIDC.RoleClaim])); err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return &OIDCLoginResult{
+		User: user,
+		MFA:  slices.Contains(claimValues(claims["amr"]), "mfa"),
+	}, nil
+}
+
+// client 获取 OAuth2 配置和身份提供方，首次使用时进行服务发现，失败后下次请求会重试
+func (s *OIDCService) client(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	cfg := config.AppConfig.OIDC
+	if !cfg.Enabled {
+		return nil, nil, res.ErrNotFound.WithMessage("未启用第三方登录")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(s.context(ctx), cfg.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.provider = provider
+	}
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     s.provider.Endpoint(),
+		Scopes:       cfg.Scopes,
+	}, s.provider, nil
+}
+
+// context 附加自定义 HTTP 客户端
+func (s *OIDCService) context(ctx context.Context) context.Context {
+	if s.HTTPClient == nil {
+		return ctx
+	}
+	return oidc.ClientContext(ctx, s.HTTPClient)
+}
+
+// syncMappings 按声明值在用户所属租户中同步角色和部门
+// 只处理映射表中出现过的角色和部门，手工授予的其他角色不受影响
+func (s *OIDCService) syncMappings(userID uint, values []string) error {
+	cfg := config.AppConfig.OIDC
+	subject := rbac.GetUserID(userID)
+	tenantID, err := userTenant(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := syncRoleMapping(cfg.RoleMapping, values, subject, tenantID); err != nil {
+		return err
+	}
+
+	departments, err := rbac.GetDepartmentsForUser(subject)
+	if err != nil {
+		return err
+	}
+	ctx := database.WithTenant(context.Background(), tenantID)
+	return syncMapping(departmentMapping(ctx, cfg.DepartmentMapping), values, departments, rbac.AddDepartmentForUser, rbac.DeleteDepartmentForUser, subject)
+}
+
+// parseOIDCUserInfo 从ID令牌声明中提取用户信息
+func parseOIDCUserInfo(subject string, claims map[string]any) externalUserInfo {
+	info := externalUserInfo{Subject: subject}
+	info.Email, _ = claims["email"].(string)
+	info.PreferredUsername, _ = claims["preferred_username"].(string)
+	info.Name, _ = claims["name"].(string)
+	// 部分身份提供方以字符串形式返回 email_verified
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		info.EmailVerified = verified
+	case string:
+		info.EmailVerified = verified == "true"
+	}
+	return info
+}
+
+// claimValues 将字符串或字符串数组形式的声明统一为字符串切片
+func claimValues(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"gin-starter/config"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// mockOIDCProvider 本地模拟的身份提供方，支持服务发现、JWKS 和授权码换取ID令牌
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// claims 换取授权码时签发的ID令牌中的声明，iss、aud 和时间由模拟服务器补充
+	claims gojwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	p := &mockOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid-code" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := gojwt.MapClaims{
+			"iss": p.server.URL,
+			"aud": config.AppConfig.OIDC.ClientID,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// setupOIDC 初始化数据库、RBAC 和指向模拟身份提供方的配置
+func setupOIDC(t *testing.T) (*OIDCService, *mockOIDCProvider) {
+	t.Helper()
+	setupRBAC(t)
+	createRoles(t, "editor")
+	provider := newMockOIDCProvider(t)
+	previous := config.AppConfig.OIDC
+	config.AppConfig.OIDC = config.OIDCConfig{
+		Enabled:              true,
+		Issuer:               provider.server.URL,
+		ClientID:             "gin-starter",
+		ClientSecret:         "secret",
+		RedirectURL:          "http://localhost/users/oidc/callback",
+		Scopes:               []string{"openid", "email"},
+		AutoProvision:        true,
+		RequireVerifiedEmail: true,
+		RoleClaim:            "groups",
+		RoleMapping:          map[string][]string{"editors": {"editor"}},
+	}
+	t.Cleanup(func() { config.AppConfig.OIDC = previous })
+	return &OIDCService{HTTPClient: provider.server.Client()}, provider
+}
+
+// startFlow 发起登录并返回流程令牌、state 和 nonce
+func startFlow(t *testing.T, s *OIDCService) (string, string, string) {
+	t.Helper()
+	authRequest, err := s.AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authRequest.URL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth url without PKCE: %s", authRequest.URL)
+	}
+	return authRequest.FlowToken, query.Get("state"), query.Get("nonce")
+}
+
+func TestOIDCCallbackProvisionsUserAndSyncsRoles(t *testing.T) {
+	s, provider := setupOIDC(t)
+	flowToken, state, nonce := startFlow(t, s)
+	provider.claims = gojwt.MapClaims{
+		"sub":                "idp-user-1",
+		"nonce":              nonce,
+		"email":              "bob@example.com",
+		"email_verified":     true,
+		"preferred_username": "bob",
+		"groups":             []string{"editors"},
+		"amr":                []string{"pwd", "mfa"},
+	}
+
+	result, err := s.Callback(context.Background(), flowToken, state, "valid-code")
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if result.User.Email != "bob@example.com" || !result.MFA {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	roles, err := rbac.GetRolesForUser(rbac.GetUserID(result.User.ID), rbac.GetTenantDomain(models.DefaultTenantID))
+	if err != nil {
+		t.Fatalf("GetRolesForUser: %v", err)
+	}
+	if !slices.Contains(roles, "editor") {
+		t.Fatalf("roles = %v, want editor", roles)
+	}
+
+	// 同一外部身份再次登录时关联到同一用户
+	flowToken, state, nonce = startFlow(t, s)
+	provider.claims["nonce"] = nonce
+	again, err := s.Callback(context.Background(), flowToken, state, "valid-code")
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+	if again.User.ID != result.User.ID {
+		t.Fatalf("second login created user %d, want %d", again.User.ID, result.User.ID)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidFlow(t *testing.T) {
+	s, provider := setupOIDC(t)
+	flowToken, state, nonce := startFlow(t, s)
+	provider.claims = gojwt.MapClaims{"sub": "idp-user-1", "nonce": nonce}
+
+	if _, err := s.Callback(context.Background(), flowToken, "forged-state", "valid-code"); err == nil {
+		t.Fatal("callback accepted a mismatched state")
+	}
+	_, err := s.Callback(context.Background(), flowToken, state, "bad-code")
+	assertCode(t, err, res.ErrOIDCLogin)
+
+	provider.claims["nonce"] = "replayed-nonce"
+	_, err = s.Callback(context.Background(), flowToken, state, "valid-code")
+	assertCode(t, err, res.ErrOIDCLogin)
+}
+
+func TestOIDCCallbackDoesNotLinkUnverifiedEmail(t *testing.T) {
+	s, provider := setupOIDC(t)
+	local := &models.User{Username: "carol", Email: "carol@example.com", Password: "-", IsActive: true}
+	if err := database.GetDB().WithContext(database.WithTenant(context.Background(), models.DefaultTenantID)).Create(local).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	flowToken, state, nonce := startFlow(t, s)
+	provider.claims = gojwt.MapClaims{
+		"sub":            "idp-user-2",
+		"nonce":          nonce,
+		"email":          "carol@example.com",
+		"email_verified": false,
+	}
+
+	result, err := s.Callback(context.Background(), flowToken, state, "valid-code")
+	if err == nil && result.User.ID == local.ID {
+		t.Fatal("unverified email linked to an existing account")
+	}
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gin-starter/internal/application/services/rbac"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type PermissionService struct{}
+
+var Permission = &PermissionService{}
+
+// SubjectPermissions 主体的权限，能对应到权限目录的显示为命名权限，其余为原始策略
+type SubjectPermissions struct {
+	Permissions []*rbacModels.Permission
+	Policies    [][]string
+}
+
+func (s *PermissionService) CreatePermission(name, resource, action, description string) (*rbacModels.Permission, error) {
+	if err := validatePermission(resource, action); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	if err := s.checkDuplicate(db, 0, name, resource, action); err != nil {
+		return nil, err
+	}
+	permission := &rbacModels.Permission{
+		Name:        name,
+		Resource:    resource,
+		Action:      action,
+		Description: description,
+	}
+	if err := db.Create(permission).Error; err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+// EnsurePermission 权限不存在时创建，用于初始化数据
+func (s *PermissionService) EnsurePermission(name, resource, action, description string) error {
+	permission := rbacModels.Permission{Name: name, Resource: resource, Action: action, Description: description}
+	return database.GetDB().Where(rbacModels.Permission{Name: name}).Attrs(permission).FirstOrCreate(&permission).Error
+}
+
+func (s *PermissionService) GetAllPermissions() ([]*rbacModels.Permission, error) {
+	db := database.GetDB()
+	var permissions []*rbacModels.Permission
+	if err := db.Order("name").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (s *PermissionService) GetPermissionByID(id uint) (*rbacModels.Permission, error) {
+	db := database.GetDB()
+	var permission rbacModels.Permission
+	if err := db.First(&permission, id).Error; err != nil {
+		return nil, res.ErrNotFound.WithMessage("权限不存在")
+	}
+	return &permission, nil
+}
+
+// UpdatePermission 更新权限，资源或操作变更时同步改写已授予的Casbin策略
+// 改写会扩大所有租户中持有者的权限，因此操作者必须在全局域中拥有变更后的权限
+func (s *PermissionService) UpdatePermission(actor string, id uint, name, resource, action, description string) (*rbacModels.Permission, error) {
+	if err := validatePermission(resource, action); err != nil {
+		return nil, err
+	}
+	if err := GrantGuard.CheckPolicy(actor, rbac.AllDomains, resource, action, rbac.NoCondition, rbac.EffectAllow); err != nil {
+		return nil, err
+	}
+	var permission, previous rbacModels.Permission
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&permission, id).Error; err != nil {
+			return res.ErrNotFound.WithMessage("权限不存在")
+		}
+		if err := s.checkDuplicate(tx, id, name, resource, action); err != nil {
+			return err
+		}
+		previous = permission
+		permission.Name = name
+		permission.Resource = resource
+		permission.Action = action
+		permission.Description = description
+		return tx.Save(&permission).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Casbin 规则在权限表提交后改写，改写失败时恢复权限表
+	if previous.Resource != resource || previous.Action != action {
+		err := rbac.UpdatePermission(previous.Resource, previous.Action, resource, action)
+		// 只是通知其他实例失败时修改已经生效，不回滚
+		if err != nil && !errors.Is(err, rbac.ErrNotifyFailed) {
+			if rollbackErr := db.Save(&previous).Error; rollbackErr != nil {
+				utils.Log.Errorf("权限表回滚失败, id=%d: %v", id, rollbackErr)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &permission, nil
+}
+
+// DeletePermission 删除权限，并从所有角色和部门上收回
+// Casbin 规则在权限表提交后移除，移除失败时恢复权限记录，可以重新删除
+func (s *PermissionService) DeletePermission(id uint) error {
+	var permission rbacModels.Permission
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&permission, id).Error; err != nil {
+			return res.ErrNotFound.WithMessage("权限不存在")
+		}
+		// 硬删除，便于之后重新创建同名权限
+		return tx.Unscoped().Delete(&permission).Error
+	})
+	if err != nil {
+		return err
+	}
+	err = rbac.RemovePermission(permission.Resource, permission.Action)
+	if err != nil && !errors.Is(err, rbac.ErrNotifyFailed) {
+		if rollbackErr := db.Create(&permission).Error; rollbackErr != nil {
+			utils.Log.Errorf("权限记录恢复失败, id=%d: %v", id, rollbackErr)
+		}
+	}
+	return err
+}
+
+// GrantToRole 在域中将命名权限授予角色
+func (s *PermissionService) GrantToRole(actor, dom string, roleID uint, names []string) error {
+	role, err := Role.GetRoleByID(roleID)
+	if err != nil {
+		return err
+	}
+	return s.grant(actor, dom, role.Name, names, rbac.AddPermissionForRole)
+}
+
+// RevokeFromRole 收回角色在域中的命名权限
+func (s *PermissionService) RevokeFromRole(actor, dom string, roleID uint, name string) error {
+	role, err := Role.GetRoleByID(roleID)
+	if err != nil {
+		return err
+	}
+	return s.revoke(actor, dom, role.Name, name)
+}
+
+// GrantToDepartment 在域中将命名权限授予部门
+func (s *PermissionService) GrantToDepartment(ctx context.Context, actor, dom string, departmentID uint, names []string) error {
+	department, err := Department.GetDepartmentByID(ctx, departmentID)
+	if err != nil {
+		return err
+	}
+	return s.grant(actor, dom, rbac.GetDepartmentSubject(department.ID), names, rbac.AddPermissionForDepartment)
+}
+
+// RevokeFromDepartment 收回部门在域中的命名权限
+func (s *PermissionService) RevokeFromDepartment(ctx context.Context, actor, dom string, departmentID uint, name string) error {
+	department, err := Department.GetDepartmentByID(ctx, departmentID)
+	if err != nil {
+		return err
+	}
+	return s.revoke(actor, dom, rbac.GetDepartmentSubject(department.ID), name)
+}
+
+// ListForSubject 列出直接授予主体、在域中生效的权限，无条件的允许策略按权限目录转换为命名权限，拒绝策略原样返回
+func (s *PermissionService) ListForSubject(sub, dom string) (*SubjectPermissions, error) {
+	rules, err := rbac.GetPermissionsForSubject(sub, dom)
+	if err != nil {
+		return nil, err
+	}
+	var catalog []*rbacModels.Permission
+	if err := database.GetDB().Find(&catalog).Error; err != nil {
+		return nil, err
+	}
+	index := make(map[[2]string]*rbacModels.Permission, len(catalog))
+	for _, permission := range catalog {
+		index[[2]string{permission.Resource, permission.Action}] = permission
+	}
+	result := &SubjectPermissions{
+		Permissions: []*rbacModels.Permission{},
+		Policies:    [][]string{},
+	}
+	for _, rule := range rules {
+		if permission, ok := index[[2]string{rule[2], rule[3]}]; ok && rule[4] == rbac.NoCondition && rule[5] == rbac.EffectAllow {
+			result.Permissions = append(result.Permissions, permission)
+			continue
+		}
+		result.Policies = append(result.Policies, rule)
+	}
+	return result, nil
+}
+
+// grant 按名称查找权限并在域中授予主体，操作者必须在该域中拥有全部权限
+func (s *PermissionService) grant(actor, dom, sub string, names []string, add func(sub, dom, resource, action string) (bool, error)) error {
+	if err := GrantGuard.CheckSubject(actor, sub); err != nil {
+		return err
+	}
+	permissions, err := s.findByNames(names)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if err := GrantGuard.CheckPolicy(actor, dom, permission.Resource, permission.Action, rbac.NoCondition, rbac.EffectAllow); err != nil {
+			return err
+		}
+	}
+	for _, permission := range permissions {
+		if _, err := add(sub, dom, permission.Resource, permission.Action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revoke 按名称收回主体在域中的权限
+func (s *PermissionService) revoke(actor, dom, sub, name string) error {
+	if err := GrantGuard.CheckSubject(actor, sub); err != nil {
+		return err
+	}
+	permissions, err := s.findByNames([]string{name})
+	if err != nil {
+		return err
+	}
+	_, err = rbac.RemovePermissionForSubject(sub, dom, permissions[0].Resource, permissions[0].Action)
+	return err
+}
+
+// findByNames 按名称查找权限，任一名称不存在时报错
+func (s *PermissionService) findByNames(names []string) ([]*rbacModels.Permission, error) {
+	var permissions []*rbacModels.Permission
+	if err := database.GetDB().Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, res.ErrNotFound.WithMessage("权限不存在: " + name)
+		}
+	}
+	return permissions, nil
+}
+
+// checkDuplicate 名称唯一，且同一资源和操作只能对应一个命名权限
+func (s *PermissionService) checkDuplicate(db *gorm.DB, id uint, name, resource, action string) error {
+	var existing rbacModels.Permission
+	if err := db.Where("name = ? AND id != ?", name, id).First(&existing).Error; err == nil {
+		return res.ErrInvalidParam.WithMessage("权限名称已存在")
+	}
+	if err := db.Where("resource = ? AND action = ? AND id != ?", resource, action, id).First(&existing).Error; err == nil {
+		return res.ErrInvalidParam.WithMessage("相同资源和操作的权限已存在: " + existing.Name)
+	}
+	return nil
+}
+
+// validatePermission 校验资源和操作格式，操作为 * 或合法的正则
+func validatePermission(resource, action string) error {
+	if resource != "*" && !strings.HasPrefix(resource, "/") {
+		return res.ErrInvalidParam.WithMessage("资源必须以 / 开头或为 *")
+	}
+	if action != "*" {
+		if _, err := regexp.Compile(action); err != nil {
+			return res.ErrInvalidParam.WithMessage("无效的操作: " + action)
+		}
+	}
+	return nil
+}
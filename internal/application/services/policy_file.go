@@ -0,0 +1,230 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"gin-starter/pkg/utils/res"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// 策略文件格式
+const (
+	PolicyFormatYAML = "yaml"
+	PolicyFormatCSV  = "csv"
+)
+
+// PolicyDocument 声明式策略文件，描述角色、权限目录、授权和角色分配
+// 用户和部门按名称引用，便于在不同环境之间比较和迁移
+type PolicyDocument struct {
+	Roles       []PolicyRole       `yaml:"roles"`
+	Permissions []PolicyPermission `yaml:"permissions"`
+	Grants      []PolicyGrant      `yaml:"grants"`
+	Assignments []PolicyAssignment `yaml:"assignments"`
+}
+
+// PolicyRole 角色
+type PolicyRole struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// PolicyPermission 权限目录中的命名权限
+type PolicyPermission struct {
+	Name        string `yaml:"name"`
+	Resource    string `yaml:"resource"`
+	Action      string `yaml:"action"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// PolicyGrant 授予角色或部门的一条策略，Role 和 Department 二选一，Permission 和 Obj/Act 二选一
+type PolicyGrant struct {
+	Role       string `yaml:"role,omitempty"`
+	Department string `yaml:"department,omitempty"` // 部门名称
+	Tenant     uint   `yaml:"tenant,omitempty"`     // 部门所属租户，默认为默认租户
+	Domain     string `yaml:"domain"`
+	Permission string `yaml:"permission,omitempty"` // 命名权限，授予为无条件的允许策略
+	Obj        string `yaml:"obj,omitempty"`
+	Act        string `yaml:"act,omitempty"`
+	Cond       string `yaml:"cond,omitempty"` // 为空时无条件
+	Eft        string `yaml:"eft,omitempty"`  // 为空时为 allow
+}
+
+// PolicyAssignment 在域中为主体分配角色，User 和 Subject 二选一
+type PolicyAssignment struct {
+	User       string     `yaml:"user,omitempty"`    // 用户名
+	Subject    string     `yaml:"subject,omitempty"` // 其他主体：用户ID、apikey:<id> 或继承该角色的角色
+	Role       string     `yaml:"role"`
+	Domain     string     `yaml:"domain"`
+	ValidFrom  *time.Time `yaml:"valid_from,omitempty"`  // 生效时间，为空时立即生效
+	ValidUntil *time.Time `yaml:"valid_until,omitempty"` // 失效时间，为空时长期有效
+}
+
+// csvHeader CSV格式的说明，每行第一列为记录类型，其余列按顺序对应字段
+const csvHeader = `# role,name,description
+# permission,name,resource,action,description
+# grant,role,department,tenant,domain,permission,obj,act,cond,eft
+# assignment,user,subject,role,domain,valid_from,valid_until
+`
+
+// PolicyFormat 按文件扩展名判断格式，.csv 为CSV，其余为YAML
+func PolicyFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return PolicyFormatCSV
+	}
+	return PolicyFormatYAML
+}
+
+// ParsePolicyDocument 解析策略文件
+func ParsePolicyDocument(data []byte, format string) (*PolicyDocument, error) {
+	doc := &PolicyDocument{}
+	switch format {
+	case PolicyFormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, res.ErrInvalidParam.WithMessage("策略文件格式错误: " + err.Error())
+		}
+		return doc, nil
+	case PolicyFormatCSV:
+		return parsePolicyCSV(data)
+	}
+	return nil, res.ErrInvalidParam.WithMessage("不支持的策略文件格式: " + format)
+}
+
+// EncodePolicyDocument 将策略文件编码为指定格式
+func EncodePolicyDocument(doc *PolicyDocument, format string) ([]byte, error) {
+	switch format {
+	case PolicyFormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case PolicyFormatCSV:
+		return encodePolicyCSV(doc)
+	}
+	return nil, res.ErrInvalidParam.WithMessage("不支持的策略文件格式: " + format)
+}
+
+// parsePolicyCSV 解析CSV格式，缺少的列视为空
+func parsePolicyCSV(data []byte) (*PolicyDocument, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, res.ErrInvalidParam.WithMessage("策略文件格式错误: " + err.Error())
+	}
+	doc := &PolicyDocument{}
+	for i, record := range records {
+		field := func(index int) string {
+			if index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		switch field(0) {
+		case "role":
+			doc.Roles = append(doc.Roles, PolicyRole{Name: field(1), Description: field(2)})
+		case "permission":
+			doc.Permissions = append(doc.Permissions, PolicyPermission{
+				Name:        field(1),
+				Resource:    field(2),
+				Action:      field(3),
+				Description: field(4),
+			})
+		case "grant":
+			var tenant uint64
+			if field(3) != "" {
+				if tenant, err = strconv.ParseUint(field(3), 10, 64); err != nil {
+					return nil, res.ErrInvalidParam.WithMessage("策略文件第 " + strconv.Itoa(i+1) + " 条记录的租户无效: " + field(3))
+				}
+			}
+			doc.Grants = append(doc.Grants, PolicyGrant{
+				Role:       field(1),
+				Department: field(2),
+				Tenant:     uint(tenant),
+				Domain:     field(4),
+				Permission: field(5),
+				Obj:        field(6),
+				Act:        field(7),
+				Cond:       field(8),
+				Eft:        field(9),
+			})
+		case "assignment":
+			var window [2]*time.Time
+			for j := range window {
+				if value := field(5 + j); value != "" {
+					t, err := time.Parse(time.RFC3339, value)
+					if err != nil {
+						return nil, res.ErrInvalidParam.WithMessage("策略文件第 " + strconv.Itoa(i+1) + " 条记录的有效期无效: " + value)
+					}
+					window[j] = &t
+				}
+			}
+			doc.Assignments = append(doc.Assignments, PolicyAssignment{
+				User:       field(1),
+				Subject:    field(2),
+				Role:       field(3),
+				Domain:     field(4),
+				ValidFrom:  window[0],
+				ValidUntil: window[1],
+			})
+		default:
+			return nil, res.ErrInvalidParam.WithMessage("策略文件第 " + strconv.Itoa(i+1) + " 条记录的类型未知: " + field(0))
+		}
+	}
+	return doc, nil
+}
+
+// encodePolicyCSV 编码为CSV格式，文件开头为各记录类型的字段说明
+func encodePolicyCSV(doc *PolicyDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(csvHeader)
+	writer := csv.NewWriter(&buf)
+	var records [][]string
+	for _, role := range doc.Roles {
+		records = append(records, []string{"role", role.Name, role.Description})
+	}
+	for _, permission := range doc.Permissions {
+		records = append(records, []string{"permission", permission.Name, permission.Resource, permission.Action, permission.Description})
+	}
+	for _, grant := range doc.Grants {
+		tenant := ""
+		if grant.Tenant != 0 {
+			tenant = strconv.FormatUint(uint64(grant.Tenant), 10)
+		}
+		records = append(records, []string{"grant", grant.Role, grant.Department, tenant, grant.Domain, grant.Permission, grant.Obj, grant.Act, grant.Cond, grant.Eft})
+	}
+	for _, assignment := range doc.Assignments {
+		record := []string{"assignment", assignment.User, assignment.Subject, assignment.Role, assignment.Domain}
+		// 长期有效的分配省略有效期两列
+		if assignment.ValidFrom != nil || assignment.ValidUntil != nil {
+			for _, t := range []*time.Time{assignment.ValidFrom, assignment.ValidUntil} {
+				value := ""
+				if t != nil {
+					value = t.Format(time.RFC3339)
+				}
+				record = append(record, value)
+			}
+		}
+		records = append(records, record)
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
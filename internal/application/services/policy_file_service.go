@@ -0,0 +1,659 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type PolicyFileService struct{}
+
+var PolicyFile = &PolicyFileService{}
+
+// PolicyImportResult 导入的变更，Changes 为需要增删的 p 和 g 规则，格式同策略变更预演
+type PolicyImportResult struct {
+	DryRun             bool                `json:"dry_run"`
+	Prune              bool                `json:"prune"`
+	CreatedRoles       []string            `json:"created_roles"`
+	UpdatedRoles       []string            `json:"updated_roles"`
+	DeletedRoles       []string            `json:"deleted_roles"`
+	CreatedPermissions []string            `json:"created_permissions"`
+	UpdatedPermissions []string            `json:"updated_permissions"`
+	DeletedPermissions []string            `json:"deleted_permissions"`
+	Changes            []rbac.PolicyChange `json:"changes"`
+	UpdatedAssignments [][]string          `json:"updated_assignments"` // 规则不变、只有有效期改变的角色分配
+}
+
+// policyImport 导入计划
+type policyImport struct {
+	result            *PolicyImportResult
+	createRoles       []*rbacModels.Role
+	updateRoles       []*rbacModels.Role
+	deleteRoles       []*rbacModels.Role
+	createPermissions []*rbacModels.Permission
+	updatePermissions []*rbacModels.Permission
+	deletePermissions []*rbacModels.Permission
+	rewrites          []permissionRewrite
+	policies          rbac.PolicyChange
+	roles             rbac.PolicyChange
+	windows           map[string]rbac.GrantWindow // 文件中角色分配的有效期，按规则索引
+}
+
+// permissionRewrite 权限的资源或操作变更，已授予的策略随之改写
+type permissionRewrite struct {
+	oldResource, oldAction, resource, action string
+}
+
+// Import 导入策略文件，创建或更新文件中的角色、权限、授权和角色分配，重复导入同一文件不会产生变更
+// prune 为 true 时删除文件中没有的角色和权限，以及角色和部门上未声明的策略和未声明的角色分配；
+// super_admin 角色及其策略和分配不会被删除，部门成员关系不受影响。dryRun 为 true 时只返回变更，不做修改
+func (s *PolicyFileService) Import(doc *PolicyDocument, prune, dryRun bool) (*PolicyImportResult, error) {
+	plan, err := s.plan(doc, prune)
+	if err != nil {
+		return nil, err
+	}
+	plan.result.DryRun = dryRun
+	if dryRun {
+		return plan.result, nil
+	}
+	if err := s.apply(plan); err != nil {
+		return nil, err
+	}
+	return plan.result, nil
+}
+
+// plan 校验策略文件并与当前数据比较，得到导入计划，任何错误都发生在修改之前
+func (s *PolicyFileService) plan(doc *PolicyDocument, prune bool) (*policyImport, error) {
+	plan := &policyImport{
+		result: &PolicyImportResult{
+			Prune:              prune,
+			CreatedRoles:       []string{},
+			UpdatedRoles:       []string{},
+			DeletedRoles:       []string{},
+			CreatedPermissions: []string{},
+			UpdatedPermissions: []string{},
+			DeletedPermissions: []string{},
+			UpdatedAssignments: [][]string{},
+		},
+		policies: rbac.PolicyChange{Type: rbac.PolicyRule, Add: [][]string{}, Remove: [][]string{}},
+		roles:    rbac.PolicyChange{Type: rbac.RoleRule, Add: [][]string{}, Remove: [][]string{}},
+		windows:  make(map[string]rbac.GrantWindow),
+	}
+	roleDefined, err := s.planRoles(plan, doc.Roles, prune)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := s.planPermissions(plan, doc.Permissions, prune)
+	if err != nil {
+		return nil, err
+	}
+	var tenantIDs []uint
+	if err := database.GetDB().Model(&models.Tenant{}).Pluck("id", &tenantIDs).Error; err != nil {
+		return nil, err
+	}
+	validDomain := func(dom string) bool {
+		return dom == rbac.AllDomains || slices.ContainsFunc(tenantIDs, func(id uint) bool {
+			return rbac.GetTenantDomain(id) == dom
+		})
+	}
+	if err := s.planGrants(plan, doc.Grants, prune, roleDefined, catalog, validDomain); err != nil {
+		return nil, err
+	}
+	if err := s.planAssignments(plan, doc.Assignments, prune, roleDefined, validDomain); err != nil {
+		return nil, err
+	}
+	plan.result.Changes = []rbac.PolicyChange{plan.policies, plan.roles}
+	return plan, nil
+}
+
+// planRoles 比较角色，返回导入后角色是否存在的判断函数
+func (s *PolicyFileService) planRoles(plan *policyImport, specs []PolicyRole, prune bool) (func(string) bool, error) {
+	var existing []*rbacModels.Role
+	if err := database.GetDB().Order("id").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	index := make(map[string]*rbacModels.Role, len(existing))
+	for _, role := range existing {
+		index[role.Name] = role
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, res.ErrInvalidParam.WithMessage("角色名称不能为空")
+		}
+		if err := validateRoleName(spec.Name); err != nil {
+			return nil, err
+		}
+		if declared[spec.Name] {
+			return nil, res.ErrInvalidParam.WithMessage("角色重复: " + spec.Name)
+		}
+		declared[spec.Name] = true
+		role, ok := index[spec.Name]
+		switch {
+		case !ok:
+			plan.createRoles = append(plan.createRoles, &rbacModels.Role{Name: spec.Name, Description: spec.Description})
+			plan.result.CreatedRoles = append(plan.result.CreatedRoles, spec.Name)
+		case role.Description != spec.Description:
+			role.Description = spec.Description
+			plan.updateRoles = append(plan.updateRoles, role)
+			plan.result.UpdatedRoles = append(plan.result.UpdatedRoles, spec.Name)
+		}
+	}
+	if prune {
+		for _, role := range existing {
+			if !declared[role.Name] && role.Name != rbac.SuperAdminRole {
+				plan.deleteRoles = append(plan.deleteRoles, role)
+				plan.result.DeletedRoles = append(plan.result.DeletedRoles, role.Name)
+			}
+		}
+	}
+	return func(name string) bool {
+		if declared[name] {
+			return true
+		}
+		_, ok := index[name]
+		return ok && (!prune || name == rbac.SuperAdminRole)
+	}, nil
+}
+
+// planPermissions 比较权限目录，返回导入后按名称索引的权限目录
+func (s *PolicyFileService) planPermissions(plan *policyImport, specs []PolicyPermission, prune bool) (map[string]*rbacModels.Permission, error) {
+	var existing []*rbacModels.Permission
+	if err := database.GetDB().Order("name").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	index := make(map[string]*rbacModels.Permission, len(existing))
+	catalog := make(map[string]*rbacModels.Permission, len(existing)+len(specs))
+	for _, permission := range existing {
+		index[permission.Name] = permission
+		if !prune {
+			catalog[permission.Name] = permission
+		}
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, res.ErrInvalidParam.WithMessage("权限名称不能为空")
+		}
+		if err := validatePermission(spec.Resource, spec.Action); err != nil {
+			return nil, err
+		}
+		if declared[spec.Name] {
+			return nil, res.ErrInvalidParam.WithMessage("权限重复: " + spec.Name)
+		}
+		declared[spec.Name] = true
+		permission, ok := index[spec.Name]
+		switch {
+		case !ok:
+			permission = &rbacModels.Permission{Name: spec.Name, Resource: spec.Resource, Action: spec.Action, Description: spec.Description}
+			plan.createPermissions = append(plan.createPermissions, permission)
+			plan.result.CreatedPermissions = append(plan.result.CreatedPermissions, spec.Name)
+		case permission.Resource != spec.Resource || permission.Action != spec.Action || permission.Description != spec.Description:
+			if permission.Resource != spec.Resource || permission.Action != spec.Action {
+				plan.rewrites = append(plan.rewrites, permissionRewrite{permission.Resource, permission.Action, spec.Resource, spec.Action})
+			}
+			permission.Resource = spec.Resource
+			permission.Action = spec.Action
+			permission.Description = spec.Description
+			plan.updatePermissions = append(plan.updatePermissions, permission)
+			plan.result.UpdatedPermissions = append(plan.result.UpdatedPermissions, spec.Name)
+		}
+		catalog[spec.Name] = permission
+	}
+	if prune {
+		for _, permission := range existing {
+			if !declared[permission.Name] {
+				plan.deletePermissions = append(plan.deletePermissions, permission)
+				plan.result.DeletedPermissions = append(plan.result.DeletedPermissions, permission.Name)
+			}
+		}
+	}
+	// 同一资源和操作只能对应一个命名权限
+	names := make(map[[2]string]string, len(catalog))
+	for _, permission := range catalog {
+		key := [2]string{permission.Resource, permission.Action}
+		if other, ok := names[key]; ok {
+			return nil, res.ErrInvalidParam.WithMessage(fmt.Sprintf("权限 %s 和 %s 的资源和操作相同", other, permission.Name))
+		}
+		names[key] = permission.Name
+	}
+	return catalog, nil
+}
+
+// planGrants 比较角色和部门上的策略
+func (s *PolicyFileService) planGrants(plan *policyImport, grants []PolicyGrant, prune bool, roleDefined func(string) bool, catalog map[string]*rbacModels.Permission, validDomain func(string) bool) error {
+	db := database.WithoutTenant(database.GetDB())
+	departments := make(map[[2]string]string)
+	desired := newRuleSet()
+	for i, grant := range grants {
+		invalid := func(message string) error {
+			return res.ErrInvalidParam.WithMessage(fmt.Sprintf("第 %d 条授权%s", i+1, message))
+		}
+		var sub string
+		switch {
+		case grant.Role != "" && grant.Department != "":
+			return invalid("只能指定角色或部门之一")
+		case grant.Role != "":
+			if !roleDefined(grant.Role) {
+				return invalid("的角色未定义: " + grant.Role)
+			}
+			sub = grant.Role
+		case grant.Department != "":
+			tenant := cmp.Or(grant.Tenant, models.DefaultTenantID)
+			key := [2]string{strconv.FormatUint(uint64(tenant), 10), grant.Department}
+			if _, ok := departments[key]; !ok {
+				var department rbacModels.Department
+				if err := db.Where("tenant_id = ? AND name = ?", tenant, grant.Department).First(&department).Error; err != nil {
+					return invalid("的部门不存在: " + grant.Department)
+				}
+				departments[key] = rbac.GetDepartmentSubject(department.ID)
+			}
+			sub = departments[key]
+		default:
+			return invalid("缺少角色或部门")
+		}
+		if !validDomain(grant.Domain) {
+			return invalid("的域无效: " + grant.Domain)
+		}
+		var rule []string
+		switch {
+		case grant.Permission != "" && (grant.Obj != "" || grant.Act != "" || grant.Cond != "" || grant.Eft != ""):
+			return invalid("只能指定命名权限或 obj/act 之一")
+		case grant.Permission != "":
+			permission, ok := catalog[grant.Permission]
+			if !ok {
+				return invalid("的权限未定义: " + grant.Permission)
+			}
+			rule = []string{sub, grant.Domain, permission.Resource, permission.Action, rbac.NoCondition, rbac.EffectAllow}
+		case grant.Obj != "" && grant.Act != "":
+			if err := validatePermission(grant.Obj, grant.Act); err != nil {
+				return invalid(": " + err.Error())
+			}
+			cond := cmp.Or(grant.Cond, rbac.NoCondition)
+			if err := rbac.ValidateCondition(cond); err != nil {
+				return invalid("的条件无效: " + err.Error())
+			}
+			eft := cmp.Or(grant.Eft, rbac.EffectAllow)
+			if eft != rbac.EffectAllow && eft != rbac.EffectDeny {
+				return invalid("的效果无效: " + eft)
+			}
+			rule = []string{sub, grant.Domain, grant.Obj, grant.Act, cond, eft}
+		default:
+			return invalid("缺少命名权限或 obj/act")
+		}
+		desired.add(rule)
+	}
+
+	current, err := rbac.ListRules(rbac.PolicyRule)
+	if err != nil {
+		return err
+	}
+	// 按权限目录的变更改写当前策略后再比较，与导入时的改写顺序一致
+	for _, rewrite := range plan.rewrites {
+		for i, rule := range current {
+			if rule[2] == rewrite.oldResource && rule[3] == rewrite.oldAction && rule[4] == rbac.NoCondition && rule[5] == rbac.EffectAllow {
+				current[i] = []string{rule[0], rule[1], rewrite.resource, rewrite.action, rule[4], rule[5]}
+			}
+		}
+	}
+	existing := newRuleSet()
+	for _, rule := range current {
+		existing.add(rule)
+		if prune && isPolicyFileSubject(rule[0]) && rule[0] != rbac.SuperAdminRole && !desired.contains(rule) {
+			plan.policies.Remove = append(plan.policies.Remove, rule)
+		}
+	}
+	for _, rule := range desired.rules {
+		if !existing.contains(rule) {
+			plan.policies.Add = append(plan.policies.Add, rule)
+		}
+	}
+	return nil
+}
+
+// planAssignments 比较角色分配，分配已存在但有效期不同时更新有效期
+func (s *PolicyFileService) planAssignments(plan *policyImport, assignments []PolicyAssignment, prune bool, roleDefined func(string) bool, validDomain func(string) bool) error {
+	db := database.WithoutTenant(database.GetDB())
+	users := make(map[string]*models.User)
+	desired := newRuleSet()
+	for i, assignment := range assignments {
+		invalid := func(message string) error {
+			return res.ErrInvalidParam.WithMessage(fmt.Sprintf("第 %d 条角色分配%s", i+1, message))
+		}
+		if !roleDefined(assignment.Role) {
+			return invalid("的角色未定义: " + assignment.Role)
+		}
+		if !validDomain(assignment.Domain) {
+			return invalid("的域无效: " + assignment.Domain)
+		}
+		var sub string
+		switch {
+		case assignment.User != "" && assignment.Subject != "":
+			return invalid("只能指定用户或主体之一")
+		case assignment.User != "":
+			user, ok := users[assignment.User]
+			if !ok {
+				user = &models.User{}
+				if err := db.Where("username = ?", assignment.User).First(user).Error; err != nil {
+					return invalid("的用户不存在: " + assignment.User)
+				}
+				users[assignment.User] = user
+			}
+			if assignment.Domain != rbac.AllDomains && assignment.Domain != rbac.GetTenantDomain(user.TenantID) {
+				return invalid("的用户不属于该租户: " + assignment.User)
+			}
+			sub = rbac.GetUserID(user.ID)
+		case assignment.Subject != "":
+			sub = assignment.Subject
+		default:
+			return invalid("缺少用户或主体")
+		}
+		window := rbac.GrantWindow{ValidFrom: assignment.ValidFrom, ValidUntil: assignment.ValidUntil}
+		if err := window.Validate(); err != nil {
+			return invalid("的有效期无效: " + err.Error())
+		}
+		dom := assignment.Domain
+		// super_admin 总是分配在全局域
+		if assignment.Role == rbac.SuperAdminRole {
+			dom = rbac.AllDomains
+		}
+		rule := []string{sub, assignment.Role, dom}
+		key := ruleKey(rule)
+		if previous, ok := plan.windows[key]; ok && !previous.Equal(window) {
+			return invalid("重复且有效期不同")
+		}
+		plan.windows[key] = window
+		desired.add(rule)
+	}
+
+	current, err := rbac.ListRules(rbac.RoleRule)
+	if err != nil {
+		return err
+	}
+	existing := newRuleSet()
+	for _, rule := range current {
+		existing.add(rule)
+		if prune && rule[1] != rbac.SuperAdminRole && !desired.contains(rule) {
+			plan.roles.Remove = append(plan.roles.Remove, rule)
+		}
+	}
+	windows, err := rbac.GetGrantWindows(rbac.RoleRule, desired.rules)
+	if err != nil {
+		return err
+	}
+	for i, rule := range desired.rules {
+		switch {
+		case !existing.contains(rule):
+			plan.roles.Add = append(plan.roles.Add, rule)
+		case !windows[i].Equal(plan.windows[ruleKey(rule)]):
+			plan.result.UpdatedAssignments = append(plan.result.UpdatedAssignments, rule)
+		}
+	}
+	return nil
+}
+
+// apply 执行导入计划，先在事务中写入角色和权限目录，再增删Casbin规则，最后删除多余的角色
+func (s *PolicyFileService) apply(plan *policyImport) error {
+	// 某一步已保存但通知其他实例失败时继续导入，最后返回通知错误
+	var notify rbac.NotifyErrors
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, role := range plan.createRoles {
+			if err := tx.Create(role).Error; err != nil {
+				return err
+			}
+		}
+		for _, role := range plan.updateRoles {
+			if err := tx.Model(role).Update("description", role.Description).Error; err != nil {
+				return err
+			}
+		}
+		for _, permission := range plan.createPermissions {
+			if err := tx.Create(permission).Error; err != nil {
+				return err
+			}
+		}
+		for _, permission := range plan.updatePermissions {
+			if err := tx.Save(permission).Error; err != nil {
+				return err
+			}
+		}
+		for _, permission := range plan.deletePermissions {
+			// 只删除目录，已授予的策略按文件中的授权决定是否保留
+			if err := tx.Unscoped().Delete(permission).Error; err != nil {
+				return err
+			}
+		}
+		// Casbin 规则最后改写，失败时目录的修改随事务回滚
+		for _, rewrite := range plan.rewrites {
+			if err := rbac.UpdatePermission(rewrite.oldResource, rewrite.oldAction, rewrite.resource, rewrite.action); notify.Check(err) != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(plan.policies.Remove) > 0 {
+		if _, err := rbac.RemoveRules(rbac.PolicyRule, slices.Clone(plan.policies.Remove)); notify.Check(err) != nil {
+			return err
+		}
+	}
+	if len(plan.roles.Remove) > 0 {
+		if _, err := rbac.RemoveRules(rbac.RoleRule, slices.Clone(plan.roles.Remove)); notify.Check(err) != nil {
+			return err
+		}
+	}
+	for _, rule := range plan.policies.Add {
+		if _, err := rbac.AddPolicyRule(rule[0], rule[1], rule[2], rule[3], rule[4], rule[5]); notify.Check(err) != nil {
+			return err
+		}
+	}
+	// 已存在的分配再次添加时只更新有效期
+	for _, rule := range slices.Concat(plan.roles.Add, plan.result.UpdatedAssignments) {
+		if _, err := rbac.AddRoleForUserWithWindow(rule[0], rule[1], rule[2], plan.windows[ruleKey(rule)]); notify.Check(err) != nil {
+			return err
+		}
+	}
+	for _, role := range plan.deleteRoles {
+		if err := Role.DeleteRole(role.ID); notify.Check(err) != nil {
+			return err
+		}
+	}
+	return notify.Err()
+}
+
+// Export 导出角色、权限目录、角色和部门上的策略以及角色分配
+// 直接授予用户和API密钥的策略不导出，引用已删除部门的策略被跳过；用户按用户名导出，不存在的用户保留用户ID
+func (s *PolicyFileService) Export() (*PolicyDocument, error) {
+	roles, err := Role.GetAllRoles()
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := Permission.GetAllPermissions()
+	if err != nil {
+		return nil, err
+	}
+	doc := &PolicyDocument{
+		Roles:       make([]PolicyRole, 0, len(roles)),
+		Permissions: make([]PolicyPermission, 0, len(permissions)),
+		Grants:      []PolicyGrant{},
+		Assignments: []PolicyAssignment{},
+	}
+	for _, role := range roles {
+		doc.Roles = append(doc.Roles, PolicyRole{Name: role.Name, Description: role.Description})
+	}
+	catalog := make(map[[2]string]string, len(permissions))
+	for _, permission := range permissions {
+		doc.Permissions = append(doc.Permissions, PolicyPermission{
+			Name:        permission.Name,
+			Resource:    permission.Resource,
+			Action:      permission.Action,
+			Description: permission.Description,
+		})
+		catalog[[2]string{permission.Resource, permission.Action}] = permission.Name
+	}
+	db := database.WithoutTenant(database.GetDB())
+
+	policies, err := rbac.ListRules(rbac.PolicyRule)
+	if err != nil {
+		return nil, err
+	}
+	var departmentIDs []uint
+	for _, rule := range policies {
+		if id, ok := rbac.ParseDepartmentSubject(rule[0]); ok {
+			departmentIDs = append(departmentIDs, id)
+		}
+	}
+	var departments []*rbacModels.Department
+	if len(departmentIDs) > 0 {
+		if err := db.Where("id IN ?", departmentIDs).Find(&departments).Error; err != nil {
+			return nil, err
+		}
+	}
+	departmentIndex := make(map[string]*rbacModels.Department, len(departments))
+	for _, department := range departments {
+		departmentIndex[rbac.GetDepartmentSubject(department.ID)] = department
+	}
+	for _, rule := range policies {
+		if !isPolicyFileSubject(rule[0]) {
+			continue
+		}
+		grant := PolicyGrant{Role: rule[0], Domain: rule[1]}
+		if _, ok := rbac.ParseDepartmentSubject(rule[0]); ok {
+			department, ok := departmentIndex[rule[0]]
+			if !ok {
+				continue
+			}
+			grant = PolicyGrant{Department: department.Name, Tenant: department.TenantID, Domain: rule[1]}
+		}
+		if name, ok := catalog[[2]string{rule[2], rule[3]}]; ok && rule[4] == rbac.NoCondition && rule[5] == rbac.EffectAllow {
+			grant.Permission = name
+		} else {
+			grant.Obj, grant.Act = rule[2], rule[3]
+			if rule[4] != rbac.NoCondition {
+				grant.Cond = rule[4]
+			}
+			if rule[5] != rbac.EffectAllow {
+				grant.Eft = rule[5]
+			}
+		}
+		doc.Grants = append(doc.Grants, grant)
+	}
+
+	assignments, err := rbac.ListRules(rbac.RoleRule)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []uint64
+	for _, rule := range assignments {
+		if id, err := strconv.ParseUint(rule[0], 10, 64); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	var users []*models.User
+	if len(userIDs) > 0 {
+		if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		usernames[rbac.GetUserID(user.ID)] = user.Username
+	}
+	windows, err := rbac.GetGrantWindows(rbac.RoleRule, assignments)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range assignments {
+		assignment := PolicyAssignment{Subject: rule[0], Role: rule[1], Domain: rule[2], ValidFrom: windows[i].ValidFrom, ValidUntil: windows[i].ValidUntil}
+		if username, ok := usernames[rule[0]]; ok {
+			assignment.User, assignment.Subject = username, ""
+		}
+		doc.Assignments = append(doc.Assignments, assignment)
+	}
+
+	// 只存在于Casbin规则中的角色一并导出，保证导出的文件可以重新导入
+	referenced := make([]string, 0, len(doc.Grants)+len(doc.Assignments))
+	for _, grant := range doc.Grants {
+		if grant.Role != "" {
+			referenced = append(referenced, grant.Role)
+		}
+	}
+	for _, assignment := range doc.Assignments {
+		referenced = append(referenced, assignment.Role)
+	}
+	for _, name := range referenced {
+		if !slices.ContainsFunc(doc.Roles, func(role PolicyRole) bool { return role.Name == name }) {
+			doc.Roles = append(doc.Roles, PolicyRole{Name: name})
+		}
+	}
+
+	// 排序后导出，便于比较不同环境的策略
+	slices.SortFunc(doc.Grants, func(a, b PolicyGrant) int {
+		return cmp.Or(
+			cmp.Compare(a.Role, b.Role),
+			cmp.Compare(a.Tenant, b.Tenant),
+			cmp.Compare(a.Department, b.Department),
+			cmp.Compare(a.Domain, b.Domain),
+			cmp.Compare(a.Permission, b.Permission),
+			cmp.Compare(a.Obj, b.Obj),
+			cmp.Compare(a.Act, b.Act),
+			cmp.Compare(a.Cond, b.Cond),
+			cmp.Compare(a.Eft, b.Eft),
+		)
+	})
+	slices.SortFunc(doc.Assignments, func(a, b PolicyAssignment) int {
+		return cmp.Or(
+			cmp.Compare(a.Role, b.Role),
+			cmp.Compare(a.Domain, b.Domain),
+			cmp.Compare(a.User, b.User),
+			cmp.Compare(a.Subject, b.Subject),
+		)
+	})
+	return doc, nil
+}
+
+// isPolicyFileSubject 策略文件管理的策略主体，即角色和部门
+func isPolicyFileSubject(sub string) bool {
+	if _, ok := rbac.ParseDepartmentSubject(sub); ok {
+		return true
+	}
+	return validateRoleName(sub) == nil
+}
+
+// ruleSet 保持插入顺序的规则集合
+type ruleSet struct {
+	rules [][]string
+	keys  map[string]bool
+}
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{keys: make(map[string]bool)}
+}
+
+// ruleKey 规则的索引键
+func ruleKey(rule []string) string {
+	return strings.Join(rule, "\x00")
+}
+
+func (s *ruleSet) add(rule []string) {
+	key := ruleKey(rule)
+	if !s.keys[key] {
+		s.keys[key] = true
+		s.rules = append(s.rules, rule)
+	}
+}
+
+func (s *ruleSet) contains(rule []string) bool {
+	return s.keys[ruleKey(rule)]
+}
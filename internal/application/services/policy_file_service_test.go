@@ -0,0 +1,109 @@
+package services
+
+import (
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPolicyFileAssignmentWindows(t *testing.T) {
+	setupRBAC(t)
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Password: "-", IsActive: true, TenantID: models.DefaultTenantID}
+	if err := database.WithoutTenant(database.GetDB()).Create(alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	rule := []string{rbac.GetUserID(alice.ID), "oncall", dom}
+	from := time.Now().Add(-time.Hour).Truncate(time.Second)
+	until := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	source := `
+roles:
+  - name: oncall
+assignments:
+  - user: alice
+    role: oncall
+    domain: "1"
+    valid_from: ` + from.Format(time.RFC3339) + `
+    valid_until: ` + until.Format(time.RFC3339) + `
+`
+	importYAML := func(data string) *PolicyImportResult {
+		t.Helper()
+		doc, err := ParsePolicyDocument([]byte(data), PolicyFormatYAML)
+		if err != nil {
+			t.Fatalf("ParsePolicyDocument: %v", err)
+		}
+		result, err := PolicyFile.Import(doc, false, false)
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		return result
+	}
+	window := func() rbac.GrantWindow {
+		t.Helper()
+		windows, err := rbac.GetGrantWindows(rbac.RoleRule, [][]string{rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return windows[0]
+	}
+
+	importYAML(source)
+	if got := window(); !got.Equal(rbac.GrantWindow{ValidFrom: &from, ValidUntil: &until}) {
+		t.Fatalf("imported window = %v - %v, want %v - %v", got.ValidFrom, got.ValidUntil, from, until)
+	}
+
+	// 导出的文件带有有效期，重新导入不产生变更
+	doc, err := PolicyFile.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	i := slices.IndexFunc(doc.Assignments, func(a PolicyAssignment) bool { return a.User == "alice" })
+	if i < 0 || doc.Assignments[i].ValidFrom == nil || !doc.Assignments[i].ValidUntil.Equal(until) {
+		t.Fatalf("exported assignments = %+v, want alice with the window", doc.Assignments)
+	}
+	for _, format := range []string{PolicyFormatYAML, PolicyFormatCSV} {
+		data, err := EncodePolicyDocument(doc, format)
+		if err != nil {
+			t.Fatalf("EncodePolicyDocument %s: %v", format, err)
+		}
+		parsed, err := ParsePolicyDocument(data, format)
+		if err != nil {
+			t.Fatalf("ParsePolicyDocument %s: %v", format, err)
+		}
+		result, err := PolicyFile.Import(parsed, true, true)
+		if err != nil {
+			t.Fatalf("Import %s: %v", format, err)
+		}
+		if len(result.UpdatedAssignments) != 0 || len(result.Changes[1].Add) != 0 || len(result.Changes[1].Remove) != 0 {
+			t.Fatalf("re-importing the %s export changed assignments: %+v", format, result)
+		}
+	}
+
+	// 只改变有效期时更新分配，不增删规则
+	later := until.Add(24 * time.Hour)
+	doc.Assignments[i].ValidFrom, doc.Assignments[i].ValidUntil = nil, &later
+	result, err := PolicyFile.Import(doc, false, false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(result.Changes[1].Add) != 0 || !slices.EqualFunc(result.UpdatedAssignments, [][]string{rule}, slices.Equal) {
+		t.Fatalf("window change = add %v, updated %v; want only %v updated", result.Changes[1].Add, result.UpdatedAssignments, rule)
+	}
+	if got := window(); got.ValidFrom != nil || !got.ValidUntil.Equal(later) {
+		t.Fatalf("updated window = %v - %v, want until %v", got.ValidFrom, got.ValidUntil, later)
+	}
+
+	// 不带有效期的声明改为长期有效
+	importYAML("assignments:\n  - user: alice\n    role: oncall\n    domain: \"1\"\n")
+	if !window().Permanent() {
+		t.Fatal("assignment without a window is still timed")
+	}
+
+	doc.Assignments[i].ValidUntil = &from
+	_, err = PolicyFile.Import(doc, false, true)
+	assertCode(t, err, res.ErrInvalidParam)
+}
@@ -0,0 +1,195 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/casbin/casbin/v2/util"
+	"github.com/casbin/govaluate"
+)
+
+// NoCondition 无条件策略的条件字段，p 规则的第5个字段为 * 时不做属性判断
+const NoCondition = "*"
+
+// Attributes 条件求值使用的属性
+// 条件表达式中以 sub.xxx、obj.xxx、env.xxx 引用，例如 obj.owner_id == sub.id、env.hour >= 9 && env.hour < 18
+type Attributes struct {
+	Sub map[string]any `json:"sub"` // 主体属性，如 id、tenant_id、username
+	Obj map[string]any `json:"obj"` // 资源属性，由 RegisterObjectResolver 注册的解析器提供
+	Env map[string]any `json:"env"` // 请求环境，如 ip、method、path、hour、weekday、time
+}
+
+// ObjectResolver 解析请求资源的属性，params 为路由路径参数，如 /users/:id 中的 id
+type ObjectResolver func(ctx context.Context, params map[string]string) (map[string]any, error)
+
+// SubjectResolver 解析主体的额外属性，返回值合并到 sub 中
+type SubjectResolver func(ctx context.Context, sub, dom string) (map[string]any, error)
+
+// objectResolver 按资源模式注册的解析器
+type objectResolver struct {
+	pattern  string
+	resolver ObjectResolver
+}
+
+var (
+	resolverMu       sync.RWMutex
+	objectResolvers  []objectResolver
+	subjectResolvers []SubjectResolver
+
+	// expressions 已编译的条件表达式，条件数量有限，不做淘汰
+	expressions sync.Map
+)
+
+// conditionFunctions 条件表达式中可用的函数
+var conditionFunctions = map[string]govaluate.ExpressionFunction{
+	"ipMatch":    util.IPMatchFunc,
+	"keyMatch2":  util.KeyMatch2Func,
+	"regexMatch": util.RegexMatchFunc,
+}
+
+// RegisterObjectResolver 注册资源属性解析器，pattern 为 keyMatch2 模式（如 /users/:id），与请求路径匹配的解析器依次执行，结果合并到 obj 中
+// 解析器只在存在与请求资源匹配的条件策略时调用，应在启动时注册
+func RegisterObjectResolver(pattern string, resolver ObjectResolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	objectResolvers = append(objectResolvers, objectResolver{pattern: pattern, resolver: resolver})
+}
+
+// RegisterSubjectResolver 注册主体属性解析器，只在存在与请求资源匹配的条件策略时调用，应在启动时注册
+func RegisterSubjectResolver(resolver SubjectResolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	subjectResolvers = append(subjectResolvers, resolver)
+}
+
+// ResolveAttributes 为请求补全条件求值需要的属性
+// attrs 中已有调用方提供的基础属性；只有域中存在与 obj 匹配的条件策略时才执行注册的解析器，避免每个请求都查询资源
+func ResolveAttributes(ctx context.Context, sub, dom, obj string, params map[string]string, attrs Attributes) (Attributes, error) {
+	conditional, err := hasConditions(dom, obj)
+	if err != nil || !conditional {
+		return attrs, err
+	}
+	resolverMu.RLock()
+	objects := objectResolvers
+	subjects := subjectResolvers
+	resolverMu.RUnlock()
+
+	if attrs.Sub == nil {
+		attrs.Sub = map[string]any{}
+	}
+	if attrs.Obj == nil {
+		attrs.Obj = map[string]any{}
+	}
+	for _, resolver := range subjects {
+		values, err := resolver(ctx, sub, dom)
+		if err != nil {
+			return attrs, err
+		}
+		for key, value := range values {
+			attrs.Sub[key] = value
+		}
+	}
+	for _, object := range objects {
+		if !util.KeyMatch2(obj, object.pattern) {
+			continue
+		}
+		values, err := object.resolver(ctx, params)
+		if err != nil {
+			return attrs, err
+		}
+		for key, value := range values {
+			attrs.Obj[key] = value
+		}
+	}
+	return attrs, nil
+}
+
+// ValidateCondition 校验条件表达式能够编译，* 表示无条件
+func ValidateCondition(cond string) error {
+	if cond == NoCondition {
+		return nil
+	}
+	_, err := compileCondition(cond)
+	return err
+}
+
+// hasConditions 域中是否存在资源与 obj 匹配的条件策略
+func hasConditions(dom, obj string) (bool, error) {
+	rules, err := rbacService.enforcer.GetPolicy()
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range rules {
+		if rule[4] == NoCondition || (rule[1] != dom && rule[1] != AllDomains) {
+			continue
+		}
+		if rule[2] == "*" || util.KeyMatch2(obj, rule[2]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compileCondition 编译并缓存条件表达式
+func compileCondition(cond string) (*govaluate.EvaluableExpression, error) {
+	if expression, ok := expressions.Load(cond); ok {
+		return expression.(*govaluate.EvaluableExpression), nil
+	}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(cond, conditionFunctions)
+	if err != nil {
+		return nil, fmt.Errorf("无效的条件 %q: %w", cond, err)
+	}
+	expressions.Store(cond, expression)
+	return expression, nil
+}
+
+// conditionFunc 匹配器中的 condition(p.cond, r.attrs, p.eft)
+// 条件缺少属性或求值出错时按失败关闭处理：允许策略视为不满足，拒绝策略视为满足
+func conditionFunc(args ...any) (any, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("condition: 需要3个参数，实际为 %d", len(args))
+	}
+	cond, _ := args[0].(string)
+	if cond == NoCondition {
+		return true, nil
+	}
+	attrs, _ := args[1].(Attributes)
+	failed := args[2] == EffectDeny
+	expression, err := compileCondition(cond)
+	if err != nil {
+		return failed, nil
+	}
+	result, err := expression.Evaluate(map[string]any{
+		"sub": normalize(attrs.Sub),
+		"obj": normalize(attrs.Obj),
+		"env": normalize(attrs.Env),
+	})
+	if err != nil {
+		return failed, nil
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return failed, nil
+	}
+	return matched, nil
+}
+
+// normalize 将整数属性转为 float64，使其能与表达式中的数字字面量比较
+func normalize(values map[string]any) map[string]any {
+	normalized := make(map[string]any, len(values))
+	for key, value := range values {
+		switch v := reflect.ValueOf(value); v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			normalized[key] = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			normalized[key] = float64(v.Uint())
+		case reflect.Float32:
+			normalized[key] = v.Float()
+		default:
+			normalized[key] = value
+		}
+	}
+	return normalized
+}
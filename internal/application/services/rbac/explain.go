@@ -0,0 +1,243 @@
+package rbac
+
+import (
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"strings"
+
+	casbin2 "github.com/casbin/casbin/v2"
+)
+
+// Explanation 权限校验的结果及依据
+type Explanation struct {
+	Allowed    bool     `json:"allowed"`
+	SuperAdmin bool     `json:"super_admin"` // 作为超级管理员放行，不受拒绝策略限制
+	Rule       []string `json:"rule"`        // 决定结果的策略：拒绝时为命中的拒绝策略，允许时为命中的允许策略，没有策略匹配时为空
+	Chain      []string `json:"chain"`       // 主体经角色或部门到策略主体的继承链，如 ["5", "dept:3", "dept:1"]
+}
+
+// Request 一次权限校验请求
+type Request struct {
+	Sub   string     `json:"sub" binding:"required"`
+	Obj   string     `json:"obj" binding:"required"`
+	Act   string     `json:"act" binding:"required"`
+	Attrs Attributes `json:"attrs"`
+}
+
+// PolicyChange 待评估的规则变更，Type 为 p、g 或 g2，规则格式同 RemoveRules
+type PolicyChange struct {
+	Type   string     `json:"type" binding:"required,oneof=p g g2"`
+	Add    [][]string `json:"add"`
+	Remove [][]string `json:"remove"`
+}
+
+// Decision 变更前后同一请求的校验结果
+type Decision struct {
+	Request Request      `json:"request"`
+	Before  *Explanation `json:"before"`
+	After   *Explanation `json:"after"`
+	Flipped bool         `json:"flipped"` // 变更后结果是否改变
+}
+
+// Explain 校验权限并说明依据
+func Explain(sub, dom, obj, act string, attrs Attributes) (*Explanation, error) {
+	return explain(rbacService.enforcer, sub, dom, obj, act, attrs)
+}
+
+// DryRun 在当前策略的副本上应用变更，返回请求在变更前后的校验结果，不修改实际策略
+func DryRun(dom string, changes []PolicyChange, requests []Request) ([]Decision, error) {
+	e := rbacService.enforcer
+	e.GetLock().RLock()
+	m := e.GetModel().Copy()
+	e.GetLock().RUnlock()
+	shadow, err := casbin2.NewSyncedEnforcer(m)
+	if err != nil {
+		return nil, err
+	}
+	configureEnforcer(shadow)
+	if err := shadow.BuildRoleLinks(); err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if err := applyChange(shadow, change); err != nil {
+			return nil, err
+		}
+	}
+	decisions := make([]Decision, 0, len(requests))
+	for _, request := range requests {
+		before, err := Explain(request.Sub, dom, request.Obj, request.Act, request.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		after, err := explain(shadow, request.Sub, dom, request.Obj, request.Act, request.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, Decision{
+			Request: request,
+			Before:  before,
+			After:   after,
+			Flipped: before.Allowed != after.Allowed,
+		})
+	}
+	return decisions, nil
+}
+
+// applyChange 在影子执行器上删除和添加规则
+func applyChange(e *casbin2.SyncedEnforcer, change PolicyChange) error {
+	size, err := ruleSize(change.Type)
+	if err != nil {
+		return err
+	}
+	normalized := func(rules [][]string) ([][]string, error) {
+		result := make([][]string, 0, len(rules))
+		for _, rule := range rules {
+			if change.Type == PolicyRule {
+				rule = completePolicy(rule)
+			}
+			if len(rule) != size {
+				return nil, res.ErrInvalidParam.WithMessage("规则字段数量错误: " + strings.Join(rule, ", "))
+			}
+			if change.Type == PolicyRule {
+				if err := ValidateCondition(rule[4]); err != nil {
+					return nil, res.ErrInvalidParam.WithMessage(err.Error())
+				}
+				if rule[5] != EffectAllow && rule[5] != EffectDeny {
+					return nil, res.ErrInvalidParam.WithMessage("无效的策略效果: " + rule[5])
+				}
+			}
+			result = append(result, rule)
+		}
+		return result, nil
+	}
+	removed, err := normalized(change.Remove)
+	if err != nil {
+		return err
+	}
+	added, err := normalized(change.Add)
+	if err != nil {
+		return err
+	}
+	// 批量操作遇到已存在或不存在的规则会整体失败，这里逐条执行
+	for _, rule := range removed {
+		if change.Type == PolicyRule {
+			_, err = e.RemoveNamedPolicy(change.Type, rule)
+		} else {
+			_, err = e.RemoveNamedGroupingPolicy(change.Type, rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, rule := range added {
+		if change.Type == PolicyRule {
+			_, err = e.AddNamedPolicy(change.Type, rule)
+		} else {
+			_, err = e.AddNamedGroupingPolicy(change.Type, rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// explain 用指定执行器校验并说明依据
+// 超级管理员在匹配器中与任意允许策略匹配，命中的策略没有意义，改为给出到 super_admin 的继承链
+func explain(e *casbin2.SyncedEnforcer, sub, dom, obj, act string, attrs Attributes) (*Explanation, error) {
+	if err := syncGrantLinks(e); err != nil {
+		return nil, err
+	}
+	superChain, err := inheritanceChain(e, sub, AllDomains, SuperAdminRole)
+	if err != nil {
+		return nil, err
+	}
+	allowed, rule, err := e.EnforceEx(sub, dom, obj, act, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if superChain != nil && allowed {
+		return &Explanation{Allowed: true, SuperAdmin: true, Rule: []string{}, Chain: superChain}, nil
+	}
+	explanation := &Explanation{Allowed: allowed, Rule: []string{}, Chain: []string{}}
+	if len(rule) == 0 {
+		return explanation, nil
+	}
+	explanation.Rule = rule
+	chain, err := inheritanceChain(e, sub, dom, rule[0])
+	if err != nil {
+		return nil, err
+	}
+	if chain != nil {
+		explanation.Chain = chain
+	}
+	return explanation, nil
+}
+
+// inheritanceChain 按广度优先查找主体经角色（g，限域中和全局域）和部门（g2）到 target 的最短继承链，不可达时返回 nil
+func inheritanceChain(e *casbin2.SyncedEnforcer, sub, dom, target string) ([]string, error) {
+	if sub == target {
+		return []string{sub}, nil
+	}
+	previous := map[string]string{sub: ""}
+	queue := []string{sub}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		parents, err := inheritedSubjects(e, node, dom)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			if _, seen := previous[parent]; seen {
+				continue
+			}
+			previous[parent] = node
+			if parent == target {
+				chain := []string{parent}
+				for current := node; current != ""; current = previous[current] {
+					chain = append(chain, current)
+				}
+				slices.Reverse(chain)
+				return chain, nil
+			}
+			queue = append(queue, parent)
+		}
+	}
+	return nil, nil
+}
+
+// inheritedSubjects 主体在域中直接继承的角色和所属的部门，不包含不在有效期内的分配
+func inheritedSubjects(e *casbin2.SyncedEnforcer, sub, dom string) ([]string, error) {
+	roles, err := e.GetFilteredNamedGroupingPolicy(RoleRule, 0, sub)
+	if err != nil {
+		return nil, err
+	}
+	departments, err := e.GetFilteredNamedGroupingPolicy(DepartmentRule, 0, sub)
+	if err != nil {
+		return nil, err
+	}
+	parents := make([]string, 0, len(roles)+len(departments))
+	for _, rule := range roles {
+		if rule[2] != dom && rule[2] != AllDomains {
+			continue
+		}
+		active, err := grantActive(RoleRule, rule)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			parents = append(parents, rule[1])
+		}
+	}
+	for _, rule := range departments {
+		active, err := grantActive(DepartmentRule, rule)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			parents = append(parents, rule[1])
+		}
+	}
+	return parents, nil
+}
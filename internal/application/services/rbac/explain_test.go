@@ -0,0 +1,140 @@
+package rbac
+
+import (
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"slices"
+	"testing"
+)
+
+// setupChain 用户 2 属于部门 child，child 的上级部门 parent 在域 1 中可以读取报表
+// 用户 2 在全局域中拥有 editor 角色，editor 继承 base，base 在域 1 中可以读取文章；用户 1 是超级管理员
+func setupChain(t *testing.T) (child, parent string) {
+	t.Helper()
+	setupEnforcer(t, SuperAdminRole, "editor", "base")
+	departments := []rbacModels.Department{{Name: "IT"}, {Name: "IT/Backend"}}
+	if err := database.WithoutTenant(database.GetDB()).Create(&departments).Error; err != nil {
+		t.Fatal(err)
+	}
+	parent, child = GetDepartmentSubject(departments[0].ID), GetDepartmentSubject(departments[1].ID)
+	if err := SetDepartmentParent(child, parent); err != nil {
+		t.Fatalf("SetDepartmentParent: %v", err)
+	}
+	must := mustAdd(t)
+	must(AddDepartmentForUser("2", child))
+	must(AddPolicy(parent, "1", "/reports/*", "GET"))
+	must(AddRoleForUser("2", "editor", AllDomains))
+	must(AddRoleForUser("editor", "base", AllDomains))
+	must(AddPolicy("base", "1", "/articles/*", "GET"))
+	must(AddRoleForUser("1", SuperAdminRole, AllDomains))
+	return child, parent
+}
+
+func TestExplainInheritanceChain(t *testing.T) {
+	child, parent := setupChain(t)
+
+	cases := []struct {
+		name, obj string
+		rule      []string
+		chain     []string
+	}{
+		{"through the department tree", "/reports/1",
+			[]string{parent, "1", "/reports/*", "GET", NoCondition, EffectAllow}, []string{"2", child, parent}},
+		{"through global domain roles", "/articles/1",
+			[]string{"base", "1", "/articles/*", "GET", NoCondition, EffectAllow}, []string{"2", "editor", "base"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Explain("2", "1", tc.obj, "GET", Attributes{})
+			if err != nil {
+				t.Fatalf("Explain: %v", err)
+			}
+			if !got.Allowed || got.SuperAdmin || !slices.Equal(got.Rule, tc.rule) || !slices.Equal(got.Chain, tc.chain) {
+				t.Fatalf("Explain = %+v, want allowed by %v through %v", got, tc.rule, tc.chain)
+			}
+		})
+	}
+
+	// 策略只在域 1 中，其他域中没有依据
+	if got, err := Explain("2", "2", "/articles/1", "GET", Attributes{}); err != nil || got.Allowed || len(got.Rule) != 0 || len(got.Chain) != 0 {
+		t.Fatalf("Explain in domain 2 = %+v, %v; want denied without a rule", got, err)
+	}
+
+	got, err := Explain("1", "1", "/anything", "DELETE", Attributes{})
+	if err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	if !got.Allowed || !got.SuperAdmin || !slices.Equal(got.Chain, []string{"1", SuperAdminRole}) {
+		t.Fatalf("super admin Explain = %+v, want allowed through %s", got, SuperAdminRole)
+	}
+}
+
+func TestDryRunDoesNotChangePolicy(t *testing.T) {
+	child, parent := setupChain(t)
+	policies, _ := rbacService.enforcer.GetPolicy()
+	groupings, _ := rbacService.enforcer.GetNamedGroupingPolicy(DepartmentRule)
+
+	deny := []string{parent, "1", "/reports/secret", "GET", NoCondition, EffectDeny}
+	changes := []PolicyChange{
+		{Type: PolicyRule, Add: [][]string{deny}},
+		{Type: DepartmentRule, Add: [][]string{{"3", child}}},
+	}
+	requests := []Request{
+		{Sub: "2", Obj: "/reports/secret", Act: "GET"},
+		{Sub: "2", Obj: "/reports/1", Act: "GET"},
+		{Sub: "3", Obj: "/reports/1", Act: "GET"},
+	}
+	decisions, err := DryRun("1", changes, requests)
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+	if len(decisions) != len(requests) {
+		t.Fatalf("DryRun returned %d decisions, want %d", len(decisions), len(requests))
+	}
+
+	// 拒绝策略使原本允许的请求被拒绝，依据为新增的拒绝策略
+	secret := decisions[0]
+	if !secret.Before.Allowed || secret.After.Allowed || !secret.Flipped {
+		t.Fatalf("secret = before %v after %v flipped %v, want allowed then denied", secret.Before.Allowed, secret.After.Allowed, secret.Flipped)
+	}
+	if !slices.Equal(secret.After.Rule, deny) || !slices.Equal(secret.After.Chain, []string{"2", child, parent}) {
+		t.Fatalf("secret after = %+v, want denied by %v through the department tree", secret.After, deny)
+	}
+	if decisions[1].Flipped || !decisions[1].After.Allowed {
+		t.Fatalf("unrelated request = %+v, want still allowed", decisions[1])
+	}
+	// 新成员经部门继承获得权限
+	member := decisions[2]
+	if member.Before.Allowed || !member.After.Allowed || !member.Flipped {
+		t.Fatalf("new member = before %v after %v, want denied then allowed", member.Before.Allowed, member.After.Allowed)
+	}
+	if !slices.Equal(member.After.Chain, []string{"3", child, parent}) {
+		t.Fatalf("new member chain = %v", member.After.Chain)
+	}
+
+	// 实际策略没有改变
+	if after, _ := rbacService.enforcer.GetPolicy(); !slices.EqualFunc(after, policies, slices.Equal) {
+		t.Fatalf("policies after DryRun = %v, want %v", after, policies)
+	}
+	if after, _ := rbacService.enforcer.GetNamedGroupingPolicy(DepartmentRule); !slices.EqualFunc(after, groupings, slices.Equal) {
+		t.Fatalf("departments after DryRun = %v, want %v", after, groupings)
+	}
+	if ok, _ := Enforce("2", "1", "/reports/secret", "GET"); !ok {
+		t.Fatal("live policy denies after DryRun")
+	}
+	if ok, _ := Enforce("3", "1", "/reports/1", "GET"); ok {
+		t.Fatal("live policy allows a member added only in DryRun")
+	}
+
+	// 删除部门关系使经部门继承的权限失效
+	decisions, err = DryRun("1", []PolicyChange{{Type: DepartmentRule, Remove: [][]string{{child, parent}}}}, requests[1:2])
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+	if after := decisions[0].After; after.Allowed || len(after.Chain) != 0 {
+		t.Fatalf("after removing the hierarchy = %+v, want denied without a chain", after)
+	}
+	if _, err := DryRun("1", []PolicyChange{{Type: PolicyRule, Add: [][]string{{"editor", "1", "/x", "GET", NoCondition, "maybe"}}}}, requests); err == nil {
+		t.Fatal("DryRun accepted an invalid effect")
+	}
+}
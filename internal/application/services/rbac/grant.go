@@ -0,0 +1,501 @@
+package rbac
+
+import (
+	"errors"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"slices"
+	"sync"
+	"time"
+
+	casbin2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	casbinRBAC "github.com/casbin/casbin/v2/rbac"
+	"gorm.io/gorm"
+)
+
+// maxHierarchyLevel 角色继承的最大层数，与默认角色管理器一致
+const maxHierarchyLevel = 10
+
+// GrantWindow 角色或部门分配的有效期，时间为空表示不限
+type GrantWindow struct {
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// Permanent 是否为长期有效的分配
+func (w GrantWindow) Permanent() bool {
+	return w.ValidFrom == nil && w.ValidUntil == nil
+}
+
+// ActiveAt 分配在指定时间是否生效，有效期包含开始时间、不包含结束时间
+func (w GrantWindow) ActiveAt(t time.Time) bool {
+	return (w.ValidFrom == nil || !t.Before(*w.ValidFrom)) && (w.ValidUntil == nil || t.Before(*w.ValidUntil))
+}
+
+// Equal 两个有效期是否相同
+func (w GrantWindow) Equal(other GrantWindow) bool {
+	same := func(a, b *time.Time) bool {
+		return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+	}
+	return same(w.ValidFrom, other.ValidFrom) && same(w.ValidUntil, other.ValidUntil)
+}
+
+// Validate 结束时间必须晚于开始时间和当前时间
+func (w GrantWindow) Validate() error {
+	if w.ValidUntil == nil {
+		return nil
+	}
+	if w.ValidFrom != nil && !w.ValidUntil.After(*w.ValidFrom) {
+		return res.ErrInvalidParam.WithMessage("有效期的结束时间必须晚于开始时间")
+	}
+	if !w.ValidUntil.After(time.Now()) {
+		return res.ErrInvalidParam.WithMessage("有效期的结束时间必须晚于当前时间")
+	}
+	return nil
+}
+
+// grantKey 一条 g 或 g2 规则对应的分配关系，部门分配的域为空
+type grantKey struct {
+	ptype, sub, target, dom string
+}
+
+// ruleGrantKey 规则对应的分配关系
+func ruleGrantKey(ptype string, rule []string) grantKey {
+	key := grantKey{ptype: ptype, sub: rule[0], target: rule[1]}
+	if ptype == RoleRule && len(rule) > 2 {
+		key.dom = rule[2]
+	}
+	return key
+}
+
+// grantWindows 有时限分配的有效期缓存，所有执行器共用
+// 分配关系或有效期变化后标记为过期，下次校验时从数据库重新加载，其他实例的变更经策略同步到达后同样会触发重新加载
+var grantWindows = struct {
+	sync.Mutex
+	windows map[grantKey]GrantWindow
+	stale   bool
+	version int // 每次重新加载后加一
+}{stale: true}
+
+// invalidateGrantWindows 标记有效期缓存过期
+func invalidateGrantWindows() {
+	grantWindows.Lock()
+	defer grantWindows.Unlock()
+	grantWindows.stale = true
+}
+
+// loadGrantWindows 获取全部有时限分配的有效期，缓存过期时从数据库重新加载
+func loadGrantWindows() (map[grantKey]GrantWindow, error) {
+	windows, _, err := loadGrantWindowsVersion()
+	return windows, err
+}
+
+// loadGrantWindowsVersion 获取全部有时限分配的有效期及缓存的版本
+func loadGrantWindowsVersion() (map[grantKey]GrantWindow, int, error) {
+	grantWindows.Lock()
+	defer grantWindows.Unlock()
+	if !grantWindows.stale {
+		return grantWindows.windows, grantWindows.version, nil
+	}
+	var grants []rbacModels.TimedGrant
+	if err := database.GetDB().Find(&grants).Error; err != nil {
+		return nil, 0, err
+	}
+	windows := make(map[grantKey]GrantWindow, len(grants))
+	for _, grant := range grants {
+		key := grantKey{ptype: grant.Ptype, sub: grant.Subject, target: grant.Target, dom: grant.Domain}
+		windows[key] = GrantWindow{ValidFrom: grant.ValidFrom, ValidUntil: grant.ValidUntil}
+	}
+	grantWindows.windows, grantWindows.stale = windows, false
+	grantWindows.version++
+	return windows, grantWindows.version, nil
+}
+
+// nextGrantChange 当前时间之后最早的生效或失效时间，没有时为零值
+func nextGrantChange(windows map[grantKey]GrantWindow, now time.Time) time.Time {
+	var next time.Time
+	for _, window := range windows {
+		for _, t := range []*time.Time{window.ValidFrom, window.ValidUntil} {
+			if t != nil && t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = *t
+			}
+		}
+	}
+	return next
+}
+
+// syncGrantLinks 校验前调用，有效期变化或到达某个分配的生效、失效时间后清除执行器缓存的匹配器
+// 执行器编译匹配器时会缓存其中 g()、g2() 的结果，只在规则变化时清除，不会随时间变化
+func syncGrantLinks(e *casbin2.SyncedEnforcer) error {
+	rm, ok := e.GetNamedRoleManager(RoleRule).(*grantRoleManager)
+	if !ok {
+		return nil
+	}
+	windows, version, err := loadGrantWindowsVersion()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	rm.mu.Lock()
+	changed := rm.version != version || (!rm.next.IsZero() && !now.Before(rm.next))
+	if changed {
+		rm.version, rm.next = version, nextGrantChange(windows, now)
+	}
+	rm.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	// 增量构建会清除执行器缓存的匹配器，没有规则时不改变角色关系；同步执行器没有为其加锁
+	e.GetLock().Lock()
+	defer e.GetLock().Unlock()
+	return e.BuildIncrementalRoleLinks(model.PolicyAdd, RoleRule, nil)
+}
+
+// saveGrantWindow 保存分配的有效期，长期有效时删除记录
+func saveGrantWindow(key grantKey, window GrantWindow) error {
+	query := database.GetDB().Where(map[string]any{"ptype": key.ptype, "subject": key.sub, "target": key.target, "domain": key.dom})
+	if window.Permanent() {
+		if err := query.Delete(&rbacModels.TimedGrant{}).Error; err != nil {
+			return err
+		}
+	} else {
+		var grant rbacModels.TimedGrant
+		if err := query.Assign(map[string]any{"valid_from": window.ValidFrom, "valid_until": window.ValidUntil}).FirstOrCreate(&grant).Error; err != nil {
+			return err
+		}
+	}
+	invalidateGrantWindows()
+	return nil
+}
+
+// addGrant 保存有效期并添加 g 或 g2 规则
+// 规则已存在时只更新有效期，此时没有规则变更可以同步，改为通知其他实例重新加载
+func addGrant(ptype string, rule []string, window GrantWindow) (bool, error) {
+	if err := window.Validate(); err != nil {
+		return false, err
+	}
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return false, err
+	}
+	key := ruleGrantKey(ptype, rule)
+	previous := windows[key]
+	if err := saveGrantWindow(key, window); err != nil {
+		return false, err
+	}
+	var notify NotifyErrors
+	added, err := rbacService.enforcer.AddNamedGroupingPolicy(ptype, rule)
+	if notify.Check(err) != nil {
+		// 规则没有保存，恢复原来的有效期
+		return false, errors.Join(err, saveGrantWindow(key, previous))
+	}
+	if added {
+		return true, notify.Err()
+	}
+	if rbacService.watcher != nil {
+		return false, rbacService.watcher.Update()
+	}
+	return false, nil
+}
+
+// removeGrant 删除 g 或 g2 规则及其有效期
+func removeGrant(ptype string, rule []string) (bool, error) {
+	var notify NotifyErrors
+	removed, err := rbacService.enforcer.RemoveNamedGroupingPolicy(ptype, rule)
+	if notify.Check(err) != nil {
+		return false, err
+	}
+	if err := saveGrantWindow(ruleGrantKey(ptype, rule), GrantWindow{}); err != nil {
+		return removed, err
+	}
+	return removed, notify.Err()
+}
+
+// grantColumns g、g2 规则各字段在有效期记录中对应的列
+var grantColumns = []string{"subject", "target", "domain"}
+
+// removeGrants 批量删除 g 或 g2 规则及其有效期，规则没有全部删除时不改变有效期
+func removeGrants(ptype string, rules [][]string) (bool, error) {
+	var notify NotifyErrors
+	removed, err := rbacService.enforcer.RemoveNamedGroupingPolicies(ptype, rules)
+	if notify.Check(err) != nil || !removed {
+		return false, err
+	}
+	for _, rule := range rules {
+		if err := saveGrantWindow(ruleGrantKey(ptype, rule), GrantWindow{}); err != nil {
+			return removed, err
+		}
+	}
+	return removed, notify.Err()
+}
+
+// removeFilteredGrants 按字段删除 g 或 g2 规则及其有效期，参数同 RemoveFilteredNamedGroupingPolicy，空值匹配任意值
+func removeFilteredGrants(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
+	var notify NotifyErrors
+	removed, err := rbacService.enforcer.RemoveFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
+	if notify.Check(err) != nil {
+		return false, err
+	}
+	// 规则不在执行器中时同样删除有效期，清理残留的记录
+	query := database.GetDB().Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		if value != "" {
+			query = query.Where(grantColumns[fieldIndex+i]+" = ?", value)
+		}
+	}
+	if err := query.Delete(&rbacModels.TimedGrant{}).Error; err != nil {
+		return removed, err
+	}
+	invalidateGrantWindows()
+	return removed, notify.Err()
+}
+
+// GetGrantWindows 获取 g 或 g2 规则的有效期，与 rules 一一对应，长期有效的规则两个时间均为空
+func GetGrantWindows(ptype string, rules [][]string) ([]GrantWindow, error) {
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]GrantWindow, len(rules))
+	for i, rule := range rules {
+		result[i] = windows[ruleGrantKey(ptype, rule)]
+	}
+	return result, nil
+}
+
+// grantActive 规则对应的分配当前是否生效
+func grantActive(ptype string, rule []string) (bool, error) {
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return false, err
+	}
+	window, ok := windows[ruleGrantKey(ptype, rule)]
+	return !ok || window.ActiveAt(time.Now()), nil
+}
+
+// renameGrantWindows 重命名角色或部门主体时同步改写有效期记录
+func renameGrantWindows(ptype, oldName, newName string) error {
+	db := database.GetDB().Model(&rbacModels.TimedGrant{}).Where("ptype = ?", ptype)
+	for _, column := range []string{"subject", "target"} {
+		if err := db.Session(&gorm.Session{}).Where(column+" = ?", oldName).Update(column, newName).Error; err != nil {
+			return err
+		}
+	}
+	invalidateGrantWindows()
+	return nil
+}
+
+// SweepExpiredGrants 删除已过期的分配及其 g、g2 规则，返回删除的数量
+func SweepExpiredGrants() (int, error) {
+	var grants []rbacModels.TimedGrant
+	if err := database.GetDB().Where("valid_until <= ?", time.Now()).Find(&grants).Error; err != nil {
+		return 0, err
+	}
+	e := rbacService.enforcer
+	var notify NotifyErrors
+	count := 0
+	for _, grant := range grants {
+		rule := []string{grant.Subject, grant.Target}
+		if grant.Ptype == RoleRule {
+			rule = append(rule, grant.Domain)
+		}
+		// 逐条删除，规则可能已被其他实例或其他操作删除
+		removed, err := e.RemoveNamedGroupingPolicy(grant.Ptype, rule)
+		if notify.Check(err) != nil {
+			return count, err
+		}
+		if removed {
+			count++
+		}
+		if err := database.GetDB().Delete(&grant).Error; err != nil {
+			return count, err
+		}
+	}
+	if len(grants) > 0 {
+		invalidateGrantWindows()
+	}
+	return count, notify.Err()
+}
+
+// StartGrantSweeper 按周期在后台清理过期的分配，周期为 0 时不启动
+// 过期的分配在校验时已不生效，清理只是让规则列表与实际权限保持一致
+func StartGrantSweeper(interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := SweepExpiredGrants(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// grantRoleManager 在默认角色管理器之上按有效期过滤直接分配的角色或部门，不在有效期内的分配在校验和查询角色时均不生效
+// 角色之间的继承和部门的上下级关系没有有效期，照常生效
+type grantRoleManager struct {
+	casbinRBAC.RoleManager
+	ptype string
+	mu    sync.RWMutex
+	links map[grantKey]struct{} // 当前加载的规则，用于判断角色来自域中的分配还是全局域中的分配
+
+	// 执行器的匹配器缓存所对应的有效期版本和下一次生效或失效的时间，只在 g 的角色管理器上记录，见 syncGrantLinks
+	version int
+	next    time.Time
+}
+
+// newGrantRoleManager 包装默认角色管理器
+func newGrantRoleManager(ptype string, rm casbinRBAC.RoleManager) *grantRoleManager {
+	return &grantRoleManager{RoleManager: rm, ptype: ptype, links: map[grantKey]struct{}{}}
+}
+
+// linkKey 角色管理器中的一条关系对应的分配
+func (rm *grantRoleManager) linkKey(name1, name2 string, domain []string) grantKey {
+	return ruleGrantKey(rm.ptype, append([]string{name1, name2}, domain...))
+}
+
+func (rm *grantRoleManager) Clear() error {
+	rm.mu.Lock()
+	rm.links = map[grantKey]struct{}{}
+	rm.mu.Unlock()
+	invalidateGrantWindows()
+	return rm.RoleManager.Clear()
+}
+
+func (rm *grantRoleManager) AddLink(name1, name2 string, domain ...string) error {
+	if err := rm.RoleManager.AddLink(name1, name2, domain...); err != nil {
+		return err
+	}
+	rm.mu.Lock()
+	rm.links[rm.linkKey(name1, name2, domain)] = struct{}{}
+	rm.mu.Unlock()
+	// 其他实例新增的分配可能带有有效期
+	invalidateGrantWindows()
+	return nil
+}
+
+func (rm *grantRoleManager) DeleteLink(name1, name2 string, domain ...string) error {
+	if err := rm.RoleManager.DeleteLink(name1, name2, domain...); err != nil {
+		return err
+	}
+	rm.mu.Lock()
+	delete(rm.links, rm.linkKey(name1, name2, domain))
+	rm.mu.Unlock()
+	return nil
+}
+
+func (rm *grantRoleManager) DeleteDomain(domain string) error {
+	rm.mu.Lock()
+	for key := range rm.links {
+		if key.dom == domain {
+			delete(rm.links, key)
+		}
+	}
+	rm.mu.Unlock()
+	return rm.RoleManager.DeleteDomain(domain)
+}
+
+// HasLink name1 是否直接或间接继承 name2，只沿生效的分配查找
+func (rm *grantRoleManager) HasLink(name1, name2 string, domain ...string) (bool, error) {
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return false, err
+	}
+	if len(windows) == 0 || name1 == name2 {
+		return rm.RoleManager.HasLink(name1, name2, domain...)
+	}
+	roles, err := rm.implicitRoles(windows, name1, domain)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(roles, name2), nil
+}
+
+// GetRoles 获取生效的直接角色
+func (rm *grantRoleManager) GetRoles(name string, domain ...string) ([]string, error) {
+	roles, err := rm.RoleManager.GetRoles(name, domain...)
+	if err != nil {
+		return nil, err
+	}
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return roles, nil
+	}
+	now := time.Now()
+	return slices.DeleteFunc(roles, func(role string) bool {
+		return !rm.active(windows, name, role, domain, now)
+	}), nil
+}
+
+// GetImplicitRoles 获取生效的直接和继承的角色
+func (rm *grantRoleManager) GetImplicitRoles(name string, domain ...string) ([]string, error) {
+	windows, err := loadGrantWindows()
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return rm.RoleManager.GetImplicitRoles(name, domain...)
+	}
+	return rm.implicitRoles(windows, name, domain)
+}
+
+// implicitRoles 按层查找继承的角色，跳过不在有效期内的分配
+func (rm *grantRoleManager) implicitRoles(windows map[grantKey]GrantWindow, name string, domain []string) ([]string, error) {
+	now := time.Now()
+	var roles []string
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for level := 0; level < maxHierarchyLevel && len(queue) > 0; level++ {
+		var next []string
+		for _, current := range queue {
+			direct, err := rm.RoleManager.GetRoles(current, domain...)
+			if err != nil {
+				return nil, err
+			}
+			for _, role := range direct {
+				if visited[role] || !rm.active(windows, current, role, domain, now) {
+					continue
+				}
+				visited[role] = true
+				roles = append(roles, role)
+				next = append(next, role)
+			}
+		}
+		queue = next
+	}
+	return roles, nil
+}
+
+// active name 到 role 的直接分配当前是否生效
+// 域中的分配和全局域中的分配都会出现在域中，任一生效即可；找不到对应的分配时视为生效
+func (rm *grantRoleManager) active(windows map[grantKey]GrantWindow, name, role string, domain []string, now time.Time) bool {
+	domains := []string{""}
+	if len(domain) > 0 {
+		domains = []string{domain[0]}
+		if domain[0] != AllDomains {
+			domains = append(domains, AllDomains)
+		}
+	}
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	found := false
+	for _, dom := range domains {
+		key := grantKey{ptype: rm.ptype, sub: name, target: role, dom: dom}
+		if _, ok := rm.links[key]; !ok {
+			continue
+		}
+		found = true
+		if window, ok := windows[key]; !ok || window.ActiveAt(now) {
+			return true
+		}
+	}
+	return !found
+}
@@ -0,0 +1,132 @@
+package rbac
+
+import (
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"slices"
+	"testing"
+	"time"
+)
+
+// timedGrantKeys 数据库中全部有效期记录，格式为 ptype:subject:target:domain
+func timedGrantKeys(t *testing.T) []string {
+	t.Helper()
+	var grants []rbacModels.TimedGrant
+	if err := database.GetDB().Find(&grants).Error; err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		keys = append(keys, grant.Ptype+":"+grant.Subject+":"+grant.Target+":"+grant.Domain)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// setupTimedGrants 用户 2、3 在域 1、2 中拥有有时限的 editor 角色，并有时限地属于部门 d1，d1 有时限地属于 d2
+func setupTimedGrants(t *testing.T) (d1, d2 string) {
+	t.Helper()
+	setupEnforcer(t, "editor")
+	departments := []rbacModels.Department{{Name: "D1"}, {Name: "D2"}}
+	if err := database.WithoutTenant(database.GetDB()).Create(&departments).Error; err != nil {
+		t.Fatal(err)
+	}
+	d1, d2 = GetDepartmentSubject(departments[0].ID), GetDepartmentSubject(departments[1].ID)
+	until := time.Now().Add(time.Hour)
+	window := GrantWindow{ValidUntil: &until}
+	must := mustAdd(t)
+	must(AddRoleForUserWithWindow("2", "editor", "1", window))
+	must(AddRoleForUserWithWindow("2", "editor", "2", window))
+	must(AddRoleForUserWithWindow("3", "editor", "1", window))
+	must(AddDepartmentForUserWithWindow("2", d1, window))
+	must(AddDepartmentForUserWithWindow("3", d1, window))
+	must(AddDepartmentForUserWithWindow(d1, d2, window))
+	return d1, d2
+}
+
+func TestRemovingGrantsDeletesWindows(t *testing.T) {
+	cases := []struct {
+		name    string
+		remove  func(d1, d2 string) error
+		removed func(d1, d2 string) []string
+	}{
+		{"RemoveRules g", func(d1, d2 string) error {
+			_, err := RemoveRules(RoleRule, [][]string{{"2", "editor", "1"}})
+			return err
+		}, func(d1, d2 string) []string { return []string{"g:2:editor:1"} }},
+		{"RemoveRules g2", func(d1, d2 string) error {
+			_, err := RemoveRules(DepartmentRule, [][]string{{"2", d1}, {"3", d1}})
+			return err
+		}, func(d1, d2 string) []string { return []string{"g2:2:" + d1 + ":", "g2:3:" + d1 + ":"} }},
+		{"DeleteRole", func(d1, d2 string) error { return DeleteRole("editor") },
+			func(d1, d2 string) []string { return []string{"g:2:editor:1", "g:2:editor:2", "g:3:editor:1"} }},
+		{"DeleteDepartment", func(d1, d2 string) error { return DeleteDepartment(d1) },
+			func(d1, d2 string) []string {
+				return []string{"g2:2:" + d1 + ":", "g2:3:" + d1 + ":", "g2:" + d1 + ":" + d2 + ":"}
+			}},
+		{"SetDepartmentParent", func(d1, d2 string) error { return SetDepartmentParent(d1, "") },
+			func(d1, d2 string) []string { return []string{"g2:" + d1 + ":" + d2 + ":"} }},
+		{"DeleteSubject", func(d1, d2 string) error { return DeleteSubject("2") },
+			func(d1, d2 string) []string { return []string{"g2:2:" + d1 + ":", "g:2:editor:1", "g:2:editor:2"} }},
+		{"DeleteSubjectInDomain", func(d1, d2 string) error { return DeleteSubjectInDomain("2", "1") },
+			func(d1, d2 string) []string { return []string{"g:2:editor:1"} }},
+		{"DeleteDomain", func(d1, d2 string) error { return DeleteDomain("1") },
+			func(d1, d2 string) []string { return []string{"g:2:editor:1", "g:3:editor:1"} }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d1, d2 := setupTimedGrants(t)
+			before := timedGrantKeys(t)
+			if len(before) != 6 {
+				t.Fatalf("timed grants = %v, want 6", before)
+			}
+			if err := tc.remove(d1, d2); err != nil {
+				t.Fatalf("remove: %v", err)
+			}
+			removed := tc.removed(d1, d2)
+			want := slices.DeleteFunc(before, func(key string) bool { return slices.Contains(removed, key) })
+			if got := timedGrantKeys(t); !slices.Equal(got, want) {
+				t.Fatalf("timed grants after removal = %v, want %v", got, want)
+			}
+			// 重新分配的规则不会沿用残留的有效期
+			windows, err := GetGrantWindows(RoleRule, [][]string{{"2", "editor", "1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Contains(removed, "g:2:editor:1") && !windows[0].Permanent() {
+				t.Fatalf("window of the removed grant = %+v, want none", windows[0])
+			}
+		})
+	}
+}
+
+func TestAddGrantRollsBackWindowOnFailure(t *testing.T) {
+	setupEnforcer(t, "editor")
+	old := time.Now().Add(time.Hour).Truncate(time.Second)
+	// 规则不存在但残留了有效期记录
+	if err := database.GetDB().Create(&rbacModels.TimedGrant{Ptype: RoleRule, Subject: "2", Target: "editor", Domain: "1", ValidUntil: &old}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.GetDB().Migrator().DropTable("casbin_rule"); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(2 * time.Hour)
+	window := GrantWindow{ValidUntil: &until}
+	if added, err := AddRoleForUserWithWindow("2", "editor", "1", window); err == nil || added {
+		t.Fatalf("AddRoleForUserWithWindow = %v, %v; want an adapter error", added, err)
+	}
+	if added, err := AddRoleForUserWithWindow("3", "editor", "1", window); err == nil || added {
+		t.Fatalf("AddRoleForUserWithWindow = %v, %v; want an adapter error", added, err)
+	}
+	if got := timedGrantKeys(t); !slices.Equal(got, []string{"g:2:editor:1"}) {
+		t.Fatalf("timed grants = %v, want only the previous record", got)
+	}
+	windows, err := GetGrantWindows(RoleRule, [][]string{{"2", "editor", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := windows[0]; got.ValidFrom != nil || got.ValidUntil == nil || !got.ValidUntil.Equal(old) {
+		t.Fatalf("window = %+v, want the previous window until %v", got, old)
+	}
+}
@@ -1,110 +1,434 @@
 package rbac
 
 import (
+	"context"
+	"fmt"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
 	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 
 	casbin2 "github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"gorm.io/gorm"
+)
+
+// SuperAdminRole 超级管理员角色，在匹配器中直接引用，不能重命名或删除
+const SuperAdminRole = "super_admin"
+
+// 权限管理接口所需的专用权限，通过 Enforce(sub, dom, ManageResource, ManageAction) 校验
+const (
+	ManageResource = "/rbac"
+	ManageAction   = "manage"
+)
+
+// departmentSubjectPrefix 部门主体前缀，部门主体为 dept:<id>
+const departmentSubjectPrefix = "dept:"
+
+// AllDomains 全局域，该域中的策略和角色分配在所有租户中生效，super_admin 总是分配在全局域
+const AllDomains = "*"
+
+// 策略效果，对应 p 规则的 eft 字段
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// 规则类型，对应模型中的 p、g、g2
+const (
+	PolicyRule     = "p"  // 权限策略 sub, dom, obj, act, cond, eft
+	RoleRule       = "g"  // 主体-角色 user, role, dom
+	DepartmentRule = "g2" // 主体-部门 user, department
 )
 
 type RBACService struct {
-	enforcer *casbin2.Enforcer
+	enforcer *casbin2.SyncedEnforcer // 校验与策略修改、其他实例变更的增量应用互斥
+	watcher  *PolicyWatcher          // 启用策略同步时的监听器
 }
 
 var rbacService *RBACService
 
+// InitRBAC 初始化Casbin
+// 域(dom)为租户ID，角色分配和策略都属于某个租户域或全局域 *；部门关系 g2 不区分域
+// 策略的 cond 为基于属性的条件，* 表示无条件，其余按请求的 attrs 求值，见 condition.go
+// 策略的 eft 为 allow 或 deny，至少一条允许策略匹配且没有拒绝策略匹配时才放行
+// super_admin 有意不受拒绝策略限制：匹配器中超级管理员只与允许策略匹配，即使同时拥有其他角色也不会命中拒绝策略，
+// 迁移时为其添加的 *, *, * 允许策略保证总能命中
 func InitRBAC() error {
+	db := database.GetDB()
+	a, err := gormadapter.NewAdapterByDB(db)
+	if err != nil {
+		return err
+	}
+	// 旧格式的规则无法按新模型加载，必须在加载前迁移
+	if err := migrateDomains(db); err != nil {
+		return err
+	}
+	if err := migrateConditions(db); err != nil {
+		return err
+	}
+	if err := migrateEffects(db); err != nil {
+		return err
+	}
+	e, err := newEnforcer(a)
+	if err != nil {
+		return err
+	}
+	rbacService = &RBACService{enforcer: e}
+	return nil
+}
+
+// newEnforcer 按权限模型创建执行器并从 a 加载全部策略
+func newEnforcer(a persist.Adapter) (*casbin2.SyncedEnforcer, error) {
 	text := `
 [request_definition]
-r = sub, obj, act
+r = sub, dom, obj, act, attrs
 
 [policy_definition]
-p = sub, obj, act
+p = sub, dom, obj, act, cond, eft
 
 [role_definition]
-g = _, _
+g = _, _, _
 g2 = _, _
 
 [policy_effect]
-e = some(where (p.eft == allow))
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
 
 [matchers]
-m = r.sub == "super_admin" || g(r.sub, p.sub) || g2(r.sub, p.sub) || r.sub == p.sub && r.obj == p.obj && r.act == p.act
+m = g(r.sub, "super_admin", "*") && p.eft == "allow" || !g(r.sub, "super_admin", "*") && (g(r.sub, p.sub, r.dom) || g2(r.sub, p.sub)) && (p.dom == "*" || p.dom == r.dom) && (p.obj == "*" || keyMatch2(r.obj, p.obj)) && (p.act == "*" || actionMatch(r.act, p.act)) && condition(p.cond, r.attrs, p.eft)
 `
 	m, err := model.NewModelFromString(text)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	db := database.GetDB()
-	a, err := gormadapter.NewAdapterByDB(db)
+	e, err := casbin2.NewSyncedEnforcer(m, a)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	e, err := casbin2.NewEnforcer(m, a)
-	if err != nil {
+	configureEnforcer(e)
+	if err := e.LoadPolicy(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// configureEnforcer 注册匹配器使用的域匹配和自定义函数
+func configureEnforcer(e *casbin2.SyncedEnforcer) {
+	// 角色和部门的分配可以带有效期，不在有效期内的分配不生效，见 grant.go
+	for _, ptype := range []string{RoleRule, DepartmentRule} {
+		e.SetNamedRoleManager(ptype, newGrantRoleManager(ptype, e.GetNamedRoleManager(ptype)))
+	}
+	// 全局域 * 中的角色分配在所有租户域中生效
+	e.AddNamedDomainMatchingFunc(RoleRule, "keyMatch", util.KeyMatch)
+	e.AddFunction("condition", conditionFunc)
+	e.AddFunction("actionMatch", actionMatchFunc)
+}
+
+// ActionMatch 操作是否匹配策略中的操作正则，正则按整个操作匹配，GET 不会匹配 XGETX
+func ActionMatch(action, pattern string) bool {
+	ok, err := regexp.MatchString("^(?:"+pattern+")$", action)
+	return err == nil && ok
+}
+
+// actionMatchFunc 匹配器中使用的 actionMatch 函数
+func actionMatchFunc(args ...any) (any, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("actionMatch: 需要2个参数，实际为 %d", len(args))
+	}
+	action, _ := args[0].(string)
+	pattern, _ := args[1].(string)
+	return ActionMatch(action, pattern), nil
+}
+
+func GetRBAC() *RBACService {
+	return rbacService
+}
+
+// migrateDomains 将引入租户域之前的规则迁移为带域的格式
+// 策略和角色之间的继承放入全局域，保持原有效果；用户和API密钥的角色分配放入默认租户
+func migrateDomains(db *gorm.DB) error {
+	rules := db.Model(&gormadapter.CasbinRule{})
+	if err := rules.Session(&gorm.Session{}).Where("ptype = ? AND v3 = ''", PolicyRule).
+		Updates(map[string]any{"v1": AllDomains, "v2": gorm.Expr("v1"), "v3": gorm.Expr("v2")}).Error; err != nil {
 		return err
 	}
-	if err := e.LoadPolicy(); err != nil {
+	// 用户主体为纯数字，逐条判断以免依赖数据库的正则语法
+	var legacy []gormadapter.CasbinRule
+	if err := rules.Session(&gorm.Session{}).Where("ptype = ? AND v2 = ''", RoleRule).Find(&legacy).Error; err != nil {
 		return err
 	}
-	rbacService = &RBACService{enforcer: e}
+	for _, rule := range legacy {
+		dom := AllDomains
+		if _, err := strconv.ParseUint(rule.V0, 10, 64); (err == nil || strings.HasPrefix(rule.V0, "apikey:")) && rule.V1 != SuperAdminRole {
+			dom = GetTenantDomain(models.DefaultTenantID)
+		}
+		if err := rules.Session(&gorm.Session{}).Where("id = ?", rule.ID).Update("v2", dom).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func GetRBAC() *RBACService {
-	return rbacService
+// migrateConditions 为引入条件字段之前的策略补上无条件标记 *
+// 适配器加载时会去掉末尾的空字段，空条件的策略无法按新模型加载
+func migrateConditions(db *gorm.DB) error {
+	return db.Model(&gormadapter.CasbinRule{}).Where("ptype = ? AND v4 = ''", PolicyRule).Update("v4", NoCondition).Error
 }
 
-func AddPolicy(sub, obj, act string) (bool, error) {
-	return rbacService.enforcer.AddPolicy(sub, obj, act)
+// migrateEffects 为引入效果字段之前的策略补上 allow
+func migrateEffects(db *gorm.DB) error {
+	return db.Model(&gormadapter.CasbinRule{}).Where("ptype = ? AND v5 = ''", PolicyRule).Update("v5", EffectAllow).Error
 }
 
-func AddRoleForUser(user, role string) (bool, error) {
-	return rbacService.enforcer.AddGroupingPolicy(user, role)
+// GetTenantDomain 租户在Casbin中的域
+func GetTenantDomain(tenantID uint) string {
+	return strconv.FormatUint(uint64(tenantID), 10)
 }
 
-func DeleteRoleForUser(user, role string) (bool, error) {
-	return rbacService.enforcer.RemoveGroupingPolicy(user, role)
+func AddPolicy(sub, dom, obj, act string) (bool, error) {
+	return rbacService.enforcer.AddPolicy(sub, dom, obj, act, NoCondition, EffectAllow)
 }
 
-func GetRolesForUser(user string) ([]string, error) {
-	return rbacService.enforcer.GetRolesForUser(user)
+// AddPolicyRule 添加带条件和效果的策略，cond 为 * 表示无条件，eft 为 allow 或 deny
+func AddPolicyRule(sub, dom, obj, act, cond, eft string) (bool, error) {
+	if err := ValidateCondition(cond); err != nil {
+		return false, res.ErrInvalidParam.WithMessage(err.Error())
+	}
+	if eft != EffectAllow && eft != EffectDeny {
+		return false, res.ErrInvalidParam.WithMessage("无效的策略效果: " + eft)
+	}
+	return rbacService.enforcer.AddPolicy(sub, dom, obj, act, cond, eft)
 }
 
+// AddRoleForUser 在域中为主体分配长期有效的角色，角色必须已在角色表中定义，已有的有效期会被清除
+func AddRoleForUser(user, role, dom string) (bool, error) {
+	return AddRoleForUserWithWindow(user, role, dom, GrantWindow{})
+}
+
+// AddRoleForUserWithWindow 在域中为主体分配角色，角色只在有效期内生效，过期后由 SweepExpiredGrants 删除
+// 分配已存在时更新其有效期，返回 false
+func AddRoleForUserWithWindow(user, role, dom string, window GrantWindow) (bool, error) {
+	exists, err := RoleExists(role)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, res.ErrRoleNotFound.WithMessage("角色不存在: " + role)
+	}
+	return addGrant(RoleRule, []string{user, role, roleDomain(role, dom)}, window)
+}
+
+func DeleteRoleForUser(user, role, dom string) (bool, error) {
+	return removeGrant(RoleRule, []string{user, role, roleDomain(role, dom)})
+}
+
+// GetRolesForUser 获取主体在域中直接拥有的角色，包含全局域中的分配
+func GetRolesForUser(user, dom string) ([]string, error) {
+	return rbacService.enforcer.GetRolesForUser(user, dom)
+}
+
+// GetImplicitRolesForUser 获取主体在域中直接和继承的角色，不包含部门
+func GetImplicitRolesForUser(user, dom string) ([]string, error) {
+	return implicitRoles(RoleRule, user, dom)
+}
+
+// implicitRoles 同步执行器没有为 GetNamedImplicitRolesForUser 加锁，这里持有读锁
+func implicitRoles(ptype, user string, domain ...string) ([]string, error) {
+	e := rbacService.enforcer
+	e.GetLock().RLock()
+	defer e.GetLock().RUnlock()
+	return e.GetNamedImplicitRolesForUser(ptype, user, domain...)
+}
+
+// roleDomain super_admin 在匹配器中按全局域校验，总是分配在全局域
+func roleDomain(role, dom string) string {
+	if role == SuperAdminRole {
+		return AllDomains
+	}
+	return dom
+}
+
+// AddDepartmentForUser 将主体长期加入部门，department 为 GetDepartmentSubject 生成的部门主体，部门必须存在
 func AddDepartmentForUser(user, department string) (bool, error) {
-	return rbacService.enforcer.AddNamedGroupingPolicy("g2", user, department)
+	return AddDepartmentForUserWithWindow(user, department, GrantWindow{})
+}
+
+// AddDepartmentForUserWithWindow 将主体加入部门，成员关系只在有效期内生效，分配已存在时更新其有效期
+func AddDepartmentForUserWithWindow(user, department string, window GrantWindow) (bool, error) {
+	id, ok := ParseDepartmentSubject(department)
+	if !ok {
+		return false, res.ErrInvalidParam.WithMessage("无效的部门主体: " + department)
+	}
+	var count int64
+	// 部门主体全局唯一，部门所属的租户由调用方校验
+	if err := database.WithoutTenant(database.GetDB()).Model(&rbacModels.Department{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, res.ErrNotFound.WithMessage("部门不存在")
+	}
+	return addGrant(DepartmentRule, []string{user, department}, window)
 }
 
 func DeleteDepartmentForUser(user, department string) (bool, error) {
-	return rbacService.enforcer.RemoveNamedGroupingPolicy("g2", user, department)
+	return removeGrant(DepartmentRule, []string{user, department})
+}
+
+// GetImplicitDepartmentsForUser 获取主体所属的部门及其全部上级部门
+func GetImplicitDepartmentsForUser(user string) ([]string, error) {
+	return implicitRoles(DepartmentRule, user)
+}
+
+// SetDepartmentParent 设置部门的上级部门，parent 为空时移除上级关系
+// 部门之间的关系与成员关系同在 g2 中，下级部门作为上级部门的成员继承其权限
+func SetDepartmentParent(department, parent string) error {
+	e := rbacService.enforcer
+	var notify NotifyErrors
+	if _, err := removeFilteredGrants(DepartmentRule, 0, department); notify.Check(err) != nil {
+		return err
+	}
+	if parent != "" {
+		if _, err := e.AddNamedGroupingPolicy(DepartmentRule, department, parent); notify.Check(err) != nil {
+			return err
+		}
+	}
+	return notify.Err()
+}
+
+// ReplaceDepartmentSubject 将 g2 规则中的旧部门主体替换为新主体，用于迁移旧数据
+func ReplaceDepartmentSubject(oldSub, newSub string) error {
+	return renameGrouping(DepartmentRule, oldSub, newSub)
+}
+
+// DeleteDepartment 删除部门的全部成员关系、上下级关系和权限策略
+func DeleteDepartment(department string) error {
+	e := rbacService.enforcer
+	var notify NotifyErrors
+	for _, index := range []int{0, 1} {
+		if _, err := removeFilteredGrants(DepartmentRule, index, department); notify.Check(err) != nil {
+			return err
+		}
+	}
+	if _, err := e.RemoveFilteredPolicy(0, department); notify.Check(err) != nil {
+		return err
+	}
+	return notify.Err()
 }
 
+// GetDepartmentsForUser 获取主体直接所属的部门主体
 func GetDepartmentsForUser(user string) ([]string, error) {
-	policies, err := rbacService.enforcer.GetGroupingPolicy()
+	rules, err := rbacService.enforcer.GetFilteredNamedGroupingPolicy(DepartmentRule, 0, user)
 	if err != nil {
 		return nil, err
 	}
-	var departments []string
-	for _, policy := range policies {
-		if len(policy) >= 2 && policy[0] == user {
-			departments = append(departments, policy[1])
-		}
+	departments := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		departments = append(departments, rule[1])
 	}
 	return departments, nil
 }
 
-func AddPermissionForRole(role, resource, action string) (bool, error) {
-	return rbacService.enforcer.AddPolicy(role, resource, action)
+func AddPermissionForRole(role, dom, resource, action string) (bool, error) {
+	return rbacService.enforcer.AddPolicy(role, dom, resource, action, NoCondition, EffectAllow)
+}
+
+func AddPermissionForDepartment(department, dom, resource, action string) (bool, error) {
+	return rbacService.enforcer.AddPolicy(department, dom, resource, action, NoCondition, EffectAllow)
 }
 
-func AddPermissionForDepartment(department, resource, action string) (bool, error) {
-	return rbacService.enforcer.AddPolicy(department, resource, action)
+// RemovePermissionForSubject 移除主体在域中的一条无条件允许策略
+func RemovePermissionForSubject(sub, dom, resource, action string) (bool, error) {
+	return rbacService.enforcer.RemovePolicy(sub, dom, resource, action, NoCondition, EffectAllow)
 }
 
-func Enforce(sub, obj, act string) (bool, error) {
-	return rbacService.enforcer.Enforce(sub, obj, act)
+// RemovePolicyRule 移除主体在域中的一条策略，字段含义同 AddPolicyRule
+func RemovePolicyRule(sub, dom, obj, act, cond, eft string) (bool, error) {
+	return rbacService.enforcer.RemovePolicy(sub, dom, obj, act, cond, eft)
+}
+
+// GetPermissionsForSubject 获取直接授予主体、在域中生效的权限策略，包含全局域中的策略
+func GetPermissionsForSubject(sub, dom string) ([][]string, error) {
+	rules, err := rbacService.enforcer.GetFilteredPolicy(0, sub)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(rules, func(rule []string) bool {
+		return rule[1] != dom && rule[1] != AllDomains
+	}), nil
+}
+
+// GetAllPermissionsForSubject 获取直接授予主体的全部权限策略，不区分域
+func GetAllPermissionsForSubject(sub string) ([][]string, error) {
+	return rbacService.enforcer.GetFilteredPolicy(0, sub)
+}
+
+// UpdatePermission 将所有主体在所有域中无条件的 (oldResource, oldAction) 允许策略改写为新的资源和操作
+func UpdatePermission(oldResource, oldAction, resource, action string) error {
+	rules, err := rbacService.enforcer.GetFilteredPolicy(2, oldResource, oldAction, NoCondition, EffectAllow)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	updated := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		rule = slices.Clone(rule)
+		rule[2], rule[3] = resource, action
+		updated = append(updated, rule)
+	}
+	_, err = rbacService.enforcer.UpdatePolicies(rules, updated)
+	return err
+}
+
+// RemovePermission 从所有主体上移除无条件的 (resource, action) 允许策略
+func RemovePermission(resource, action string) error {
+	_, err := rbacService.enforcer.RemoveFilteredPolicy(2, resource, action, NoCondition, EffectAllow)
+	return err
+}
+
+// GetDepartmentSubject 部门在Casbin中的主体，使用部门ID以免重命名后失效
+func GetDepartmentSubject(departmentID uint) string {
+	return departmentSubjectPrefix + strconv.FormatUint(uint64(departmentID), 10)
+}
+
+// ParseDepartmentSubject 解析部门主体中的部门ID
+func ParseDepartmentSubject(sub string) (uint, bool) {
+	value, ok := strings.CutPrefix(sub, departmentSubjectPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetDepartmentSubjectByName 按部门名称获取部门主体，部门名称在租户内唯一，按 ctx 中的租户查找
+func GetDepartmentSubjectByName(ctx context.Context, name string) (string, error) {
+	var department rbacModels.Department
+	if err := database.GetDB().WithContext(ctx).Where("name = ?", name).First(&department).Error; err != nil {
+		return "", res.ErrNotFound.WithMessage("部门不存在: " + name)
+	}
+	return GetDepartmentSubject(department.ID), nil
+}
+
+// Enforce 不带属性校验权限，条件策略均不生效
+func Enforce(sub, dom, obj, act string) (bool, error) {
+	return EnforceWithAttributes(sub, dom, obj, act, Attributes{})
+}
+
+// EnforceWithAttributes 按请求属性校验权限，条件策略在条件满足时生效
+func EnforceWithAttributes(sub, dom, obj, act string, attrs Attributes) (bool, error) {
+	if err := syncGrantLinks(rbacService.enforcer); err != nil {
+		return false, err
+	}
+	return rbacService.enforcer.Enforce(sub, dom, obj, act, attrs)
 }
 
 func LoadPolicy() error {
@@ -115,6 +439,324 @@ func SavePolicy() error {
 	return rbacService.enforcer.SavePolicy()
 }
 
+// GetGroupingPolicy 获取全部域中的用户-角色分组规则
+func GetGroupingPolicy() ([][]string, error) {
+	return rbacService.enforcer.GetGroupingPolicy()
+}
+
+// IsSuperAdmin 主体是否在全局域中直接或间接拥有超级管理员角色
+func IsSuperAdmin(sub string) (bool, error) {
+	if sub == SuperAdminRole {
+		return true, nil
+	}
+	roles, err := GetImplicitRolesForUser(sub, AllDomains)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(roles, SuperAdminRole), nil
+}
+
+// GetImplicitPermissionsForSubject 获取主体自身、所属角色（含继承）和所属部门（含上级部门）在域中生效的全部权限策略
+func GetImplicitPermissionsForSubject(sub, dom string) ([][]string, error) {
+	roles, err := GetImplicitRolesForUser(sub, dom)
+	if err != nil {
+		return nil, err
+	}
+	departments, err := GetImplicitDepartmentsForUser(sub)
+	if err != nil {
+		return nil, err
+	}
+	var permissions [][]string
+	for _, subject := range slices.Concat([]string{sub}, roles, departments) {
+		rules, err := GetPermissionsForSubject(subject, dom)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, rules...)
+	}
+	return permissions, nil
+}
+
+// ListRules 按类型列出规则，fieldValues 依次过滤各个字段，空字符串表示不过滤
+func ListRules(ptype string, fieldValues ...string) ([][]string, error) {
+	if _, err := ruleSize(ptype); err != nil {
+		return nil, err
+	}
+	e := rbacService.enforcer
+	if ptype == PolicyRule {
+		return e.GetFilteredNamedPolicy(ptype, 0, fieldValues...)
+	}
+	return e.GetFilteredNamedGroupingPolicy(ptype, 0, fieldValues...)
+}
+
+// RemoveRules 批量删除同一类型的规则，返回是否有规则被删除
+// 省略条件和效果字段的 p 规则视为无条件的允许策略
+func RemoveRules(ptype string, rules [][]string) (bool, error) {
+	size, err := ruleSize(ptype)
+	if err != nil {
+		return false, err
+	}
+	for i, rule := range rules {
+		if ptype == PolicyRule {
+			rule = completePolicy(rule)
+			rules[i] = rule
+		}
+		if len(rule) != size {
+			return false, res.ErrInvalidParam.WithMessage("规则字段数量错误: " + strings.Join(rule, ", "))
+		}
+	}
+	e := rbacService.enforcer
+	if ptype == PolicyRule {
+		return e.RemoveNamedPolicies(ptype, rules)
+	}
+	return removeGrants(ptype, rules)
+}
+
+// GetUsersForRole 获取在域中直接拥有角色的主体，dom 为全局域时返回所有域中的主体
+func GetUsersForRole(role, dom string) ([]string, error) {
+	filter := []string{role}
+	if dom != AllDomains {
+		filter = append(filter, dom)
+	}
+	rules, err := rbacService.enforcer.GetFilteredGroupingPolicy(1, filter...)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if !slices.Contains(users, rule[0]) {
+			users = append(users, rule[0])
+		}
+	}
+	return users, nil
+}
+
+// DeleteDomain 删除租户域中的全部策略和角色分配
+func DeleteDomain(dom string) error {
+	var notify NotifyErrors
+	if _, err := rbacService.enforcer.RemoveFilteredPolicy(1, dom); notify.Check(err) != nil {
+		return err
+	}
+	if _, err := removeFilteredGrants(RoleRule, 2, dom); notify.Check(err) != nil {
+		return err
+	}
+	return notify.Err()
+}
+
+// GetUsersForDepartment 获取直接属于部门的主体，不包含下级部门
+func GetUsersForDepartment(department string) ([]string, error) {
+	rules, err := rbacService.enforcer.GetFilteredNamedGroupingPolicy(DepartmentRule, 1, department)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		// 下级部门与成员同在 g2 中
+		if _, ok := ParseDepartmentSubject(rule[0]); !ok {
+			users = append(users, rule[0])
+		}
+	}
+	return users, nil
+}
+
+// RuleDomain 规则所在的域，p 规则为第2个字段，g 规则为第3个字段，g2 规则不区分域
+func RuleDomain(ptype string, rule []string) (string, bool) {
+	switch {
+	case ptype == PolicyRule && len(rule) > 1:
+		return rule[1], true
+	case ptype == RoleRule && len(rule) > 2:
+		return rule[2], true
+	}
+	return "", false
+}
+
+// RulesDomains 逐条返回规则所在的域，g2 规则取其中部门所属的租户域
+// 成员关系的部门一端和上下级关系的两端都是部门，部门不存在或两端属于不同租户时返回空字符串
+func RulesDomains(ptype string, rules [][]string) ([]string, error) {
+	domains := make([]string, len(rules))
+	if ptype != DepartmentRule {
+		for i, rule := range rules {
+			domains[i], _ = RuleDomain(ptype, rule)
+		}
+		return domains, nil
+	}
+	var ids []uint
+	for _, rule := range rules {
+		for _, sub := range rule {
+			if id, ok := ParseDepartmentSubject(sub); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	tenants := make(map[uint]uint, len(ids))
+	if len(ids) > 0 {
+		var departments []rbacModels.Department
+		if err := database.WithoutTenant(database.GetDB()).Select("id", "tenant_id").Find(&departments, ids).Error; err != nil {
+			return nil, err
+		}
+		for _, department := range departments {
+			tenants[department.ID] = department.TenantID
+		}
+	}
+	for i, rule := range rules {
+		var dom string
+		for _, sub := range rule {
+			id, ok := ParseDepartmentSubject(sub)
+			if !ok {
+				continue
+			}
+			tenantID, ok := tenants[id]
+			if !ok || dom != "" && dom != GetTenantDomain(tenantID) {
+				dom = ""
+				break
+			}
+			dom = GetTenantDomain(tenantID)
+		}
+		domains[i] = dom
+	}
+	return domains, nil
+}
+
+// FilterRulesByDomain 只保留在域中生效的规则，即属于该域或全局域的规则，dom 为全局域时不过滤
+func FilterRulesByDomain(ptype, dom string, rules [][]string) ([][]string, error) {
+	if dom == AllDomains {
+		return rules, nil
+	}
+	domains, err := RulesDomains(ptype, rules)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([][]string, 0, len(rules))
+	for i, rule := range rules {
+		if domains[i] == dom || domains[i] == AllDomains {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered, nil
+}
+
+// completePolicy 为省略了 cond 或 eft 的 p 规则补上默认值 * 和 allow
+func completePolicy(rule []string) []string {
+	switch len(rule) {
+	case 4:
+		return append(slices.Clone(rule), NoCondition, EffectAllow)
+	case 5:
+		return append(slices.Clone(rule), EffectAllow)
+	}
+	return rule
+}
+
+// ruleSize 规则类型对应的字段数量
+func ruleSize(ptype string) (int, error) {
+	switch ptype {
+	case PolicyRule:
+		return 6, nil
+	case RoleRule:
+		return 3, nil
+	case DepartmentRule:
+		return 2, nil
+	}
+	return 0, res.ErrInvalidParam.WithMessage("未知的规则类型: " + ptype)
+}
+
+// RoleExists 角色是否已在角色表中定义
+func RoleExists(role string) (bool, error) {
+	var count int64
+	if err := database.GetDB().Model(&rbacModels.Role{}).Where("name = ?", role).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RenameRole 重命名角色，改写引用该角色的全部分组规则和权限策略
+func RenameRole(oldName, newName string) error {
+	var notify NotifyErrors
+	if err := renameGrouping(RoleRule, oldName, newName); notify.Check(err) != nil {
+		return err
+	}
+	rules, err := rbacService.enforcer.GetFilteredPolicy(0, oldName)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		if _, err := rbacService.enforcer.UpdatePolicies(rules, replaceField(rules, 0, newName)); notify.Check(err) != nil {
+			return err
+		}
+	}
+	return notify.Err()
+}
+
+// renameGrouping 改写指定分组类型中两端引用该名称的规则
+func renameGrouping(ptype, oldName, newName string) error {
+	e := rbacService.enforcer
+	var notify NotifyErrors
+	for _, index := range []int{0, 1} {
+		rules, err := e.GetFilteredNamedGroupingPolicy(ptype, index, oldName)
+		if err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		if _, err := e.UpdateNamedGroupingPolicies(ptype, rules, replaceField(rules, index, newName)); notify.Check(err) != nil {
+			return err
+		}
+	}
+	if err := renameGrantWindows(ptype, oldName, newName); err != nil {
+		return err
+	}
+	return notify.Err()
+}
+
+// replaceField 复制规则并替换指定字段
+func replaceField(rules [][]string, index int, value string) [][]string {
+	replaced := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		rule = slices.Clone(rule)
+		rule[index] = value
+		replaced = append(replaced, rule)
+	}
+	return replaced
+}
+
+// DeleteRole 删除角色的全部分配关系、继承关系和权限策略
+func DeleteRole(role string) error {
+	e := rbacService.enforcer
+	var notify NotifyErrors
+	for _, index := range []int{0, 1} {
+		if _, err := removeFilteredGrants(RoleRule, index, role); notify.Check(err) != nil {
+			return err
+		}
+	}
+	if _, err := e.RemoveFilteredPolicy(0, role); notify.Check(err) != nil {
+		return err
+	}
+	return notify.Err()
+}
+
 func GetUserID(userID uint) string {
 	return strconv.FormatUint(uint64(userID), 10)
 }
+
+// GetAPIKeySubject 服务账号类型API密钥的Casbin主体
+func GetAPIKeySubject(keyID uint) string {
+	return "apikey:" + strconv.FormatUint(uint64(keyID), 10)
+}
+
+// DeleteSubjectInDomain 删除主体在域中的角色分配，全局域中的分配和部门关系不受影响
+func DeleteSubjectInDomain(sub, dom string) error {
+	_, err := removeFilteredGrants(RoleRule, 0, sub, "", dom)
+	return err
+}
+
+// DeleteSubject 删除主体的全部角色和部门关系
+func DeleteSubject(sub string) error {
+	var notify NotifyErrors
+	if _, err := removeFilteredGrants(RoleRule, 0, sub); notify.Check(err) != nil {
+		return err
+	}
+	if _, err := removeFilteredGrants(DepartmentRule, 0, sub); notify.Check(err) != nil {
+		return err
+	}
+	return notify.Err()
+}
@@ -0,0 +1,196 @@
+package rbac
+
+import (
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"testing"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+)
+
+// setupEnforcer 初始化测试数据库和 Casbin，在角色表中定义角色
+func setupEnforcer(t *testing.T, roles ...string) {
+	t.Helper()
+	dbtest.Open(t)
+	if err := InitRBAC(); err != nil {
+		t.Fatalf("InitRBAC: %v", err)
+	}
+	for _, role := range roles {
+		if err := database.GetDB().Create(&rbacModels.Role{Name: role}).Error; err != nil {
+			t.Fatalf("create role %s: %v", role, err)
+		}
+	}
+}
+
+// mustAdd 返回断言规则添加成功的函数
+func mustAdd(t *testing.T) func(bool, error) {
+	return func(_ bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatcherDenyRules(t *testing.T) {
+	setupEnforcer(t, SuperAdminRole, "editor")
+	must := mustAdd(t)
+	must(AddRoleForUser("1", SuperAdminRole, AllDomains))
+	must(AddRoleForUser("1", "editor", "1"))
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicy("editor", "1", "/articles/*", "GET|POST"))
+	must(AddPolicyRule("editor", "1", "/articles/secret", "GET", NoCondition, EffectDeny))
+	must(AddPolicyRule("2", AllDomains, "/articles/*", "POST", NoCondition, EffectDeny))
+
+	cases := []struct {
+		name, sub, obj, act string
+		want                bool
+	}{
+		{"super admin ignores deny on own role", "1", "/articles/secret", "GET", true},
+		{"super admin ignores deny on global domain", "1", "/articles/1", "POST", true},
+		{"role deny overrides allow", "2", "/articles/secret", "GET", false},
+		{"direct deny overrides role allow", "2", "/articles/1", "POST", false},
+		{"allow without matching deny", "2", "/articles/1", "GET", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Enforce(tc.sub, "1", tc.obj, tc.act)
+			if err != nil {
+				t.Fatalf("Enforce: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("Enforce(%s, %s %s) = %v, want %v", tc.sub, tc.act, tc.obj, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditionalDenyFailsClosed(t *testing.T) {
+	setupEnforcer(t, "editor")
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicy("editor", "1", "/articles/*", "GET"))
+	must(AddPolicyRule("editor", "1", "/articles/*", "GET", "obj.owner_id != sub.id", EffectDeny))
+	must(AddPolicyRule("editor", "1", "/reports/*", "GET", "obj.owner_id == sub.id", EffectAllow))
+
+	cases := []struct {
+		name, obj string
+		attrs     Attributes
+		want      bool
+	}{
+		{"deny condition not met", "/articles/1",
+			Attributes{Sub: map[string]any{"id": 2}, Obj: map[string]any{"owner_id": 2}}, true},
+		{"deny condition met", "/articles/1",
+			Attributes{Sub: map[string]any{"id": 2}, Obj: map[string]any{"owner_id": 3}}, false},
+		{"deny with missing attribute", "/articles/1",
+			Attributes{Sub: map[string]any{"id": 2}}, false},
+		{"deny without attributes", "/articles/1", Attributes{}, false},
+		{"allow condition met", "/reports/1",
+			Attributes{Sub: map[string]any{"id": 2}, Obj: map[string]any{"owner_id": 2}}, true},
+		{"allow with missing attribute", "/reports/1",
+			Attributes{Sub: map[string]any{"id": 2}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EnforceWithAttributes("2", "1", tc.obj, "GET", tc.attrs)
+			if err != nil {
+				t.Fatalf("EnforceWithAttributes: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("EnforceWithAttributes(%s) = %v, want %v", tc.obj, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditionNumericComparisons(t *testing.T) {
+	setupEnforcer(t, "editor")
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicyRule("editor", "1", "/owned/*", "GET", "obj.owner_id == sub.id", EffectAllow))
+	must(AddPolicyRule("editor", "1", "/orders/*", "GET", "obj.amount <= 1000", EffectAllow))
+	must(AddPolicy("editor", "1", "/night/*", "GET"))
+	must(AddPolicyRule("editor", "1", "/night/*", "GET", "env.hour < 9", EffectDeny))
+
+	// 属性可能是任意整数类型，比较前统一转为 float64
+	cases := []struct {
+		name, obj string
+		attrs     Attributes
+		want      bool
+	}{
+		{"uint equals int64", "/owned/1",
+			Attributes{Sub: map[string]any{"id": uint(2)}, Obj: map[string]any{"owner_id": int64(2)}}, true},
+		{"int equals uint8", "/owned/1",
+			Attributes{Sub: map[string]any{"id": 2}, Obj: map[string]any{"owner_id": uint8(2)}}, true},
+		{"different owner", "/owned/1",
+			Attributes{Sub: map[string]any{"id": uint(2)}, Obj: map[string]any{"owner_id": int64(3)}}, false},
+		{"int below literal", "/orders/1", Attributes{Obj: map[string]any{"amount": 999}}, true},
+		{"int equal to literal", "/orders/1", Attributes{Obj: map[string]any{"amount": uint32(1000)}}, true},
+		{"int above literal", "/orders/1", Attributes{Obj: map[string]any{"amount": int16(1001)}}, false},
+		{"float32 below literal", "/orders/1", Attributes{Obj: map[string]any{"amount": float32(999.5)}}, true},
+		{"deny matches int", "/night/1", Attributes{Env: map[string]any{"hour": 8}}, false},
+		{"deny does not match int", "/night/1", Attributes{Env: map[string]any{"hour": 10}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EnforceWithAttributes("2", "1", tc.obj, "GET", tc.attrs)
+			if err != nil {
+				t.Fatalf("EnforceWithAttributes: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("EnforceWithAttributes(%s, %v) = %v, want %v", tc.obj, tc.attrs, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluationErrorsFailClosed(t *testing.T) {
+	setupEnforcer(t, "editor")
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicyRule("editor", "1", "/orders/*", "GET", "obj.amount <= 1000", EffectAllow))
+	must(AddPolicy("editor", "1", "/limits/*", "GET"))
+	must(AddPolicyRule("editor", "1", "/limits/*", "GET", "obj.amount > 1000", EffectDeny))
+	must(AddPolicyRule("editor", "1", "/totals/*", "GET", "obj.amount + 1", EffectAllow))
+	// 无法编译的条件只可能来自直接写入数据库的规则
+	broken := []gormadapter.CasbinRule{
+		{Ptype: "p", V0: "editor", V1: "1", V2: "/broken/*", V3: "GET", V4: "obj.owner_id ==", V5: EffectAllow},
+		{Ptype: "p", V0: "editor", V1: "1", V2: "/guarded/*", V3: "GET", V4: NoCondition, V5: EffectAllow},
+		{Ptype: "p", V0: "editor", V1: "1", V2: "/guarded/*", V3: "GET", V4: "obj.owner_id ==", V5: EffectDeny},
+	}
+	if err := database.GetDB().Create(&broken).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+
+	// 求值出错、结果不是布尔值或条件无法编译时，允许策略不生效，拒绝策略生效
+	amount := Attributes{Obj: map[string]any{"amount": "999", "owner_id": 2}}
+	cases := []struct {
+		name, obj string
+		want      bool
+	}{
+		{"allow compares string with number", "/orders/1", false},
+		{"deny compares string with number", "/limits/1", false},
+		{"allow with non-boolean result", "/totals/1", false},
+		{"allow with invalid condition", "/broken/1", false},
+		{"deny with invalid condition", "/guarded/1", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EnforceWithAttributes("2", "1", tc.obj, "GET", amount)
+			if err != nil {
+				t.Fatalf("EnforceWithAttributes: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("EnforceWithAttributes(%s) = %v, want %v", tc.obj, got, tc.want)
+			}
+		})
+	}
+	// 同样的策略在属性类型正确时正常生效
+	if ok, _ := EnforceWithAttributes("2", "1", "/limits/1", "GET", Attributes{Obj: map[string]any{"amount": 999}}); !ok {
+		t.Fatal("deny with a numeric amount below the limit denies the request")
+	}
+}
@@ -0,0 +1,361 @@
+package rbac
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-starter/internal/infra/database"
+	"sync"
+	"time"
+
+	casbin2 "github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// maxNotifyPayload PostgreSQL NOTIFY 的消息上限为 8000 字节，超过时改为通知全量重新加载
+const maxNotifyPayload = 7900
+
+// 策略变更通知的操作类型
+const (
+	updateAdd            = "add"
+	updateRemove         = "remove"
+	updateRemoveFiltered = "remove_filtered"
+	updateUpdate         = "update"
+	updateReload         = "reload"
+)
+
+// ErrNotifyFailed 策略修改已保存到数据库和当前实例，但没能通知其他实例
+// 其他实例会在下一次通知（改为全量重新加载）或重新建立监听时同步
+var ErrNotifyFailed = errors.New("策略已保存，但通知其他实例失败")
+
+// NotifyErrors 收集多步修改中的通知失败：某一步已保存但通知失败时继续执行余下的步骤，避免只完成一半的修改
+type NotifyErrors struct {
+	err error
+}
+
+// Check 记录通知失败并返回 nil，其他错误原样返回
+func (n *NotifyErrors) Check(err error) error {
+	if errors.Is(err, ErrNotifyFailed) {
+		n.err = err
+		return nil
+	}
+	return err
+}
+
+// Err 返回记录的通知失败，没有时为 nil
+func (n *NotifyErrors) Err() error {
+	return n.err
+}
+
+// policyUpdate 策略变更通知，Rules 为增删或更新前的规则，NewRules 为更新后的规则
+type policyUpdate struct {
+	Instance    string     `json:"instance"`
+	Op          string     `json:"op"`
+	Sec         string     `json:"sec,omitempty"`
+	Ptype       string     `json:"ptype,omitempty"`
+	Rules       [][]string `json:"rules,omitempty"`
+	NewRules    [][]string `json:"new_rules,omitempty"`
+	FieldIndex  int        `json:"field_index,omitempty"`
+	FieldValues []string   `json:"field_values,omitempty"`
+}
+
+// PolicyWatcher 基于 PostgreSQL LISTEN/NOTIFY 的Casbin监听器
+// 当前实例修改策略后通过 NOTIFY 广播变更，其他实例收到后只在内存中应用这条变更，不再写入数据库
+type PolicyWatcher struct {
+	channel  string
+	instance string // 实例标识，忽略自己发出的通知
+	enforcer *casbin2.SyncedEnforcer
+	notify   func(payload string) error // 发送通知，默认为 pg_notify
+	onError  func(error)
+	callback func(string)
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	stale    bool // 上一次通知失败，其他实例可能漏掉了变更，下一次改为通知全量重新加载
+}
+
+var (
+	_ persist.WatcherEx        = (*PolicyWatcher)(nil)
+	_ persist.UpdatableWatcher = (*PolicyWatcher)(nil)
+)
+
+// EnableWatcher 为执行器启用策略变更通知，之后当前实例的每次策略修改都会通知监听同一频道的其他实例
+// 通知失败不影响已保存的修改，修改策略的函数返回包装了 ErrNotifyFailed 的错误，同时交给 onError 处理
+func EnableWatcher(channel string, onError func(error)) (*PolicyWatcher, error) {
+	w, err := newWatcher(rbacService.enforcer, channel, onError)
+	if err != nil {
+		return nil, err
+	}
+	if err := rbacService.enforcer.SetWatcher(w); err != nil {
+		return nil, err
+	}
+	rbacService.watcher = w
+	return w, nil
+}
+
+// newWatcher 创建监听器，通知通过 pg_notify 发送到 channel
+func newWatcher(e *casbin2.SyncedEnforcer, channel string, onError func(error)) (*PolicyWatcher, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	w := &PolicyWatcher{
+		channel:  channel,
+		instance: hex.EncodeToString(b),
+		enforcer: e,
+		onError:  onError,
+	}
+	w.notify = func(payload string) error {
+		return database.GetDB().Exec("SELECT pg_notify(?, ?)", w.channel, payload).Error
+	}
+	return w, nil
+}
+
+// Listen 在后台监听其他实例的策略变更，连接断开后按指数退避重连，每次建立监听后重新加载全部策略以补上断开期间的变更
+func (w *PolicyWatcher) Listen() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.mu.Lock()
+	w.cancel = cancel
+	w.mu.Unlock()
+	go func() {
+		delay := time.Second
+		for {
+			listened, err := w.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			w.fail(err)
+			if listened {
+				delay = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, 30*time.Second)
+		}
+	}()
+}
+
+// listen 占用一个专用连接执行 LISTEN 并等待通知，返回是否成功建立过监听
+func (w *PolicyWatcher) listen(ctx context.Context) (bool, error) {
+	sqlDB, err := database.GetDB().DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	listened := false
+	var listenErr error
+	_ = conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			listenErr = errors.New("策略同步需要使用 pgx 驱动的 PostgreSQL 连接")
+			return driver.ErrBadConn
+		}
+		pgConn := c.Conn()
+		if _, listenErr = pgConn.Exec(ctx, "LISTEN "+pgx.Identifier{w.channel}.Sanitize()); listenErr != nil {
+			return driver.ErrBadConn
+		}
+		listened = true
+		if listenErr = w.reload(); listenErr != nil {
+			return driver.ErrBadConn
+		}
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				listenErr = err
+				// 监听中的连接不能归还连接池
+				return driver.ErrBadConn
+			}
+			w.handle(notification.Payload)
+		}
+	})
+	return listened, listenErr
+}
+
+// handle 应用其他实例的变更，无法增量应用时重新加载全部策略
+func (w *PolicyWatcher) handle(payload string) {
+	var update policyUpdate
+	if err := json.Unmarshal([]byte(payload), &update); err != nil {
+		w.fail(err)
+		return
+	}
+	if update.Instance == w.instance {
+		return
+	}
+	if update.Op == updateReload {
+		if err := w.reload(); err != nil {
+			w.fail(err)
+		}
+		return
+	}
+	if err := applyUpdate(w.enforcer, update); err != nil {
+		w.fail(err)
+		if err := w.reload(); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+// applyUpdate 只在内存中应用变更，g 和 g2 规则同时增量更新角色继承关系
+// 持有执行器的写锁，与校验和本地修改互斥，校验不会看到修改了一半的模型
+func applyUpdate(e *casbin2.SyncedEnforcer, update policyUpdate) error {
+	e.GetLock().Lock()
+	defer e.GetLock().Unlock()
+	m := e.GetModel()
+	var removed, added [][]string
+	switch update.Op {
+	case updateAdd:
+		rules, err := m.AddPoliciesWithAffected(update.Sec, update.Ptype, update.Rules)
+		if err != nil {
+			return err
+		}
+		added = rules
+	case updateRemove:
+		rules, err := m.RemovePoliciesWithAffected(update.Sec, update.Ptype, update.Rules)
+		if err != nil {
+			return err
+		}
+		removed = rules
+	case updateRemoveFiltered:
+		_, rules, err := m.RemoveFilteredPolicy(update.Sec, update.Ptype, update.FieldIndex, update.FieldValues...)
+		if err != nil {
+			return err
+		}
+		removed = rules
+	case updateUpdate:
+		ok, err := m.UpdatePolicies(update.Sec, update.Ptype, update.Rules, update.NewRules)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("策略更新与本地策略不一致")
+		}
+		removed, added = update.Rules, update.NewRules
+	default:
+		return errors.New("未知的策略变更: " + update.Op)
+	}
+	if update.Sec != "g" {
+		return nil
+	}
+	if len(removed) > 0 {
+		if err := e.BuildIncrementalRoleLinks(model.PolicyRemove, update.Ptype, removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return e.BuildIncrementalRoleLinks(model.PolicyAdd, update.Ptype, added)
+	}
+	return nil
+}
+
+// reload 重新加载全部策略
+func (w *PolicyWatcher) reload() error {
+	w.mu.Lock()
+	callback := w.callback
+	w.mu.Unlock()
+	if callback != nil {
+		callback(w.instance)
+		return nil
+	}
+	return w.enforcer.LoadPolicy()
+}
+
+// publish 发送变更通知，消息过大或上一次通知失败时改为通知全量重新加载
+// 通知失败时返回包装了 ErrNotifyFailed 的错误，Casbin 会将其返回给修改策略的调用方
+func (w *PolicyWatcher) publish(update policyUpdate) error {
+	w.mu.Lock()
+	stale := w.stale
+	w.mu.Unlock()
+	if stale {
+		update = policyUpdate{Op: updateReload}
+	}
+	update.Instance = w.instance
+	payload, err := json.Marshal(update)
+	if err == nil && len(payload) > maxNotifyPayload {
+		payload, err = json.Marshal(policyUpdate{Instance: w.instance, Op: updateReload})
+	}
+	if err == nil {
+		err = w.notify(string(payload))
+	}
+	w.mu.Lock()
+	w.stale = err != nil
+	w.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrNotifyFailed, err)
+		w.fail(err)
+	}
+	return err
+}
+
+// fail 报告同步错误
+func (w *PolicyWatcher) fail(err error) {
+	if err != nil && w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// SetUpdateCallback 设置收到全量重新加载通知时的回调，默认为重新加载执行器的策略
+func (w *PolicyWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update 通知其他实例重新加载全部策略
+func (w *PolicyWatcher) Update() error {
+	return w.publish(policyUpdate{Op: updateReload})
+}
+
+// Close 停止监听
+func (w *PolicyWatcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+func (w *PolicyWatcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.publish(policyUpdate{Op: updateAdd, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+func (w *PolicyWatcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.publish(policyUpdate{Op: updateRemove, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+func (w *PolicyWatcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.publish(policyUpdate{Op: updateRemoveFiltered, Sec: sec, Ptype: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues})
+}
+
+func (w *PolicyWatcher) UpdateForSavePolicy(model.Model) error {
+	return w.Update()
+}
+
+func (w *PolicyWatcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(policyUpdate{Op: updateAdd, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (w *PolicyWatcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(policyUpdate{Op: updateRemove, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (w *PolicyWatcher) UpdateForUpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return w.publish(policyUpdate{Op: updateUpdate, Sec: sec, Ptype: ptype, Rules: [][]string{oldRule}, NewRules: [][]string{newRule}})
+}
+
+func (w *PolicyWatcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return w.publish(policyUpdate{Op: updateUpdate, Sec: sec, Ptype: ptype, Rules: oldRules, NewRules: newRules})
+}
@@ -0,0 +1,345 @@
+package rbac
+
+import (
+	"encoding/json"
+	"errors"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"sync"
+	"testing"
+	"time"
+
+	casbin2 "github.com/casbin/casbin/v2"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+)
+
+// peerFixture 同一个数据库上的第二个实例，当前实例的通知直接交给它的监听器，不经过 PostgreSQL
+type peerFixture struct {
+	enforcer *casbin2.SyncedEnforcer
+	watcher  *PolicyWatcher // 当前实例的监听器
+	mu       sync.Mutex
+	payloads []string
+	notify   func(payload string) error // 为 nil 时投递给第二个实例
+}
+
+// connectPeer 为当前实例启用监听器，并在同一个数据库上创建第二个实例接收它的通知
+func connectPeer(t *testing.T) *peerFixture {
+	t.Helper()
+	a, err := gormadapter.NewAdapterByDB(database.GetDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := newEnforcer(a)
+	if err != nil {
+		t.Fatalf("newEnforcer: %v", err)
+	}
+	peer, err := newWatcher(e, "casbin_policy", func(err error) { t.Errorf("peer watcher: %v", err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &peerFixture{enforcer: e}
+	w, err := newWatcher(rbacService.enforcer, "casbin_policy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.notify = func(payload string) error {
+		p.mu.Lock()
+		p.payloads = append(p.payloads, payload)
+		notify := p.notify
+		p.mu.Unlock()
+		if notify != nil {
+			return notify(payload)
+		}
+		peer.handle(payload)
+		return nil
+	}
+	if err := rbacService.enforcer.SetWatcher(w); err != nil {
+		t.Fatal(err)
+	}
+	rbacService.watcher = w
+	p.watcher = w
+	return p
+}
+
+// enforce 在第二个实例上校验权限
+func (p *peerFixture) enforce(t *testing.T, sub, dom, obj, act string) bool {
+	t.Helper()
+	if err := syncGrantLinks(p.enforcer); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := p.enforcer.Enforce(sub, dom, obj, act, Attributes{})
+	if err != nil {
+		t.Fatalf("peer Enforce: %v", err)
+	}
+	return ok
+}
+
+func TestWatcherPropagatesChanges(t *testing.T) {
+	setupEnforcer(t, "editor")
+	p := connectPeer(t)
+	must := mustAdd(t)
+
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicy("editor", "1", "/articles/*", "GET"))
+	if !p.enforce(t, "2", "1", "/articles/1", "GET") {
+		t.Fatal("peer denies a policy added on the other instance")
+	}
+
+	if err := UpdatePermission("/articles/*", "GET", "/posts/*", "GET"); err != nil {
+		t.Fatalf("UpdatePermission: %v", err)
+	}
+	if p.enforce(t, "2", "1", "/articles/1", "GET") || !p.enforce(t, "2", "1", "/posts/1", "GET") {
+		t.Fatal("peer did not apply the updated permission")
+	}
+
+	must(DeleteRoleForUser("2", "editor", "1"))
+	if p.enforce(t, "2", "1", "/posts/1", "GET") {
+		t.Fatal("peer still allows a role removed on the other instance")
+	}
+
+	must(AddRoleForUser("3", "editor", "1"))
+	if err := DeleteRole("editor"); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	if p.enforce(t, "3", "1", "/posts/1", "GET") {
+		t.Fatal("peer still allows a role deleted on the other instance")
+	}
+	if rules, _ := p.enforcer.GetPolicy(); len(rules) != 0 {
+		t.Fatalf("peer policies = %v, want none", rules)
+	}
+}
+
+func TestWatcherEnforceDuringUpdates(t *testing.T) {
+	setupEnforcer(t, "editor")
+	p := connectPeer(t)
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+
+	// 第二个实例在监听器应用变更的同时校验权限，不能读到修改了一半的模型
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := p.enforcer.Enforce("2", "1", "/articles/1", "GET", Attributes{}); err != nil {
+					t.Errorf("peer Enforce: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for range 50 {
+		must(AddPolicy("editor", "1", "/articles/*", "GET"))
+		must(RemovePermissionForSubject("editor", "1", "/articles/*", "GET"))
+	}
+	close(done)
+	wg.Wait()
+	if p.enforce(t, "2", "1", "/articles/1", "GET") {
+		t.Fatal("peer allows a policy removed on the other instance")
+	}
+}
+
+func TestWatcherReportsNotifyFailure(t *testing.T) {
+	setupEnforcer(t, "editor")
+	p := connectPeer(t)
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+
+	p.notify = func(string) error { return errors.New("connection refused") }
+	_, err := AddPolicy("editor", "1", "/articles/*", "GET")
+	if !errors.Is(err, ErrNotifyFailed) {
+		t.Fatalf("AddPolicy error = %v, want ErrNotifyFailed", err)
+	}
+	// 修改已保存，只是第二个实例没有收到
+	if ok, err := Enforce("2", "1", "/articles/1", "GET"); err != nil || !ok {
+		t.Fatalf("Enforce = %v, %v; want the policy kept on this instance", ok, err)
+	}
+	if err := LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Enforce("2", "1", "/articles/1", "GET"); !ok {
+		t.Fatal("policy was not saved to the database")
+	}
+	if p.enforce(t, "2", "1", "/articles/1", "GET") {
+		t.Fatal("peer received a change whose notification failed")
+	}
+
+	// 下一次通知改为全量重新加载，补上漏掉的变更
+	p.notify = nil
+	must(AddPolicy("editor", "1", "/reports/*", "GET"))
+	if last := p.payloads[len(p.payloads)-1]; payloadOp(t, last) != updateReload {
+		t.Fatalf("notification after a failure = %s, want a reload", last)
+	}
+	if !p.enforce(t, "2", "1", "/articles/1", "GET") || !p.enforce(t, "2", "1", "/reports/1", "GET") {
+		t.Fatal("peer did not catch up after the failed notification")
+	}
+	if p.watcher.stale {
+		t.Fatal("watcher still stale after a successful notification")
+	}
+}
+
+// payloadOp 通知的操作类型
+func payloadOp(t *testing.T, payload string) string {
+	t.Helper()
+	var update policyUpdate
+	if err := json.Unmarshal([]byte(payload), &update); err != nil {
+		t.Fatal(err)
+	}
+	return update.Op
+}
+
+// listenTimeout 等待通知经 PostgreSQL 送达的最长时间
+const listenTimeout = 10 * time.Second
+
+// eventually 在 listenTimeout 内反复检查，直到 cond 成立
+func eventually(t *testing.T, message string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(listenTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// listenWatcher 让监听器通过 LISTEN 接收通知，建立监听并重新加载策略后才返回
+// 监听器的错误写入 errs，测试结束前停止监听
+func listenWatcher(t *testing.T, w *PolicyWatcher, errs chan error) {
+	t.Helper()
+	ready := make(chan struct{}, 1)
+	if err := w.SetUpdateCallback(func(string) {
+		if err := w.enforcer.LoadPolicy(); err != nil {
+			errs <- err
+		}
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	w.Listen()
+	t.Cleanup(w.Close)
+	select {
+	case <-ready:
+	case err := <-errs:
+		t.Fatalf("listen: %v", err)
+	case <-time.After(listenTimeout):
+		t.Fatal("watcher did not start listening")
+	}
+}
+
+func TestWatcherPostgresListen(t *testing.T) {
+	dbtest.OpenPostgres(t)
+	if err := InitRBAC(); err != nil {
+		t.Fatalf("InitRBAC: %v", err)
+	}
+	if err := database.GetDB().Create(&rbacModels.Role{Name: "editor"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 16)
+	report := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	const channel = "casbin_policy_test"
+	local, err := EnableWatcher(channel, report)
+	if err != nil {
+		t.Fatalf("EnableWatcher: %v", err)
+	}
+	listenWatcher(t, local, errs)
+
+	// 同一个数据库上的第二个实例，使用各自的执行器和监听器
+	a, err := gormadapter.NewAdapterByDB(database.GetDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := newEnforcer(a)
+	if err != nil {
+		t.Fatalf("newEnforcer: %v", err)
+	}
+	remote, err := newWatcher(e, channel, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetWatcher(remote); err != nil {
+		t.Fatal(err)
+	}
+	listenWatcher(t, remote, errs)
+	remoteEnforce := func(obj string) bool {
+		if err := syncGrantLinks(e); err != nil {
+			report(err)
+			return false
+		}
+		ok, err := e.Enforce("2", "1", obj, "GET", Attributes{})
+		if err != nil {
+			report(err)
+		}
+		return ok
+	}
+	localEnforce := func(obj string) bool {
+		ok, err := Enforce("2", "1", obj, "GET")
+		if err != nil {
+			report(err)
+		}
+		return ok
+	}
+
+	must := mustAdd(t)
+	must(AddRoleForUser("2", "editor", "1"))
+	must(AddPolicy("editor", "1", "/articles/*", "GET"))
+	eventually(t, "remote instance did not receive the new policy", func() bool { return remoteEnforce("/articles/1") })
+
+	if _, err := e.AddPolicy("editor", "1", "/reports/*", "GET", NoCondition, EffectAllow); err != nil {
+		t.Fatalf("remote AddPolicy: %v", err)
+	}
+	eventually(t, "local instance did not receive the remote policy", func() bool { return localEnforce("/reports/1") })
+
+	must(DeleteRoleForUser("2", "editor", "1"))
+	eventually(t, "remote instance still allows a removed role", func() bool { return !remoteEnforce("/reports/1") })
+
+	select {
+	case err := <-errs:
+		t.Fatalf("watcher error: %v", err)
+	default:
+	}
+}
+
+func TestWatcherPostgresNotifyFailure(t *testing.T) {
+	dbtest.OpenPostgres(t)
+	if err := InitRBAC(); err != nil {
+		t.Fatalf("InitRBAC: %v", err)
+	}
+	if err := database.GetDB().Create(&rbacModels.Role{Name: "editor"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 频道名为空时 pg_notify 报错
+	if _, err := EnableWatcher("", nil); err != nil {
+		t.Fatalf("EnableWatcher: %v", err)
+	}
+	_, err := AddRoleForUser("2", "editor", "1")
+	if !errors.Is(err, ErrNotifyFailed) {
+		t.Fatalf("AddRoleForUser error = %v, want ErrNotifyFailed", err)
+	}
+	_, err = AddPolicy("editor", "1", "/articles/*", "GET")
+	if !errors.Is(err, ErrNotifyFailed) {
+		t.Fatalf("AddPolicy error = %v, want ErrNotifyFailed", err)
+	}
+	if err := LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Enforce("2", "1", "/articles/1", "GET"); !ok {
+		t.Fatal("changes whose notification failed were not saved")
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"gin-starter/internal/application/services/rbac"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type RoleService struct{}
+
+var Role = &RoleService{}
+
+func (s *RoleService) CreateRole(name, description string) (*rbacModels.Role, error) {
+	if err := validateRoleName(name); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	var existingRole rbacModels.Role
+	if err := db.Where("name = ?", name).First(&existingRole).Error; err == nil {
+		return nil, res.ErrRoleAlreadyExists
+	}
+	role := &rbacModels.Role{
+		Name:        name,
+		Description: description,
+	}
+	if err := db.Create(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *RoleService) GetAllRoles() ([]*rbacModels.Role, error) {
+	db := database.GetDB()
+	var roles []*rbacModels.Role
+	if err := db.Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *RoleService) GetRoleByID(id uint) (*rbacModels.Role, error) {
+	db := database.GetDB()
+	var role rbacModels.Role
+	if err := db.First(&role, id).Error; err != nil {
+		return nil, res.ErrRoleNotFound
+	}
+	return &role, nil
+}
+
+// UpdateRole 更新角色，名称变更时同步改写Casbin中的分组规则和策略
+// Casbin 规则在角色表提交后改写，改写失败时恢复角色表和已改写的规则
+func (s *RoleService) UpdateRole(id uint, name, description string) (*rbacModels.Role, error) {
+	if err := validateRoleName(name); err != nil {
+		return nil, err
+	}
+	var role, previous rbacModels.Role
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&role, id).Error; err != nil {
+			return res.ErrRoleNotFound
+		}
+		var existingRole rbacModels.Role
+		if err := tx.Where("name = ? AND id != ?", name, id).First(&existingRole).Error; err == nil {
+			return res.ErrRoleAlreadyExists
+		}
+		if role.Name == rbac.SuperAdminRole && name != role.Name {
+			return res.ErrInvalidParam.WithMessage("超级管理员角色不能重命名")
+		}
+		previous = role
+		role.Name = name
+		role.Description = description
+		return tx.Save(&role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previous.Name != name {
+		err := rbac.RenameRole(previous.Name, name)
+		// 只是通知其他实例失败时修改已经生效，不回滚
+		if err != nil && !errors.Is(err, rbac.ErrNotifyFailed) {
+			if rollbackErr := rbac.RenameRole(name, previous.Name); rollbackErr != nil {
+				utils.Log.Errorf("角色重命名回滚失败, %s -> %s: %v", name, previous.Name, rollbackErr)
+			}
+			if rollbackErr := db.Save(&previous).Error; rollbackErr != nil {
+				utils.Log.Errorf("角色表回滚失败, id=%d: %v", id, rollbackErr)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &role, nil
+}
+
+// DeleteRole 删除角色，同时移除该角色的全部分配关系和权限策略
+// Casbin 规则在角色表提交后移除，移除失败时恢复角色记录，可以重新删除
+func (s *RoleService) DeleteRole(id uint) error {
+	var role rbacModels.Role
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&role, id).Error; err != nil {
+			return res.ErrRoleNotFound
+		}
+		if role.Name == rbac.SuperAdminRole {
+			return res.ErrInvalidParam.WithMessage("超级管理员角色不能删除")
+		}
+		// 硬删除，便于之后重新创建同名角色
+		return tx.Unscoped().Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+	err = rbac.DeleteRole(role.Name)
+	if err != nil && !errors.Is(err, rbac.ErrNotifyFailed) {
+		if rollbackErr := db.Create(&role).Error; rollbackErr != nil {
+			utils.Log.Errorf("角色记录恢复失败, id=%d: %v", id, rollbackErr)
+		}
+	}
+	return err
+}
+
+// EnsureRole 角色不存在时创建，用于初始化数据
+func (s *RoleService) EnsureRole(name, description string) error {
+	role := rbacModels.Role{Name: name, Description: description}
+	return database.GetDB().Where(rbacModels.Role{Name: name}).Attrs(role).FirstOrCreate(&role).Error
+}
+
+// ImportRolesFromPolicies 将Casbin分组规则中已使用但角色表中没有的角色补录到角色表
+// 用于升级前只在Casbin中存在的角色
+func (s *RoleService) ImportRolesFromPolicies() error {
+	rules, err := rbac.GetGroupingPolicy()
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if len(rule) < 2 || validateRoleName(rule[1]) != nil {
+			continue
+		}
+		if err := s.EnsureRole(rule[1], ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRoleName 校验角色名称
+// 纯数字会与用户ID主体混淆，冒号保留给 apikey: 等特殊主体
+func validateRoleName(name string) error {
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		return res.ErrInvalidParam.WithMessage("角色名称不能是纯数字")
+	}
+	if strings.ContainsAny(name, ": ") {
+		return res.ErrInvalidParam.WithMessage("角色名称不能包含冒号或空格")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"slices"
+	"testing"
+)
+
+func TestUpdateRoleRenamesCasbinRules(t *testing.T) {
+	setupRBAC(t)
+	role, err := Role.CreateRole("writer", "")
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddRoleForUser("7", "writer", dom); err != nil {
+		t.Fatalf("AddRoleForUser: %v", err)
+	}
+	if _, err := rbac.AddPolicy("writer", dom, "/articles/*", "POST"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+
+	if _, err := Role.UpdateRole(role.ID, "author", ""); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	roles, err := rbac.GetRolesForUser("7", dom)
+	if err != nil {
+		t.Fatalf("GetRolesForUser: %v", err)
+	}
+	if !slices.Equal(roles, []string{"author"}) {
+		t.Fatalf("roles = %v, want [author]", roles)
+	}
+	allowed, err := rbac.Enforce("7", dom, "/articles/1", "POST")
+	if err != nil || !allowed {
+		t.Fatalf("renamed role lost its policy: %v %v", allowed, err)
+	}
+}
+
+func TestDeleteRoleRemovesCasbinRules(t *testing.T) {
+	setupRBAC(t)
+	role, err := Role.CreateRole("writer", "")
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	if _, err := rbac.AddRoleForUser("7", "writer", dom); err != nil {
+		t.Fatalf("AddRoleForUser: %v", err)
+	}
+	if _, err := rbac.AddPolicy("writer", dom, "/articles/*", "POST"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+
+	if err := Role.DeleteRole(role.ID); err != nil {
+		t.Fatalf("DeleteRole: %v", err)
+	}
+	roles, err := rbac.GetRolesForUser("7", dom)
+	if err != nil {
+		t.Fatalf("GetRolesForUser: %v", err)
+	}
+	if len(roles) != 0 {
+		t.Fatalf("roles = %v, want none", roles)
+	}
+	if _, err := Role.GetRoleByID(role.ID); err == nil {
+		t.Fatal("role record not deleted")
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// statusCacheTTL 状态缓存有效期，多实例部署时其他实例的吊销最迟在该时间后生效
+const statusCacheTTL = 30 * time.Second
+
+type SessionService struct {
+	cache *statusCache
+}
+
+var Session = &SessionService{cache: newStatusCache(statusCacheTTL)}
+
+// CreateSession 创建登录会话
+func (s *SessionService) CreateSession(db *gorm.DB, userID uint, clientIP, userAgent string, mfa bool) (*models.Session, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:         id,
+		LastUsedAt: now,
+		UserID:     userID,
+		ClientIP:   clientIP,
+		UserAgent:  userAgent,
+		ExpiresAt:  now.Add(config.GetJWTRefreshTokenTTL()),
+		MFA:        mfa,
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions 获取用户的有效会话
+func (s *SessionService) ListSessions(userID uint) ([]*models.Session, error) {
+	db := database.GetDB()
+	var sessions []*models.Session
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的指定会话及其刷新令牌
+func (s *SessionService) RevokeSession(userID uint, sessionID string) error {
+	db := database.GetDB()
+	var session models.Session
+	if err := db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return res.ErrNotFound.WithMessage("会话不存在")
+	}
+	return s.revokeSessions(db.Where("id = ?", sessionID))
+}
+
+// RevokeAllSessions 吊销用户的全部会话，即"退出所有设备"
+func (s *SessionService) RevokeAllSessions(userID uint) error {
+	db := database.GetDB()
+	return s.revokeSessions(db.Where("user_id = ?", userID))
+}
+
+// RevokeToken 吊销单个访问令牌
+func (s *SessionService) RevokeToken(claims *jwt.Claims) error {
+	db := database.GetDB()
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	revoked := &models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := db.Save(revoked).Error; err != nil {
+		return err
+	}
+	s.cache.set(tokenCacheKey(claims.ID), false)
+	// 顺带清理已经自然过期的吊销记录
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
+
+// ValidateClaims 校验访问令牌是否仍可使用：未被吊销、会话有效、用户有效
+func (s *SessionService) ValidateClaims(claims *jwt.Claims) error {
+	db := database.GetDB()
+
+	if claims.ID != "" {
+		valid, ok := s.cache.get(tokenCacheKey(claims.ID))
+		if !ok {
+			var count int64
+			if err := db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			valid = count == 0
+			s.cache.set(tokenCacheKey(claims.ID), valid)
+		}
+		if !valid {
+			return res.ErrTokenRevoked
+		}
+	}
+
+	if claims.SessionID != "" {
+		valid, ok := s.cache.get(sessionCacheKey(claims.SessionID))
+		if !ok {
+			var session models.Session
+			valid = db.Where("id = ?", claims.SessionID).First(&session).Error == nil && session.IsActive()
+			s.cache.set(sessionCacheKey(claims.SessionID), valid)
+		}
+		if !valid {
+			return res.ErrTokenRevoked
+		}
+	}
+
+	return s.ValidateUser(claims.UserID)
+}
+
+// ValidateUser 校验用户是否存在且未停用
+func (s *SessionService) ValidateUser(userID uint) error {
+	valid, ok := s.cache.get(userCacheKey(userID))
+	if !ok {
+		// 软删除的用户不会被查询到
+		var user models.User
+		valid = database.WithoutTenant(database.GetDB()).Select("id", "is_active").First(&user, userID).Error == nil && user.IsActive
+		s.cache.set(userCacheKey(userID), valid)
+	}
+	if !valid {
+		return res.ErrUserInactive
+	}
+	return nil
+}
+
+// MarkMFA 将会话标记为已通过双因素认证，之后刷新得到的令牌会携带 mfa 声明
+func (s *SessionService) MarkMFA(userID uint, sessionID string) error {
+	return database.GetDB().Model(&models.Session{}).
+		Where("id = ? AND user_id = ?", sessionID, userID).
+		Update("mfa", true).Error
+}
+
+// InvalidateUser 用户状态变更后清除缓存
+func (s *SessionService) InvalidateUser(userID uint) {
+	s.cache.delete(userCacheKey(userID))
+}
+
+// revokeSessions 吊销匹配条件的会话，并同步吊销对应的刷新令牌
+func (s *SessionService) revokeSessions(query *gorm.DB) error {
+	var sessions []models.Session
+	if err := query.Where("revoked_at IS NULL").Find(&sessions).Error; err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	now := time.Now()
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id IN ? AND revoked_at IS NULL", ids).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.cache.set(sessionCacheKey(id), false)
+	}
+	return nil
+}
+
+func tokenCacheKey(jti string) string {
+	return "jti:" + jti
+}
+
+func sessionCacheKey(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+func userCacheKey(userID uint) string {
+	return "uid:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// statusCache 带过期时间的内存状态缓存
+type statusCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]statusCacheEntry
+}
+
+type statusCacheEntry struct {
+	valid     bool
+	expiresAt time.Time
+}
+
+func newStatusCache(ttl time.Duration) *statusCache {
+	return &statusCache{
+		ttl:     ttl,
+		entries: make(map[string]statusCacheEntry),
+	}
+}
+
+func (c *statusCache) get(key string) (bool, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.valid, true
+}
+
+func (c *statusCache) set(key string, valid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// 写入时顺带淘汰过期条目，避免缓存无限增长
+	if len(c.entries) > 10000 {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = statusCacheEntry{valid: valid, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *statusCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/res"
+	"testing"
+	"time"
+)
+
+func TestRevokeSessionTakesEffectImmediately(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	pair := issueTokens(t, user)
+	other := issueTokens(t, user)
+	claims := parseAccess(t, pair)
+	if err := Session.ValidateClaims(claims); err != nil {
+		t.Fatalf("ValidateClaims: %v", err)
+	}
+
+	// 已缓存为有效的会话在本实例吊销后立即失效
+	if err := Session.RevokeSession(user.ID, claims.SessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	assertCode(t, Session.ValidateClaims(claims), res.ErrTokenRevoked)
+	if err := Session.ValidateClaims(parseAccess(t, other)); err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+	assertCode(t, Session.RevokeSession(user.ID+1, parseAccess(t, other).SessionID), res.ErrNotFound)
+
+	sessions, err := Session.ListSessions(user.ID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != parseAccess(t, other).SessionID {
+		t.Fatalf("ListSessions = %d sessions, want only the active one", len(sessions))
+	}
+}
+
+func TestRevokeTokenKeepsSession(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	pair := issueTokens(t, user)
+	claims := parseAccess(t, pair)
+	if err := Session.RevokeToken(claims); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	assertCode(t, Session.ValidateClaims(claims), res.ErrTokenRevoked)
+
+	// 退出登录只吊销访问令牌，同一会话刷新得到的新令牌仍然有效
+	refreshed, err := Token.RefreshTokenPair(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokenPair: %v", err)
+	}
+	if err := Session.ValidateClaims(parseAccess(t, refreshed)); err != nil {
+		t.Fatalf("ValidateClaims: %v", err)
+	}
+}
+
+func TestStatusCacheDelaysRevocationFromOtherInstances(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	claims := parseAccess(t, issueTokens(t, user))
+	ttl := 200 * time.Millisecond
+	s := &SessionService{cache: newStatusCache(ttl)}
+	if err := s.ValidateClaims(claims); err != nil {
+		t.Fatalf("ValidateClaims: %v", err)
+	}
+
+	// 模拟其他实例直接在数据库中吊销会话和令牌、停用用户
+	db := database.GetDB()
+	db.Model(&models.Session{}).Where("id = ?", claims.SessionID).Update("revoked_at", time.Now())
+	if err := s.ValidateClaims(claims); err != nil {
+		t.Fatalf("ValidateClaims within the cache TTL = %v, want the cached result", err)
+	}
+	time.Sleep(ttl + 10*time.Millisecond)
+	assertCode(t, s.ValidateClaims(claims), res.ErrTokenRevoked)
+
+	if err := s.ValidateUser(user.ID); err != nil {
+		t.Fatalf("ValidateUser: %v", err)
+	}
+	database.WithoutTenant(db).Model(&models.User{}).Where("id = ?", user.ID).Update("is_active", false)
+	if err := s.ValidateUser(user.ID); err != nil {
+		t.Fatalf("ValidateUser within the cache TTL = %v, want the cached result", err)
+	}
+	s.InvalidateUser(user.ID)
+	assertCode(t, s.ValidateUser(user.ID), res.ErrUserInactive)
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/res"
+	"testing"
+	"time"
+)
+
+// tenantFixture 两个租户各有一个用户和一个部门，ctx 为默认租户的请求上下文
+type tenantFixture struct {
+	ctx        context.Context
+	own, other *models.User
+	ownDept    *rbacModels.Department
+	otherDept  *rbacModels.Department
+}
+
+func setupTenants(t *testing.T) *tenantFixture {
+	t.Helper()
+	setupRBAC(t)
+	tenant, err := Tenant.CreateTenant("acme", "")
+	if err != nil {
+		t.Fatalf("CreateTenant: %v", err)
+	}
+	f := &tenantFixture{ctx: database.WithTenant(context.Background(), models.DefaultTenantID)}
+	otherCtx := database.WithTenant(context.Background(), tenant.ID)
+	db := database.GetDB()
+	f.own = &models.User{Username: "alice", Email: "alice@example.com", Password: "-", IsActive: true}
+	f.other = &models.User{Username: "bob", Email: "bob@example.com", Password: "-", IsActive: true}
+	if err := db.WithContext(f.ctx).Create(f.own).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(otherCtx).Create(f.other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if f.ownDept, err = Department.CreateDepartment(f.ctx, "IT", "", nil); err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	// 部门名称在租户内唯一，其他租户可以使用相同的名称
+	if f.otherDept, err = Department.CreateDepartment(otherCtx, "IT", "", nil); err != nil {
+		t.Fatalf("CreateDepartment in other tenant: %v", err)
+	}
+	if _, err := rbac.AddDepartmentForUser(rbac.GetUserID(f.other.ID), rbac.GetDepartmentSubject(f.otherDept.ID)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// reload 绕过租户隔离重新读取用户
+func (f *tenantFixture) reload(t *testing.T, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := database.WithoutTenant(database.GetDB()).First(&user, id).Error; err != nil {
+		t.Fatalf("reload user %d: %v", id, err)
+	}
+	return &user
+}
+
+func TestUserServiceIsolatesTenants(t *testing.T) {
+	f := setupTenants(t)
+
+	users, err := User.GetAllUsers(f.ctx)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != f.own.ID {
+		t.Fatalf("GetAllUsers returned %d users, want only the own tenant's user", len(users))
+	}
+	_, err = User.GetUserByID(f.ctx, f.other.ID)
+	assertCode(t, err, res.ErrUserNotFound)
+	attrs, err := User.ObjectAttributes(f.ctx, map[string]string{"id": rbac.GetUserID(f.other.ID)})
+	if err != nil || attrs != nil {
+		t.Fatalf("ObjectAttributes = %v, %v; want no attributes for another tenant's user", attrs, err)
+	}
+
+	_, err = User.UpdateUser(f.ctx, f.other.ID, "mallory", "mallory@example.com")
+	assertCode(t, err, res.ErrUserNotFound)
+	assertCode(t, User.ChangeEmail(f.ctx, f.other.ID, "mallory@example.com"), res.ErrUserNotFound)
+	assertCode(t, User.DeactivateUser(f.ctx, f.other.ID), res.ErrUserNotFound)
+	assertCode(t, User.ActivateUser(f.ctx, f.other.ID), res.ErrUserNotFound)
+	assertCode(t, User.DeleteUser(f.ctx, f.other.ID), res.ErrUserNotFound)
+
+	other := f.reload(t, f.other.ID)
+	if other.Username != "bob" || other.PendingEmail != "" || !other.IsActive || other.TenantID == models.DefaultTenantID {
+		t.Fatalf("other tenant's user was modified: %+v", other)
+	}
+}
+
+func TestUserWritesStayInTenant(t *testing.T) {
+	f := setupTenants(t)
+	db := database.GetDB().WithContext(f.ctx)
+
+	// 新建的记录归属上下文中的租户，调用方设置的租户被覆盖
+	created := &models.User{Username: "carol", Email: "carol@example.com", Password: "-", TenantID: f.other.TenantID}
+	if err := db.Create(created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := f.reload(t, created.ID).TenantID; got != models.DefaultTenantID {
+		t.Fatalf("created user tenant = %d, want %d", got, models.DefaultTenantID)
+	}
+
+	// 更新不能把用户移到其他租户
+	own := f.reload(t, f.own.ID)
+	own.TenantID = f.other.TenantID
+	if err := db.Save(own).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := f.reload(t, f.own.ID).TenantID; got != models.DefaultTenantID {
+		t.Fatalf("own user tenant = %d after update, want %d", got, models.DefaultTenantID)
+	}
+
+	// Save 其他租户的记录不会覆盖它
+	other := f.reload(t, f.other.ID)
+	other.Username = "mallory"
+	db.Save(other)
+	if got := f.reload(t, f.other.ID).Username; got != "bob" {
+		t.Fatalf("other tenant's username = %q after Save, want bob", got)
+	}
+}
+
+func TestDepartmentServiceIsolatesTenants(t *testing.T) {
+	f := setupTenants(t)
+
+	departments, err := Department.GetAllDepartments(f.ctx)
+	if err != nil {
+		t.Fatalf("GetAllDepartments: %v", err)
+	}
+	if len(departments) != 1 || departments[0].ID != f.ownDept.ID {
+		t.Fatalf("GetAllDepartments returned %d departments, want only the own tenant's department", len(departments))
+	}
+	tree, err := Department.GetDepartmentTree(f.ctx)
+	if err != nil || len(tree) != 1 || tree[0].ID != f.ownDept.ID {
+		t.Fatalf("GetDepartmentTree = %v, %v; want only the own tenant's department", tree, err)
+	}
+	_, err = Department.GetDepartmentByID(f.ctx, f.otherDept.ID)
+	assertCode(t, err, res.ErrNotFound)
+	subjects, err := Department.GetDepartmentsForSubject(f.ctx, rbac.GetUserID(f.other.ID))
+	if err != nil || len(subjects) != 0 {
+		t.Fatalf("GetDepartmentsForSubject = %v, %v; want no departments from another tenant", subjects, err)
+	}
+
+	_, err = Department.UpdateDepartment(f.ctx, f.otherDept.ID, "Hacked", "", nil)
+	assertCode(t, err, res.ErrNotFound)
+	assertCode(t, Department.DeleteDepartment(f.ctx, f.otherDept.ID), res.ErrNotFound)
+	_, err = Department.CreateDepartment(f.ctx, "Child", "", &f.otherDept.ID)
+	assertCode(t, err, res.ErrInvalidParam)
+	_, err = Department.UpdateDepartment(f.ctx, f.ownDept.ID, "IT", "", &f.otherDept.ID)
+	assertCode(t, err, res.ErrInvalidParam)
+
+	var other rbacModels.Department
+	if err := database.WithoutTenant(database.GetDB()).First(&other, f.otherDept.ID).Error; err != nil {
+		t.Fatalf("other tenant's department was deleted: %v", err)
+	}
+	if other.Name != "IT" {
+		t.Fatalf("other tenant's department renamed to %q", other.Name)
+	}
+	members, err := rbac.GetDepartmentsForUser(rbac.GetUserID(f.other.ID))
+	if err != nil || len(members) != 1 {
+		t.Fatalf("other tenant's membership = %v, %v; want it kept", members, err)
+	}
+}
+
+func TestTenantModelsRequireTenant(t *testing.T) {
+	f := setupTenants(t)
+	db := database.GetDB()
+	var users []models.User
+	var count int64
+	// 上下文中没有租户时，租户数据的查询、更新、删除和新建都被拒绝，而不是作用于所有租户
+	unscoped := map[string]error{
+		"find":       db.Find(&users).Error,
+		"count":      db.Model(&models.User{}).Count(&count).Error,
+		"update":     db.Model(&models.User{}).Where("id = ?", f.other.ID).Update("is_active", false).Error,
+		"delete":     db.Delete(&models.User{}, f.other.ID).Error,
+		"create":     db.Create(&models.User{Username: "carol", Email: "carol@example.com", Password: "-"}).Error,
+		"department": db.Where("name = ?", "IT").Find(&[]rbacModels.Department{}).Error,
+	}
+	for name, err := range unscoped {
+		if !errors.Is(err, database.ErrTenantRequired) {
+			t.Fatalf("%s without a tenant: error = %v, want ErrTenantRequired", name, err)
+		}
+	}
+	if len(users) != 0 || count != 0 {
+		t.Fatalf("query without a tenant returned %d users, count %d", len(users), count)
+	}
+	if other := f.reload(t, f.other.ID); !other.IsActive {
+		t.Fatal("update without a tenant changed another tenant's user")
+	}
+	if _, err := User.GetUserByID(context.Background(), f.own.ID); err == nil {
+		t.Fatal("GetUserByID without a tenant found the user")
+	}
+
+	// 显式跳过隔离时作用于所有租户，不含 tenant_id 的模型不受影响
+	if err := database.WithoutTenant(db).Find(&users).Error; err != nil || len(users) != 2 {
+		t.Fatalf("WithoutTenant found %d users, %v; want 2", len(users), err)
+	}
+	if err := db.Find(&[]rbacModels.Role{}).Error; err != nil {
+		t.Fatalf("query on a model without tenant_id: %v", err)
+	}
+}
+
+func TestMoveUserDropsTimedGrants(t *testing.T) {
+	f := setupTenants(t)
+	createRoles(t, "editor")
+	sub := rbac.GetUserID(f.own.ID)
+	oldDomain := rbac.GetTenantDomain(models.DefaultTenantID)
+	until := time.Now().Add(time.Hour)
+	window := rbac.GrantWindow{ValidUntil: &until}
+	for _, dom := range []string{oldDomain, rbac.AllDomains} {
+		if _, err := rbac.AddRoleForUserWithWindow(sub, "editor", dom, window); err != nil {
+			t.Fatal(err)
+		}
+	}
+	department := rbac.GetDepartmentSubject(f.ownDept.ID)
+	if _, err := rbac.AddDepartmentForUserWithWindow(sub, department, window); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Tenant.MoveUser(f.own.ID, f.other.TenantID); err != nil {
+		t.Fatalf("MoveUser: %v", err)
+	}
+	roles, err := rbac.GetGrantWindows(rbac.RoleRule, [][]string{{sub, "editor", oldDomain}, {sub, "editor", rbac.AllDomains}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	departments, err := rbac.GetGrantWindows(rbac.DepartmentRule, [][]string{{sub, department}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !roles[0].Permanent() || !departments[0].Permanent() {
+		t.Fatalf("windows in the old tenant = %+v, %+v; want removed with the grants", roles[0], departments[0])
+	}
+	// 全局域中的分配保留，有效期随之保留
+	if roles[1].ValidUntil == nil || !roles[1].ValidUntil.Equal(until) {
+		t.Fatalf("global window = %+v, want kept until %v", roles[1], until)
+	}
+}
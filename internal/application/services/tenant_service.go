@@ -0,0 +1,187 @@
+package services
+
+import (
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/res"
+
+	"gorm.io/gorm"
+)
+
+// TenantService 租户管理，每个租户对应Casbin中的一个域
+type TenantService struct{}
+
+var Tenant = &TenantService{}
+
+func (s *TenantService) CreateTenant(name, description string) (*models.Tenant, error) {
+	db := database.WithoutTenant(database.GetDB())
+	var existing models.Tenant
+	if err := db.Where("name = ?", name).First(&existing).Error; err == nil {
+		return nil, res.ErrInvalidParam.WithMessage("租户名称已存在")
+	}
+	tenant := &models.Tenant{
+		Name:        name,
+		Description: description,
+	}
+	if err := db.Create(tenant).Error; err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (s *TenantService) GetAllTenants() ([]*models.Tenant, error) {
+	var tenants []*models.Tenant
+	if err := database.WithoutTenant(database.GetDB()).Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (s *TenantService) GetTenantByID(id uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := database.WithoutTenant(database.GetDB()).First(&tenant, id).Error; err != nil {
+		return nil, res.ErrNotFound.WithMessage("租户不存在")
+	}
+	return &tenant, nil
+}
+
+func (s *TenantService) UpdateTenant(id uint, name, description string) (*models.Tenant, error) {
+	db := database.WithoutTenant(database.GetDB())
+	tenant, err := s.GetTenantByID(id)
+	if err != nil {
+		return nil, err
+	}
+	var existing models.Tenant
+	if err := db.Where("name = ? AND id != ?", name, id).First(&existing).Error; err == nil {
+		return nil, res.ErrInvalidParam.WithMessage("租户名称已存在")
+	}
+	tenant.Name = name
+	tenant.Description = description
+	if err := db.Save(tenant).Error; err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// DeleteTenant 删除租户及其域中的全部策略和角色分配，默认租户和仍有用户或部门的租户不能删除
+func (s *TenantService) DeleteTenant(id uint) error {
+	if id == models.DefaultTenantID {
+		return res.ErrInvalidParam.WithMessage("默认租户不能删除")
+	}
+	return database.WithoutTenant(database.GetDB()).Transaction(func(tx *gorm.DB) error {
+		var tenant models.Tenant
+		if err := tx.First(&tenant, id).Error; err != nil {
+			return res.ErrNotFound.WithMessage("租户不存在")
+		}
+		var count int64
+		if err := tx.Model(&models.User{}).Where("tenant_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return res.ErrInvalidParam.WithMessage("租户下仍有用户，不能删除")
+		}
+		if err := tx.Model(&rbacModels.Department{}).Where("tenant_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return res.ErrInvalidParam.WithMessage("租户下仍有部门，不能删除")
+		}
+		// 硬删除，便于之后重新创建同名租户
+		if err := tx.Unscoped().Delete(&tenant).Error; err != nil {
+			return err
+		}
+		return rbac.DeleteDomain(rbac.GetTenantDomain(id))
+	})
+}
+
+// GetTenantUsers 获取租户下的用户
+func (s *TenantService) GetTenantUsers(id uint) ([]*models.User, error) {
+	if _, err := s.GetTenantByID(id); err != nil {
+		return nil, err
+	}
+	var users []*models.User
+	if err := database.WithoutTenant(database.GetDB()).Where("tenant_id = ?", id).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		user.Password = ""
+	}
+	return users, nil
+}
+
+// MoveUser 将用户移到其他租户，移除用户和其服务账号在原租户域中的角色以及原租户的部门，并使已签发的令牌失效
+// 全局域中的角色分配不受影响
+func (s *TenantService) MoveUser(userID, tenantID uint) error {
+	if _, err := s.GetTenantByID(tenantID); err != nil {
+		return err
+	}
+	db := database.WithoutTenant(database.GetDB())
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return res.ErrUserNotFound
+	}
+	if user.TenantID == tenantID {
+		return nil
+	}
+	oldDomain := rbac.GetTenantDomain(user.TenantID)
+	subjects := []string{rbac.GetUserID(userID)}
+	var keyIDs []uint
+	if err := db.Model(&models.APIKey{}).Where("user_id = ? AND service_account = ?", userID, true).Pluck("id", &keyIDs).Error; err != nil {
+		return err
+	}
+	for _, keyID := range keyIDs {
+		subjects = append(subjects, rbac.GetAPIKeySubject(keyID))
+	}
+	oldTenantID := user.TenantID
+	if err := db.Model(&user).Update("tenant_id", tenantID).Error; err != nil {
+		return err
+	}
+	// Casbin 规则和有效期在租户提交后删除，删除失败时恢复用户的租户；只是通知其他实例失败时继续
+	var notify rbac.NotifyErrors
+	if err := removeTenantGrants(subjects, oldDomain, &notify); err != nil {
+		if rollbackErr := db.Model(&user).Update("tenant_id", oldTenantID).Error; rollbackErr != nil {
+			utils.Log.Errorf("用户租户回滚失败, id=%d: %v", userID, rollbackErr)
+		}
+		return err
+	}
+	if err := Session.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+	return notify.Err()
+}
+
+// removeTenantGrants 删除主体在原租户域中的角色和全部部门关系
+func removeTenantGrants(subjects []string, dom string, notify *rbac.NotifyErrors) error {
+	for _, sub := range subjects {
+		if err := rbac.DeleteSubjectInDomain(sub, dom); notify.Check(err) != nil {
+			return err
+		}
+		departments, err := rbac.GetDepartmentsForUser(sub)
+		if err != nil {
+			return err
+		}
+		for _, department := range departments {
+			if _, err := rbac.DeleteDepartmentForUser(sub, department); notify.Check(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EnsureDefaultTenant 默认租户不存在时创建，用于初始化数据
+func (s *TenantService) EnsureDefaultTenant() error {
+	db := database.WithoutTenant(database.GetDB())
+	tenant := models.Tenant{ID: models.DefaultTenantID, Name: "default", Description: "默认租户"}
+	if err := db.Where(models.Tenant{ID: models.DefaultTenantID}).Attrs(tenant).FirstOrCreate(&tenant).Error; err != nil {
+		return err
+	}
+	// 显式指定ID插入不会推进序列，避免之后创建租户时主键冲突；SQLite 等按最大ID自增，无需处理
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return db.Exec("SELECT setval(pg_get_serial_sequence('tenants', 'id'), (SELECT MAX(id) FROM tenants))").Error
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"gin-starter/config"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenService struct{}
+
+var Token = &TokenService{}
+
+// TokenPair 访问令牌与刷新令牌
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// IssueTokenPair 登录成功后创建会话并签发令牌，会话ID即新的刷新令牌家族
+// mfa 表示本次登录是否通过了双因素认证
+func (s *TokenService) IssueTokenPair(user *models.User, clientIP, userAgent string, mfa bool) (*TokenPair, error) {
+	var pair *TokenPair
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		session, err := Session.CreateSession(tx, user.ID, clientIP, userAgent, mfa)
+		if err != nil {
+			return err
+		}
+		pair, err = s.issue(tx, user, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RefreshTokenPair 使用刷新令牌换取新的令牌对，旧刷新令牌随即失效
+func (s *TokenService) RefreshTokenPair(refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reusedFamily string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&stored).Error; err != nil {
+			return res.ErrInvalidRefresh
+		}
+		if stored.RevokedAt != nil {
+			return res.ErrInvalidRefresh
+		}
+		if stored.UsedAt != nil {
+			// 已轮换的令牌被重放，说明令牌可能泄露
+			reusedFamily = stored.FamilyID
+			return res.ErrRefreshReused
+		}
+		if stored.IsExpired() {
+			return res.ErrTokenExpired
+		}
+
+		var session models.Session
+		if err := tx.Where("id = ?", stored.FamilyID).First(&session).Error; err != nil || !session.IsActive() {
+			return res.ErrInvalidRefresh
+		}
+
+		var user models.User
+		if err := database.WithoutTenant(tx).First(&user, stored.UserID).Error; err != nil {
+			return res.ErrUserNotFound
+		}
+		if !user.IsActive {
+			return res.ErrInvalidRefresh
+		}
+
+		now := time.Now()
+		if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Update("last_used_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issue(tx, &user, &session)
+		return err
+	})
+	if reusedFamily != "" {
+		if revokeErr := Session.revokeSessions(database.GetDB().Where("id = ?", reusedFamily)); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// issue 签发访问令牌并在会话对应的家族中保存新的刷新令牌
+func (s *TokenService) issue(db *gorm.DB, user *models.User, session *models.Session) (*TokenPair, error) {
+	accessToken, accessExpiresAt, err := jwt.GenerateToken(user.ID, user.TenantID, user.Username, session.ID, session.MFA)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().Add(config.GetJWTRefreshTokenTTL())
+	stored := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: refreshExpiresAt,
+	}
+	if err := db.Create(stored).Error; err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// randomToken 生成URL安全的随机令牌
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomHex 生成十六进制随机串
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken 计算令牌摘要，数据库中只保存摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"testing"
+	"time"
+)
+
+// issueTokens 为用户登录并签发令牌对
+func issueTokens(t *testing.T, user *models.User) *TokenPair {
+	t.Helper()
+	pair, err := Token.IssueTokenPair(user, "10.0.0.1", "test", false)
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	return pair
+}
+
+// parseAccess 解析访问令牌的声明
+func parseAccess(t *testing.T, pair *TokenPair) *jwt.Claims {
+	t.Helper()
+	claims, err := jwt.ParseToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	return claims
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	first := issueTokens(t, user)
+
+	second, err := Token.RefreshTokenPair(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokenPair: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh did not rotate the refresh token")
+	}
+	// 轮换后的令牌属于同一个会话
+	if parseAccess(t, second).SessionID != parseAccess(t, first).SessionID {
+		t.Fatal("rotated tokens belong to a different session")
+	}
+	third, err := Token.RefreshTokenPair(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokenPair with the rotated token: %v", err)
+	}
+	if err := Session.ValidateClaims(parseAccess(t, third)); err != nil {
+		t.Fatalf("ValidateClaims: %v", err)
+	}
+
+	_, err = Token.RefreshTokenPair("unknown")
+	assertCode(t, err, res.ErrInvalidRefresh)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	first := issueTokens(t, user)
+	other := issueTokens(t, user)
+	second, err := Token.RefreshTokenPair(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokenPair: %v", err)
+	}
+
+	// 重放已轮换的令牌吊销整个家族，包括合法持有者手中最新的令牌
+	_, err = Token.RefreshTokenPair(first.RefreshToken)
+	assertCode(t, err, res.ErrRefreshReused)
+	_, err = Token.RefreshTokenPair(second.RefreshToken)
+	assertCode(t, err, res.ErrInvalidRefresh)
+	assertCode(t, Session.ValidateClaims(parseAccess(t, second)), res.ErrTokenRevoked)
+
+	var revoked int64
+	database.GetDB().Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", parseAccess(t, first).SessionID).Count(&revoked)
+	if revoked != 0 {
+		t.Fatalf("%d refresh tokens of the reused family still active", revoked)
+	}
+
+	// 同一用户的其他会话不受影响
+	if _, err := Token.RefreshTokenPair(other.RefreshToken); err != nil {
+		t.Fatalf("RefreshTokenPair on another session: %v", err)
+	}
+}
+
+func TestRefreshTokenExpiredOrInactive(t *testing.T) {
+	dbtest.Open(t)
+	user := createUser(t, "alice")
+	expired := issueTokens(t, user)
+	database.GetDB().Model(&models.RefreshToken{}).Where("token_hash = ?", hashToken(expired.RefreshToken)).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	_, err := Token.RefreshTokenPair(expired.RefreshToken)
+	assertCode(t, err, res.ErrTokenExpired)
+
+	active := issueTokens(t, user)
+	if err := Session.RevokeAllSessions(user.ID); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	_, err = Token.RefreshTokenPair(active.RefreshToken)
+	assertCode(t, err, res.ErrInvalidRefresh)
+}
@@ -1,24 +1,30 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"gin-starter/internal/domain/models"
 	"gin-starter/internal/infra/database"
 	"gin-starter/pkg/utils/res"
+	"strconv"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type UserService struct{}
 
 var User = &UserService{}
 
-func (s *UserService) CreateUser(username, email, password string) (*models.User, error) {
-	db := database.GetDB()
+func (s *UserService) CreateUser(ctx context.Context, username, email, password string) (*models.User, error) {
+	db := database.GetDB().WithContext(ctx)
 	var existingUser models.User
-	if err := db.Where("username = ?", username).First(&existingUser).Error; err == nil {
+	// 用户名和邮箱全局唯一，登录时还不知道用户所属的租户
+	global := database.WithoutTenant(db)
+	if err := global.Where("username = ?", username).First(&existingUser).Error; err == nil {
 		return nil, res.ErrUsernameTaken
 	}
-	if err := db.Where("email = ?", email).First(&existingUser).Error; err == nil {
+	if err := global.Where("email = ?", email).First(&existingUser).Error; err == nil {
 		return nil, res.ErrEmailAlreadyUsed
 	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -34,14 +40,20 @@ func (s *UserService) CreateUser(username, email, password string) (*models.User
 	if err := db.Create(user).Error; err != nil {
 		return nil, err
 	}
+	Account.sendEmailVerificationAsync(user.ID)
 	user.Password = ""
 	return user, nil
 }
 
-func (s *UserService) GetAllUsers() ([]*models.User, error) {
-	db := database.GetDB()
+// GetAllUsers 获取当前租户中操作者的数据范围内可见的用户
+func (s *UserService) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	scope, err := DataScope.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := database.GetDB().WithContext(ctx)
 	var users []*models.User
-	if err := db.Find(&users).Error; err != nil {
+	if err := db.Scopes(scope).Find(&users).Error; err != nil {
 		return nil, err
 	}
 	for _, user := range users {
@@ -50,8 +62,8 @@ func (s *UserService) GetAllUsers() ([]*models.User, error) {
 	return users, nil
 }
 
-func (s *UserService) GetUserByID(id uint) (*models.User, error) {
-	db := database.GetDB()
+func (s *UserService) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	db := database.GetDB().WithContext(ctx)
 	var user models.User
 	if err := db.First(&user, id).Error; err != nil {
 		return nil, res.ErrUserNotFound
@@ -60,17 +72,38 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-func (s *UserService) UpdateUser(id uint, username, email string) (*models.User, error) {
-	db := database.GetDB()
+// ObjectAttributes 条件策略中 /users/:id 资源的属性，用户不存在或不在当前租户时返回空属性
+func (s *UserService) ObjectAttributes(ctx context.Context, params map[string]string) (map[string]any, error) {
+	id, err := strconv.ParseUint(params["id"], 10, 32)
+	if err != nil {
+		return nil, nil
+	}
+	var user models.User
+	if err := database.GetDB().WithContext(ctx).Select("id", "tenant_id", "is_active").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return map[string]any{
+		"id":        user.ID,
+		"tenant_id": user.TenantID,
+		"is_active": user.IsActive,
+	}, nil
+}
+
+func (s *UserService) UpdateUser(ctx context.Context, id uint, username, email string) (*models.User, error) {
+	db := database.GetDB().WithContext(ctx)
 	var user models.User
 	if err := db.First(&user, id).Error; err != nil {
 		return nil, res.ErrUserNotFound
 	}
 	var existingUser models.User
-	if err := db.Where("username = ? AND id != ?", username, id).First(&existingUser).Error; err == nil {
+	global := database.WithoutTenant(db)
+	if err := global.Where("username = ? AND id != ?", username, id).First(&existingUser).Error; err == nil {
 		return nil, res.ErrUsernameTaken
 	}
-	if err := db.Where("email = ? AND id != ?", email, id).First(&existingUser).Error; err == nil {
+	if err := global.Where("email = ? AND id != ?", email, id).First(&existingUser).Error; err == nil {
 		return nil, res.ErrEmailAlreadyUsed
 	}
 	user.Username = username
@@ -82,54 +115,93 @@ func (s *UserService) UpdateUser(id uint, username, email string) (*models.User,
 	return &user, nil
 }
 
-func (s *UserService) DeleteUser(id uint) error {
-	db := database.GetDB()
-	return db.Delete(&models.User{}, id).Error
+func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
+	db := database.GetDB().WithContext(ctx)
+	result := db.Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return res.ErrUserNotFound
+	}
+	Session.InvalidateUser(id)
+	return Session.RevokeAllSessions(id)
 }
 
-func (s *UserService) ActivateUser(id uint) error {
-	db := database.GetDB()
+func (s *UserService) ActivateUser(ctx context.Context, id uint) error {
+	db := database.GetDB().WithContext(ctx)
 	var user models.User
 	if err := db.First(&user, id).Error; err != nil {
 		return res.ErrUserNotFound
 	}
 	user.IsActive = true
-	return db.Save(&user).Error
+	if err := db.Save(&user).Error; err != nil {
+		return err
+	}
+	Session.InvalidateUser(id)
+	return nil
 }
 
-func (s *UserService) DeactivateUser(id uint) error {
-	db := database.GetDB()
+func (s *UserService) DeactivateUser(ctx context.Context, id uint) error {
+	db := database.GetDB().WithContext(ctx)
 	var user models.User
 	if err := db.First(&user, id).Error; err != nil {
 		return res.ErrUserNotFound
 	}
 	user.IsActive = false
-	return db.Save(&user).Error
+	if err := db.Save(&user).Error; err != nil {
+		return err
+	}
+	Session.InvalidateUser(id)
+	return Session.RevokeAllSessions(id)
 }
 
-func (s *UserService) ChangeEmail(id uint, email string) error {
-	db := database.GetDB()
+func (s *UserService) ChangeEmail(ctx context.Context, id uint, email string) error {
+	db := database.GetDB().WithContext(ctx)
 	var user models.User
 	if err := db.First(&user, id).Error; err != nil {
 		return res.ErrUserNotFound
 	}
 	var existingUser models.User
-	if err := db.Where("email = ? AND id != ?", email, id).First(&existingUser).Error; err == nil {
+	if err := database.WithoutTenant(db).Where("email = ? AND id != ?", email, id).First(&existingUser).Error; err == nil {
 		return res.ErrEmailAlreadyUsed
 	}
-	user.Email = email
-	return db.Save(&user).Error
+	if err := user.ChangeEmail(email); err != nil {
+		return res.ErrInvalidParam.WithMessage(err.Error())
+	}
+	if err := db.Model(&user).Update("pending_email", user.PendingEmail).Error; err != nil {
+		return err
+	}
+	return Account.SendEmailVerification(id)
 }
 
-func (s *UserService) AuthenticateUser(username, password string) (*models.User, error) {
-	db := database.GetDB()
-	var user models.User
-	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, res.ErrInvalidCredentials
+// AuthenticateUser 通过配置的认证后端校验用户名和密码，连续失败会锁定用户名和客户端IP
+func (s *UserService) AuthenticateUser(username, password, clientIP string) (*models.User, error) {
+	if err := Lockout.Check(username, clientIP); err != nil {
+		return nil, err
+	}
+	user, err := authenticate(username, password)
+	if errors.Is(err, res.ErrInvalidCredentials) {
+		return nil, s.loginFailed(username, clientIP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 密码正确后才提示停用，避免泄露账号状态
+	if !user.IsActive {
+		return nil, res.ErrUserInactive
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, res.ErrInvalidCredentials
+	if err := Lockout.RecordSuccess(username); err != nil {
+		return nil, err
 	}
 	user.Password = ""
-	return &user, nil
+	return user, nil
+}
+
+// loginFailed 记录登录失败并返回凭据错误
+func (s *UserService) loginFailed(username, clientIP string) error {
+	if err := Lockout.RecordFailure(username, clientIP); err != nil {
+		return err
+	}
+	return res.ErrInvalidCredentials
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// ActionToken 一次性操作令牌记录
+// 令牌本身是带签名的JWT，这里只记录 jti 以保证令牌只能使用一次
+type ActionToken struct {
+	JTI       string    `gorm:"column:jti;type:varchar(64);primaryKey" json:"jti"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Purpose   string     `gorm:"type:varchar(32);index;not null" json:"purpose"`
+	Email     string     `gorm:"type:varchar(100)" json:"email"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	// Attempts 输错验证码的次数，仅用于双因素认证挑战令牌
+	Attempts int `gorm:"not null;default:0" json:"attempts"`
+}
+
+// TableName 指定表名
+func (ActionToken) TableName() string {
+	return "action_tokens"
+}
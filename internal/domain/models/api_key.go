@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKeyPrefix API密钥的固定前缀，便于识别和扫描泄露
+const APIKeyPrefix = "gsk"
+
+// APIKey 个人API密钥模型
+// 完整密钥形如 gsk_<Prefix>_<secret>，数据库只保存 Prefix 和 secret 的摘要
+type APIKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID         uint       `gorm:"index;not null" json:"user_id"`
+	Name           string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix         string     `gorm:"type:varchar(16);uniqueIndex;not null" json:"prefix"`
+	SecretHash     string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes         []string   `gorm:"serializer:json" json:"scopes"`                 // 允许访问的范围，形如 "GET /users/*"
+	ServiceAccount bool       `gorm:"not null;default:false" json:"service_account"` // 为 true 时使用独立的Casbin主体，而非所属用户
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsActive 密钥是否仍然有效
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
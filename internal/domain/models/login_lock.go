@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginLock 登录失败记录，按用户名和客户端IP分别统计
+// Key 形如 "user:alice" 或 "ip:10.0.0.1"
+type LoginLock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Key          string     `gorm:"type:varchar(128);uniqueIndex;not null" json:"key"`
+	Failures     int        `gorm:"not null;default:0" json:"failures"`   // 当前窗口内的连续失败次数
+	LockCount    int        `gorm:"not null;default:0" json:"lock_count"` // 已锁定次数，决定下次锁定时长
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+// TableName 指定表名
+func (LoginLock) TableName() string {
+	return "login_locks"
+}
+
+// IsLocked 当前是否处于锁定状态
+func (l *LoginLock) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
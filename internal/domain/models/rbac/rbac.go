@@ -1,23 +1,37 @@
 package rbac
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 // Role 角色模型
 type Role struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"uniqueIndex;size:50;not null" json:"name"`
-	Description string         `gorm:"size:255" json:"description"`
-	CreatedAt   int64          `json:"created_at"`
-	UpdatedAt   int64          `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID                     uint           `gorm:"primaryKey" json:"id"`
+	Name                   string         `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Description            string         `gorm:"size:255" json:"description"`
+	DataScope              string         `gorm:"size:20;not null;default:self" json:"data_scope"`  // 数据范围，见 DataScope 常量，默认仅本人
+	DataScopeDepartmentIDs []uint         `gorm:"serializer:json" json:"data_scope_department_ids"` // 数据范围为 custom 时可见的部门
+	CreatedAt              int64          `json:"created_at"`
+	UpdatedAt              int64          `json:"updated_at"`
+	DeletedAt              gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// 角色的数据范围，决定持有该角色的用户在列表查询中能看到哪些用户
+const (
+	DataScopeAll             = "all"               // 全部数据
+	DataScopeDept            = "dept"              // 本部门
+	DataScopeDeptAndChildren = "dept_and_children" // 本部门及下级部门
+	DataScopeSelf            = "self"              // 仅本人
+	DataScopeCustom          = "custom"            // 自定义部门
+)
+
 // Department 部门模型
 type Department struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	TenantID    uint           `gorm:"uniqueIndex:idx_departments_tenant_name;not null;default:1" json:"tenant_id"` // 所属租户，部门名称在租户内唯一
+	Name        string         `gorm:"uniqueIndex:idx_departments_tenant_name;size:50;not null" json:"name"`
 	Description string         `gorm:"size:255" json:"description"`
 	ParentID    *uint          `gorm:"index" json:"parent_id,omitempty"` // 父部门ID，支持树形结构
 	CreatedAt   int64          `json:"created_at"`
@@ -40,3 +54,16 @@ type Permission struct {
 	UpdatedAt   int64          `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
+
+// TimedGrant 有时限的角色或部门分配，对应一条 g 或 g2 规则，没有记录的分配长期有效
+type TimedGrant struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Ptype      string     `gorm:"uniqueIndex:idx_timed_grants_rule;size:10;not null" json:"ptype"`    // g 或 g2
+	Subject    string     `gorm:"uniqueIndex:idx_timed_grants_rule;size:100;not null" json:"subject"` // 用户ID、API密钥等主体
+	Target     string     `gorm:"uniqueIndex:idx_timed_grants_rule;size:100;not null" json:"target"`  // 角色名称或部门主体
+	Domain     string     `gorm:"uniqueIndex:idx_timed_grants_rule;size:100;not null" json:"domain"`  // 角色分配所在的域，部门分配为空
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`                                               // 生效时间，为空时立即生效
+	ValidUntil *time.Time `gorm:"index" json:"valid_until,omitempty"`                                 // 失效时间，为空时不失效
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌模型
+// 同一次登录派生出的令牌属于同一个家族(FamilyID)，每次刷新都会轮换出新令牌，
+// 已使用的令牌被再次提交时视为泄露，整个家族会被吊销
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"type:varchar(64);index;not null" json:"family_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TableName 指定表名
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// IsExpired 是否已过期
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
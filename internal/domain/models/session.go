@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// Session 登录会话模型
+// 每次登录创建一个会话，ID 与刷新令牌家族(FamilyID)一致，访问令牌通过 sid 声明关联会话
+type Session struct {
+	ID         string    `gorm:"type:varchar(64);primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	ClientIP  string     `gorm:"type:varchar(64)" json:"client_ip"`
+	UserAgent string     `gorm:"type:varchar(255)" json:"user_agent"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	MFA       bool       `gorm:"column:mfa;default:false" json:"mfa"` // 会话是否通过了双因素认证
+}
+
+// TableName 指定表名
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive 会话是否仍然有效
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RevokedToken 已吊销的访问令牌
+// 只需保留到令牌自身过期为止
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;type:varchar(64);primaryKey" json:"jti"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+}
+
+// TableName 指定表名
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenantID 默认租户，升级前的数据和未指定租户的新用户都归属该租户
+const DefaultTenantID uint = 1
+
+// Tenant 租户，即部署中托管的一个客户组织
+type Tenant struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	Name        string `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string `gorm:"type:varchar(255)" json:"description"`
+}
+
+// TableName 指定表名
+func (Tenant) TableName() string {
+	return "tenants"
+}
@@ -20,6 +20,15 @@ type User struct {
 	Password string `gorm:"type:varchar(255);not null" json:"-" binding:"required,min=6,max=100"`
 	FullName string `gorm:"type:varchar(100)" json:"full_name" binding:"max=100"`
 	IsActive bool   `gorm:"default:true" json:"is_active"`
+	TenantID uint   `gorm:"index;not null;default:1" json:"tenant_id"` // 所属租户，默认为 DefaultTenantID
+
+	EmailVerified   bool       `gorm:"default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	PendingEmail    string     `gorm:"type:varchar(100);index" json:"pending_email,omitempty"` // 待验证的新邮箱
+
+	MFAEnabled  bool   `gorm:"column:mfa_enabled;default:false" json:"mfa_enabled"`
+	MFASecret   string `gorm:"column:mfa_secret;type:varchar(64)" json:"-"` // TOTP密钥，确认前为待绑定状态
+	MFALastStep int64  `gorm:"column:mfa_last_step;default:0" json:"-"`     // 最近一次使用的时间步，防止验证码重放
 }
 
 // TableName 指定表名
@@ -101,7 +110,7 @@ func (u *User) UpdateProfile(fullName string) {
 	u.FullName = fullName
 }
 
-// ChangeEmail 更改邮箱
+// ChangeEmail 更改邮箱，新邮箱在验证通过前处于待验证状态
 func (u *User) ChangeEmail(email string) error {
 	if email == "" {
 		return errors.New("邮箱不能为空")
@@ -111,7 +120,23 @@ func (u *User) ChangeEmail(email string) error {
 		return errors.New("邮箱格式不正确")
 	}
 
-	u.Email = email
+	u.PendingEmail = email
+	return nil
+}
+
+// ConfirmEmail 确认邮箱验证，待验证的新邮箱在此时生效
+func (u *User) ConfirmEmail(email string) error {
+	switch email {
+	case u.PendingEmail:
+		u.Email = u.PendingEmail
+		u.PendingEmail = ""
+	case u.Email:
+	default:
+		return errors.New("邮箱已变更，请重新验证")
+	}
+	now := time.Now()
+	u.EmailVerified = true
+	u.EmailVerifiedAt = &now
 	return nil
 }
 
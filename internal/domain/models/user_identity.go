@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity 外部身份提供方账号与本地用户的关联
+// 同一身份提供方内由 Issuer + Subject 唯一确定一个外部账号
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID  uint   `gorm:"index;not null" json:"user_id"`
+	Issuer  string `gorm:"type:varchar(255);uniqueIndex:idx_identity_issuer_subject;not null" json:"issuer"`
+	Subject string `gorm:"type:varchar(255);uniqueIndex:idx_identity_issuer_subject;not null" json:"subject"`
+	Email   string `gorm:"type:varchar(100)" json:"email"`
+}
+
+// TableName 指定表名
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -34,6 +34,10 @@ func InitDatabase() {
 	if err != nil {
 		utils.Log.Fatalf("数据库连接失败: %v", err)
 	}
+	// 按请求上下文中的租户隔离数据
+	if err := DB.Use(TenantPlugin{}); err != nil {
+		utils.Log.Fatalf("租户隔离插件注册失败: %v", err)
+	}
 
 	// 获取通用数据库对象 sql.DB 以设置连接池
 	sqlDB, err := DB.DB()
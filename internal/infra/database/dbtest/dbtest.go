@@ -0,0 +1,96 @@
+// Package dbtest 为测试提供基于 SQLite 或 PostgreSQL 的全局数据库
+package dbtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"gin-starter/config"
+	"gin-starter/internal/infra/database"
+	"gin-starter/pkg/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// PostgresDSNEnv PostgreSQL 测试数据库连接字符串的环境变量，未设置时跳过需要 PostgreSQL 的测试
+const PostgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// Open 使用默认配置初始化日志，打开临时的 SQLite 数据库作为全局数据库，并迁移表结构
+// 数据库注册了与生产环境相同的租户隔离插件，测试结束时关闭
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	return use(t, sqlite.Open(dsn))
+}
+
+// OpenPostgres 在 PostgreSQL 中创建临时 schema 作为全局数据库并迁移表结构，测试结束时删除
+// 用于 LISTEN/NOTIFY 等 SQLite 不支持的功能，环境变量 TEST_POSTGRES_DSN 未设置时跳过测试
+func OpenPostgres(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("未设置 %s，跳过 PostgreSQL 测试", PostgresDSNEnv)
+	}
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("解析 %s 失败: %v", PostgresDSNEnv, err)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	schema := pgx.Identifier{"test_" + hex.EncodeToString(b)}.Sanitize()
+	admin := stdlib.OpenDB(*cfg)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("创建测试 schema 失败: %v", err)
+	}
+	// 先注册的清理后执行，全局数据库关闭后再删除 schema
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("删除测试 schema 失败: %v", err)
+		}
+		admin.Close()
+	})
+	cfg.RuntimeParams["search_path"] = schema
+	return use(t, postgres.New(postgres.Config{Conn: stdlib.OpenDB(*cfg)}))
+}
+
+// use 打开数据库作为全局数据库，注册租户隔离插件并迁移表结构
+func use(t testing.TB, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	if config.AppConfig == nil {
+		config.Init(t.TempDir())
+	}
+	if utils.Log == nil {
+		// 测试中只输出到控制台
+		logConfig := config.AppConfig.Log
+		logConfig.Enabled = false
+		if err := utils.SetupLogging(logConfig); err != nil {
+			t.Fatalf("日志初始化失败: %v", err)
+		}
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.Use(database.TenantPlugin{}); err != nil {
+		t.Fatalf("租户隔离插件注册失败: %v", err)
+	}
+	database.DB = db
+	database.AutoMigrate()
+	t.Cleanup(func() {
+		database.DB = nil
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -4,6 +4,7 @@ import (
 	"gin-starter/internal/domain/models"
 	"gin-starter/internal/domain/models/rbac"
 	"log"
+	"strings"
 
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 )
@@ -14,18 +15,41 @@ func AutoMigrate() {
 		log.Fatal("数据库未初始化")
 	}
 
+	// 必须在表结构迁移修改列的默认值之前执行
+	if err := migrateRoleDataScopeDefault(); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+
 	// 添加需要迁移的模型
 	// 注意：Casbin 使用自己的表来管理用户-角色关系和角色-权限关系
 	err := DB.AutoMigrate(
+		&models.Tenant{}, // 租户表
 		&models.User{},
-		&rbac.Role{},       // 角色表
-		&rbac.Department{}, // 部门表
+		&models.RefreshToken{}, // 刷新令牌表
+		&models.Session{},      // 登录会话表
+		&models.RevokedToken{}, // 已吊销访问令牌表
+		&models.ActionToken{},  // 一次性操作令牌表
+		&models.RecoveryCode{}, // 双因素认证恢复码表
+		&models.LoginLock{},    // 登录失败锁定表
+		&models.APIKey{},       // API密钥表
+		&models.UserIdentity{}, // 外部身份关联表
+		&rbac.Role{},           // 角色表
+		&rbac.Department{},     // 部门表
+		&rbac.Permission{},     // 权限表
+		&rbac.TimedGrant{},     // 有时限的角色和部门分配表
 	)
 
 	if err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
 
+	// 部门名称改为在租户内唯一，移除旧版本的全局唯一索引
+	if DB.Migrator().HasIndex(&rbac.Department{}, "idx_departments_name") {
+		if err := DB.Migrator().DropIndex(&rbac.Department{}, "idx_departments_name"); err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
+	}
+
 	// 使用Casbin官方适配器创建表
 	// gorm-adapter 会在首次使用时自动创建所需的表
 	_, err = gormadapter.NewAdapterByDB(DB)
@@ -35,3 +59,29 @@ func AutoMigrate() {
 
 	log.Println("数据库迁移完成")
 }
+
+// migrateRoleDataScopeDefault 角色数据范围的默认值由 all 改为 self，旧版本的角色按默认值得到 all，一并改为 self
+// 以列的默认值判断是否已经迁移，再次执行不会覆盖之后重新设置为 all 的角色
+func migrateRoleDataScopeDefault() error {
+	if !DB.Migrator().HasColumn(&rbac.Role{}, "data_scope") {
+		return nil
+	}
+	columns, err := DB.Migrator().ColumnTypes(&rbac.Role{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if column.Name() != "data_scope" {
+			continue
+		}
+		// PostgreSQL 返回的默认值可能带有引号和类型转换，如 'all'::character varying
+		value, ok := column.DefaultValue()
+		value, _, _ = strings.Cut(value, "::")
+		if !ok || strings.Trim(value, "'") != rbac.DataScopeAll {
+			return nil
+		}
+		return DB.Unscoped().Model(&rbac.Role{}).Where("data_scope = ?", rbac.DataScopeAll).
+			UpdateColumn("data_scope", rbac.DataScopeSelf).Error
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantContextKey 上下文中租户ID的键
+type tenantContextKey struct{}
+
+// skipTenantKey 跳过租户隔离的会话设置
+const skipTenantKey = "tenant:skip"
+
+// tenantColumn 租户隔离使用的列，模型包含该列时才会被隔离
+const tenantColumn = "tenant_id"
+
+// ErrTenantRequired 操作租户数据时上下文中没有租户，也没有通过 WithoutTenant 显式跳过隔离
+var ErrTenantRequired = errors.New("tenant-scoped query without a tenant: use WithTenant or WithoutTenant")
+
+// WithTenant 返回携带租户ID的上下文
+// 通过 GetDB().WithContext(ctx) 执行的查询、更新和删除只作用于该租户的数据，新建的记录归属该租户
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext 获取上下文中的租户ID
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(tenantContextKey{}).(uint)
+	return tenantID, ok && tenantID != 0
+}
+
+// WithoutTenant 跳过租户隔离，用于用户名、邮箱等全局唯一字段的校验以及登录、迁移、后台同步等跨租户的操作，返回的实例可以重复使用
+func WithoutTenant(db *gorm.DB) *gorm.DB {
+	return db.Set(skipTenantKey, true).Session(&gorm.Session{})
+}
+
+// TenantPlugin 按上下文中的租户自动隔离数据的GORM插件
+// 只作用于包含 tenant_id 列的模型，上下文中没有租户时返回 ErrTenantRequired，不会执行不受限制的语句；
+// 确实需要跨租户时（如迁移、后台同步、登录）使用 WithoutTenant；原生SQL不受影响
+type TenantPlugin struct{}
+
+func (TenantPlugin) Name() string {
+	return "tenant"
+}
+
+func (TenantPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Create().Before("gorm:create").Register("tenant:stamp", stampTenant); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("tenant:scope", scopeTenant); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("tenant:scope", scopeUpdate); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("tenant:scope", scopeTenant); err != nil {
+		return err
+	}
+	return callback.Row().Before("gorm:row").Register("tenant:scope", scopeTenant)
+}
+
+// currentTenant 当前语句需要隔离时返回租户ID，需要隔离但上下文中没有租户时为语句设置 ErrTenantRequired
+func currentTenant(db *gorm.DB) (uint, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return 0, false
+	}
+	if skip, ok := db.Get(skipTenantKey); ok && skip == true {
+		return 0, false
+	}
+	if _, ok := db.Statement.Schema.FieldsByDBName[tenantColumn]; !ok {
+		return 0, false
+	}
+	tenantID, ok := TenantFromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrTenantRequired)
+	}
+	return tenantID, ok
+}
+
+// tenantCondition 当前表属于租户的条件
+func tenantCondition(db *gorm.DB, tenantID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: tenantColumn}, Value: tenantID}
+}
+
+// scopeTenant 查询和删除只作用于当前租户的数据
+func scopeTenant(db *gorm.DB) {
+	if tenantID, ok := currentTenant(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{tenantCondition(db, tenantID)}})
+	}
+}
+
+// scopeUpdate 更新只作用于当前租户的数据，且不能修改数据所属的租户
+func scopeUpdate(db *gorm.DB) {
+	if tenantID, ok := currentTenant(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{tenantCondition(db, tenantID)}})
+		db.Statement.Omits = append(db.Statement.Omits, tenantColumn)
+	}
+}
+
+// stampTenant 新建的记录归属当前租户，覆盖调用方设置的租户
+// Save 等产生的 ON CONFLICT DO UPDATE 只能更新当前租户已有的记录
+func stampTenant(db *gorm.DB) {
+	tenantID, ok := currentTenant(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.FieldsByDBName[tenantColumn]
+	ctx := db.Statement.Context
+	switch value := db.Statement.ReflectValue; value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := field.Set(ctx, reflect.Indirect(value.Index(i)), tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(ctx, value, tenantID); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+	if values, ok := db.Statement.Dest.(map[string]any); ok {
+		values[tenantColumn] = tenantID
+	}
+
+	if c, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, tenantCondition(db, tenantID))
+			c.Expression = onConflict
+			db.Statement.Clauses["ON CONFLICT"] = c
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"gin-starter/config"
+	"gin-starter/pkg/utils"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 邮件内容
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Bytes 按 RFC 5322 格式编码邮件
+func (m *Message) Bytes(from string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(m.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// SSL 为 true 时使用隐式TLS（通常为465端口），否则在服务器支持时使用 STARTTLS
+	SSL bool
+}
+
+// Send 发送邮件
+func (m *SMTPMailer) Send(msg *Message) error {
+	addr := net.JoinHostPort(m.Host, m.Port)
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	if !m.SSL {
+		return smtp.SendMail(addr, auth, m.From, msg.To, msg.Bytes(m.From))
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: m.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(m.From)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// FileMailer 将邮件写入目录，便于本地开发时查看
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send 保存邮件为 .eml 文件
+func (m *FileMailer) Send(msg *Message) error {
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), strings.Join(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.Bytes(m.From), 0644)
+}
+
+// MemoryMailer 将邮件保存在内存中，用于测试
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send 记录邮件
+func (m *MemoryMailer) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages 获取已发送的邮件
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset 清空已发送的邮件
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+var mailer Mailer = &MemoryMailer{}
+
+// InitMail 根据配置初始化邮件发送器
+func InitMail() {
+	if config.AppConfig == nil {
+		utils.Log.Fatal("配置未初始化")
+	}
+	cfg := config.AppConfig.Mail
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.Host == "" || cfg.From == "" {
+			utils.Log.Fatalf("邮件初始化失败，SMTP参数缺失")
+		}
+		mailer = &SMTPMailer{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			From:     cfg.From,
+			SSL:      cfg.SSL,
+		}
+	case "file":
+		mailer = &FileMailer{Dir: cfg.Dir, From: cfg.From}
+	case "memory":
+		mailer = &MemoryMailer{}
+	default:
+		utils.Log.Fatalf("不支持的邮件驱动: %s", cfg.Driver)
+	}
+	utils.Log.Infof("邮件服务初始化完成，驱动: %s", cfg.Driver)
+}
+
+// SetMailer 替换邮件发送器
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+// GetMailer 获取邮件发送器
+func GetMailer() Mailer {
+	return mailer
+}
+
+// Send 发送邮件
+func Send(msg *Message) error {
+	return mailer.Send(msg)
+}
@@ -0,0 +1,12 @@
+package dto
+
+import "time"
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name           string     `json:"name" binding:"required,min=1,max=100"`
+	Scopes         []string   `json:"scopes" binding:"max=20"` // 形如 "GET /users/*"，为空时不限制
+	ExpiresAt      *time.Time `json:"expires_at"`              // 为空时永不过期
+	ServiceAccount bool       `json:"service_account"`         // 使用独立的Casbin主体
+	Roles          []string   `json:"roles" binding:"max=20"`  // 服务账号的角色
+}
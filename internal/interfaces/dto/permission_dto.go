@@ -0,0 +1,22 @@
+package dto
+
+// CreatePermissionRequest 创建权限请求
+type CreatePermissionRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=100"`
+	Resource    string `json:"resource" binding:"required,max=100"`
+	Action      string `json:"action" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// UpdatePermissionRequest 更新权限请求
+type UpdatePermissionRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=100"`
+	Resource    string `json:"resource" binding:"required,max=100"`
+	Action      string `json:"action" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// GrantPermissionsRequest 授予命名权限请求
+type GrantPermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required,min=1,dive,required"`
+}
@@ -0,0 +1,19 @@
+package dto
+
+// CreateRoleRequest 创建角色请求
+type CreateRoleRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// UpdateRoleRequest 更新角色请求
+type UpdateRoleRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// SetDataScopeRequest 设置角色数据范围请求
+type SetDataScopeRequest struct {
+	DataScope     string `json:"data_scope" binding:"required,oneof=all dept dept_and_children self custom"`
+	DepartmentIDs []uint `json:"department_ids" binding:"required_if=DataScope custom"` // 数据范围为 custom 时可见的部门
+}
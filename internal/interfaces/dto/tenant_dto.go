@@ -0,0 +1,13 @@
+package dto
+
+// CreateTenantRequest 创建租户请求
+type CreateTenantRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// UpdateTenantRequest 更新租户请求
+type UpdateTenantRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"gin-starter/internal/application/services"
+	"gin-starter/internal/interfaces/dto"
+	"gin-starter/internal/interfaces/vo"
+	"gin-starter/pkg/utils/converter"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyHandler() *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: services.APIKey,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary 创建API密钥
+// @Description 为当前用户创建API密钥，完整密钥只在创建时返回一次
+// @Tags API密钥
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateAPIKeyRequest true "创建API密钥请求"
+// @Success 200 {object} res.Response{data=vo.CreateAPIKeyResponse} "创建成功"
+// @Router /users/api-keys [post]
+// @Security Bearer
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	userID := c.MustGet("user_id").(uint)
+
+	key, raw, err := h.apiKeyService.Create(userID, services.CreateAPIKeyInput{
+		Name:           req.Name,
+		Scopes:         req.Scopes,
+		ExpiresAt:      req.ExpiresAt,
+		ServiceAccount: req.ServiceAccount,
+		Roles:          req.Roles,
+	})
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	var keyVO vo.APIKeyVO
+	converter.SafeConvert(&keyVO, key)
+	SuccessWithMessage(c, "API密钥创建成功，请妥善保存", vo.CreateAPIKeyResponse{APIKeyVO: keyVO, Key: raw})
+}
+
+// GetAPIKeys godoc
+// @Summary 获取API密钥
+// @Description 获取当前用户的API密钥列表
+// @Tags API密钥
+// @Produce json
+// @Success 200 {object} res.Response{data=[]vo.APIKeyVO} "获取成功"
+// @Router /users/api-keys [get]
+// @Security Bearer
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	keys, err := h.apiKeyService.List(userID)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	keyVOs := make([]vo.APIKeyVO, 0, len(keys))
+	converter.SafeConvertSlice(&keyVOs, keys)
+	Success(c, keyVOs)
+}
+
+// RevokeAPIKey godoc
+// @Summary 吊销API密钥
+// @Description 吊销当前用户的指定API密钥
+// @Tags API密钥
+// @Produce json
+// @Param key_id path int true "API密钥ID"
+// @Success 200 {object} res.Response "吊销成功"
+// @Router /users/api-keys/{key_id} [delete]
+// @Security Bearer
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.ParseUint(c.Param("key_id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的API密钥ID")
+		return
+	}
+	userID := c.MustGet("user_id").(uint)
+
+	if err := h.apiKeyService.Revoke(userID, uint(keyID)); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "API密钥已吊销", nil)
+}
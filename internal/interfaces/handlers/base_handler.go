@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"gin-starter/internal/interfaces/validators"
 	"gin-starter/internal/middleware"
 	"gin-starter/pkg/utils/res"
@@ -48,13 +49,21 @@ func SuccessWithMessage(c *gin.Context, message string, data any) {
 	res.SuccessWithMessage(c, message, data)
 }
 
-// Error 返回错误响应
+// Error 返回错误响应，业务异常保留其错误码
 func Error(c *gin.Context, err error) {
+	var businessErr *res.BusinessError
+	if errors.As(err, &businessErr) {
+		businessErr.ThrowWithMessage(c, businessErr.Message)
+		return
+	}
 	res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 }
 
-// Bind 绑定并验证请求
+// Bind 绑定并验证请求，已由 BindRequest 中间件绑定时直接复用
 func Bind(c *gin.Context, req any) error {
+	if middleware.GetRequest(c, req) {
+		return nil
+	}
 	if err := c.ShouldBindJSON(req); err != nil {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return err
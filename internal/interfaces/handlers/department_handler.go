@@ -37,7 +37,7 @@ func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	department, err := h.departmentService.CreateDepartment(req.Name, req.Description, req.ParentID)
+	department, err := h.departmentService.CreateDepartment(c.Request.Context(), req.Name, req.Description, req.ParentID)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -54,7 +54,7 @@ func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
 // @Router /departments [get]
 // @Security Bearer
 func (h *DepartmentHandler) GetAllDepartments(c *gin.Context) {
-	departments, err := h.departmentService.GetAllDepartments()
+	departments, err := h.departmentService.GetAllDepartments(c.Request.Context())
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -78,7 +78,7 @@ func (h *DepartmentHandler) GetDepartment(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, "无效的部门ID")
 		return
 	}
-	department, err := h.departmentService.GetDepartmentByID(uint(id))
+	department, err := h.departmentService.GetDepartmentByID(c.Request.Context(), uint(id))
 	if err != nil {
 		res.ErrNotFound.ThrowWithMessage(c, "部门不存在")
 		return
@@ -108,7 +108,7 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	department, err := h.departmentService.UpdateDepartment(uint(id), req.Name, req.Description, req.ParentID)
+	department, err := h.departmentService.UpdateDepartment(c.Request.Context(), uint(id), req.Name, req.Description, req.ParentID)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -135,7 +135,7 @@ func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, "无效的部门ID")
 		return
 	}
-	err = h.departmentService.DeleteDepartment(uint(id))
+	err = h.departmentService.DeleteDepartment(c.Request.Context(), uint(id))
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -152,7 +152,7 @@ func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
 // @Router /departments/tree [get]
 // @Security Bearer
 func (h *DepartmentHandler) GetDepartmentTree(c *gin.Context) {
-	departments, err := h.departmentService.GetDepartmentTree()
+	departments, err := h.departmentService.GetDepartmentTree(c.Request.Context())
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"gin-starter/pkg/utils/jwt"
+	"gin-starter/pkg/utils/res"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct{}
+
+func NewJWKSHandler() *JWKSHandler {
+	return &JWKSHandler{}
+}
+
+// GetJWKS godoc
+// @Summary 获取JWT公钥集合
+// @Description 以标准 JWKS 格式返回用于校验访问令牌的公钥，供其他服务离线校验令牌
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} jwt.JWKSet "公钥集合"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	jwks, err := jwt.GetJWKS()
+	if err != nil {
+		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwt.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, jwks)
+}
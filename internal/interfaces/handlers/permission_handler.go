@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"gin-starter/internal/application/services"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/interfaces/dto"
+	"gin-starter/internal/interfaces/vo"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionHandler struct {
+	permissionService *services.PermissionService
+}
+
+func NewPermissionHandler() *PermissionHandler {
+	return &PermissionHandler{
+		permissionService: services.Permission,
+	}
+}
+
+// CreatePermission godoc
+// @Summary 创建权限
+// @Description 在权限目录中创建命名权限，资源为 keyMatch2 路径，操作为HTTP方法正则，权限目录为各租户共用，仅超级管理员可用
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param request body dto.CreatePermissionRequest true "创建权限请求"
+// @Success 200 {object} res.Response{data=rbac.Permission} "创建成功"
+// @Router /rbac/permissions [post]
+// @Security Bearer
+func (h *PermissionHandler) CreatePermission(c *gin.Context) {
+	var req dto.CreatePermissionRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	permission, err := h.permissionService.CreatePermission(req.Name, req.Resource, req.Action, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限创建成功", permission)
+}
+
+// GetAllPermissions godoc
+// @Summary 获取所有权限
+// @Description 获取权限目录中的所有命名权限
+// @Tags 权限管理
+// @Produce json
+// @Success 200 {object} res.Response{data=[]rbac.Permission} "获取成功"
+// @Router /rbac/permissions [get]
+// @Security Bearer
+func (h *PermissionHandler) GetAllPermissions(c *gin.Context) {
+	permissions, err := h.permissionService.GetAllPermissions()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, permissions)
+}
+
+// GetPermission godoc
+// @Summary 获取权限详情
+// @Description 根据ID获取权限详情
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "权限ID"
+// @Success 200 {object} res.Response{data=rbac.Permission} "获取成功"
+// @Router /rbac/permissions/{id} [get]
+// @Security Bearer
+func (h *PermissionHandler) GetPermission(c *gin.Context) {
+	id, ok := permissionID(c)
+	if !ok {
+		return
+	}
+	permission, err := h.permissionService.GetPermissionByID(id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, permission)
+}
+
+// UpdatePermission godoc
+// @Summary 更新权限
+// @Description 根据ID更新权限，资源或操作变更时同步改写已授予角色和部门的策略，仅超级管理员可用
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param id path int true "权限ID"
+// @Param request body dto.UpdatePermissionRequest true "更新权限请求"
+// @Success 200 {object} res.Response{data=rbac.Permission} "更新成功"
+// @Router /rbac/permissions/{id} [put]
+// @Security Bearer
+func (h *PermissionHandler) UpdatePermission(c *gin.Context) {
+	id, ok := permissionID(c)
+	if !ok {
+		return
+	}
+	var req dto.UpdatePermissionRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	permission, err := h.permissionService.UpdatePermission(c.GetString("subject"), id, req.Name, req.Resource, req.Action, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限更新成功", permission)
+}
+
+// DeletePermission godoc
+// @Summary 删除权限
+// @Description 根据ID删除权限，同时从所有角色和部门上收回，仅超级管理员可用
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "权限ID"
+// @Success 200 {object} res.Response "删除成功"
+// @Router /rbac/permissions/{id} [delete]
+// @Security Bearer
+func (h *PermissionHandler) DeletePermission(c *gin.Context) {
+	id, ok := permissionID(c)
+	if !ok {
+		return
+	}
+	if err := h.permissionService.DeletePermission(id); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限删除成功", nil)
+}
+
+// GetRolePermissions godoc
+// @Summary 获取角色权限
+// @Description 获取直接授予角色的权限，按权限目录显示名称
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=vo.SubjectPermissionsVO} "获取成功"
+// @Router /rbac/role-catalog/{id}/permissions [get]
+// @Security Bearer
+func (h *PermissionHandler) GetRolePermissions(c *gin.Context) {
+	id, ok := roleID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	role, err := services.Role.GetRoleByID(id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	h.subjectPermissions(c, role.Name, dom)
+}
+
+// GrantRolePermissions godoc
+// @Summary 授予角色权限
+// @Description 将权限目录中的命名权限授予角色
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param request body dto.GrantPermissionsRequest true "授予权限请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "授予成功"
+// @Router /rbac/role-catalog/{id}/permissions [post]
+// @Security Bearer
+func (h *PermissionHandler) GrantRolePermissions(c *gin.Context) {
+	id, ok := roleID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	var req dto.GrantPermissionsRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	if err := h.permissionService.GrantToRole(c.GetString("subject"), dom, id, req.Permissions); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限授予成功", nil)
+}
+
+// RevokeRolePermission godoc
+// @Summary 收回角色权限
+// @Description 收回角色的命名权限
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param name path string true "权限名称"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "收回成功"
+// @Router /rbac/role-catalog/{id}/permissions/{name} [delete]
+// @Security Bearer
+func (h *PermissionHandler) RevokeRolePermission(c *gin.Context) {
+	id, ok := roleID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	if err := h.permissionService.RevokeFromRole(c.GetString("subject"), dom, id, c.Param("name")); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限收回成功", nil)
+}
+
+// GetDepartmentPermissions godoc
+// @Summary 获取部门权限
+// @Description 获取直接授予部门的权限，按权限目录显示名称
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "部门ID"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=vo.SubjectPermissionsVO} "获取成功"
+// @Router /departments/{id}/permissions [get]
+// @Security Bearer
+func (h *PermissionHandler) GetDepartmentPermissions(c *gin.Context) {
+	id, ok := departmentID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	department, err := services.Department.GetDepartmentByID(c.Request.Context(), id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	h.subjectPermissions(c, rbac.GetDepartmentSubject(department.ID), dom)
+}
+
+// GrantDepartmentPermissions godoc
+// @Summary 授予部门权限
+// @Description 将权限目录中的命名权限授予部门
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param id path int true "部门ID"
+// @Param request body dto.GrantPermissionsRequest true "授予权限请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "授予成功"
+// @Router /departments/{id}/permissions [post]
+// @Security Bearer
+func (h *PermissionHandler) GrantDepartmentPermissions(c *gin.Context) {
+	id, ok := departmentID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	var req dto.GrantPermissionsRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	if err := h.permissionService.GrantToDepartment(c.Request.Context(), c.GetString("subject"), dom, id, req.Permissions); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限授予成功", nil)
+}
+
+// RevokeDepartmentPermission godoc
+// @Summary 收回部门权限
+// @Description 收回部门的命名权限
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "部门ID"
+// @Param name path string true "权限名称"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "收回成功"
+// @Router /departments/{id}/permissions/{name} [delete]
+// @Security Bearer
+func (h *PermissionHandler) RevokeDepartmentPermission(c *gin.Context) {
+	id, ok := departmentID(c)
+	if !ok {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	if err := h.permissionService.RevokeFromDepartment(c.Request.Context(), c.GetString("subject"), dom, id, c.Param("name")); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "权限收回成功", nil)
+}
+
+// subjectPermissions 返回主体在域中的命名权限和原始策略
+func (h *PermissionHandler) subjectPermissions(c *gin.Context, sub, dom string) {
+	permissions, err := h.permissionService.ListForSubject(sub, dom)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, vo.SubjectPermissionsVO{
+		Permissions: permissions.Permissions,
+		Policies:    permissions.Policies,
+	})
+}
+
+// permissionID 解析路径中的权限ID
+func permissionID(c *gin.Context) (uint, bool) {
+	return pathID(c, "无效的权限ID")
+}
+
+// roleID 解析路径中的角色ID
+func roleID(c *gin.Context) (uint, bool) {
+	return pathID(c, "无效的角色ID")
+}
+
+// departmentID 解析路径中的部门ID
+func departmentID(c *gin.Context) (uint, bool) {
+	return pathID(c, "无效的部门ID")
+}
+
+// pathID 解析路径参数 id，失败时返回参数错误
+func pathID(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, message)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// domain 解析查询参数 domain 指定的租户域，未指定时为当前用户的租户域
+// 只有超级管理员可以指定其他租户或全局域 *
+func domain(c *gin.Context) (string, bool) {
+	dom, err := services.GrantGuard.ResolveDomain(c.GetString("subject"), c.GetString("domain"), c.Query("domain"))
+	if err != nil {
+		Error(c, err)
+		return "", false
+	}
+	return dom, true
+}
@@ -1,49 +1,110 @@
 package handlers
 
 import (
+	"cmp"
+	"gin-starter/internal/application/services"
 	"gin-starter/internal/application/services/rbac"
 	"gin-starter/internal/interfaces/validators"
+	"gin-starter/internal/interfaces/vo"
 	"gin-starter/pkg/utils/res"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AddPolicyRequest struct {
-	Sub string `json:"sub" binding:"required"`
-	Obj string `json:"obj" binding:"required"`
-	Act string `json:"act" binding:"required"`
+	Sub  string `json:"sub" binding:"required"`
+	Obj  string `json:"obj" binding:"required"`
+	Act  string `json:"act" binding:"required"`
+	Cond string `json:"cond"`                                     // 基于属性的条件，如 obj.owner_id == sub.id，为空时无条件
+	Eft  string `json:"eft" binding:"omitempty,oneof=allow deny"` // 策略效果，为空时为 allow
 }
 
 type AddRoleForUserRequest struct {
-	UserID uint   `json:"user_id" binding:"required"`
-	Role   string `json:"role" binding:"required"`
+	UserID     uint       `json:"user_id" binding:"required"`
+	Role       string     `json:"role" binding:"required"`
+	ValidFrom  *time.Time `json:"valid_from"`  // 生效时间，为空时立即生效
+	ValidUntil *time.Time `json:"valid_until"` // 失效时间，为空时长期有效
 }
 
 type AddDepartmentForUserRequest struct {
-	UserID     uint   `json:"user_id" binding:"required"`
-	Department string `json:"department" binding:"required"`
+	UserID       uint       `json:"user_id" binding:"required"`
+	DepartmentID uint       `json:"department_id" binding:"required"`
+	ValidFrom    *time.Time `json:"valid_from"`  // 生效时间，为空时立即生效
+	ValidUntil   *time.Time `json:"valid_until"` // 失效时间，为空时长期有效
 }
 
 type EnforceRequest struct {
-	Sub string `json:"sub" binding:"required"`
-	Obj string `json:"obj" binding:"required"`
-	Act string `json:"act" binding:"required"`
+	Sub   string          `json:"sub" binding:"required"`
+	Obj   string          `json:"obj" binding:"required"`
+	Act   string          `json:"act" binding:"required"`
+	Attrs rbac.Attributes `json:"attrs"` // 条件求值使用的属性，不提供时条件策略不生效
+}
+
+// DryRunRequest 策略变更预演请求
+type DryRunRequest struct {
+	Changes  []rbac.PolicyChange `json:"changes" binding:"required,min=1,dive"`
+	Requests []rbac.Request      `json:"requests" binding:"required,min=1,max=500,dive"`
+}
+
+type RemoveRoleForUserRequest struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required"`
+}
+
+type RemoveDepartmentForUserRequest struct {
+	UserID       uint `json:"user_id" binding:"required"`
+	DepartmentID uint `json:"department_id" binding:"required"`
+}
+
+// ListRulesRequest 规则列表查询，v0-v5 依次对应规则的各个字段，为空时不过滤
+type ListRulesRequest struct {
+	Type     string `form:"type" binding:"required,oneof=p g g2"`
+	V0       string `form:"v0"`
+	V1       string `form:"v1"`
+	V2       string `form:"v2"`
+	V3       string `form:"v3"`
+	V4       string `form:"v4"`
+	V5       string `form:"v5"`
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`
+
+	ExpiringWithin time.Duration `form:"expiring_within"` // 只返回在该时长内到期的角色或部门分配，按到期时间排序，如 168h
+}
+
+// RemoveRulesRequest 批量删除规则请求，p 规则为 [sub, dom, obj, act, cond, eft]（省略 cond、eft 时为无条件的允许策略），g 规则为 [user, role, dom]，g2 规则为 [user, department]
+type RemoveRulesRequest struct {
+	Type  string     `json:"type" binding:"required,oneof=p g g2"`
+	Rules [][]string `json:"rules" binding:"required,min=1"`
+}
+
+// PolicyFileRequest 策略文件导入导出参数
+type PolicyFileRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=yaml csv"` // 文件格式，默认为 yaml
+	Prune  bool   `form:"prune"`                                     // 导入时删除文件中没有的角色、权限、策略和角色分配
+	DryRun bool   `form:"dry_run"`                                   // 只返回导入会产生的变更，不做修改
 }
 
-type RBACHandler struct{}
+type RBACHandler struct {
+	guard *services.GrantGuardService
+}
 
 func NewRBACHandler() *RBACHandler {
-	return &RBACHandler{}
+	return &RBACHandler{
+		guard: services.GrantGuard,
+	}
 }
 
 // AddPolicy godoc
 // @Summary 添加权限策略
-// @Description 添加RBAC权限策略
+// @Description 在租户域中添加RBAC权限策略，全局域 * 中的策略在所有租户中生效；cond 为基于属性的条件，条件满足时策略才生效；eft 为 deny 时为拒绝策略，匹配的拒绝策略优先于允许策略，超级管理员不受拒绝策略限制
 // @Tags RBAC权限管理
 // @Accept json
 // @Produce json
 // @Param request body AddPolicyRequest true "添加策略请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
 // @Success 200 {object} res.Response "添加成功"
 // @Router /rbac/policy [post]
 // @Security Bearer
@@ -53,7 +114,26 @@ func (h *RBACHandler) AddPolicy(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	ok, err := rbac.AddPolicy(req.Sub, req.Obj, req.Act)
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	actor := c.GetString("subject")
+	if err := h.guard.CheckSubject(actor, req.Sub); err != nil {
+		Error(c, err)
+		return
+	}
+	cond := policyCondition(req.Cond)
+	if err := rbac.ValidateCondition(cond); err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, err.Error())
+		return
+	}
+	eft := policyEffect(req.Eft)
+	if err := h.guard.CheckPolicy(actor, dom, req.Obj, req.Act, cond, eft); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err := rbac.AddPolicyRule(req.Sub, dom, req.Obj, req.Act, cond, eft)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -67,11 +147,13 @@ func (h *RBACHandler) AddPolicy(c *gin.Context) {
 
 // AddRoleForUser godoc
 // @Summary 为用户分配角色
-// @Description 为指定用户分配角色
+// @Description 在用户所属的租户域中为指定用户分配角色，super_admin 总是分配在全局域
+// @Description 指定 valid_from、valid_until 时角色只在有效期内生效，到期后自动收回；角色已分配时更新其有效期，不指定时改为长期有效
 // @Tags RBAC权限管理
 // @Accept json
 // @Produce json
 // @Param request body AddRoleForUserRequest true "分配角色请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
 // @Success 200 {object} res.Response "分配成功"
 // @Router /rbac/role [post]
 // @Security Bearer
@@ -81,9 +163,27 @@ func (h *RBACHandler) AddRoleForUser(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	ok, err := rbac.AddRoleForUser(rbac.GetUserID(req.UserID), req.Role)
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	actor := c.GetString("subject")
+	user := rbac.GetUserID(req.UserID)
+	if err := h.guard.CheckSubject(actor, user); err != nil {
+		Error(c, err)
+		return
+	}
+	if err := h.guard.CheckUserDomain(user, dom); err != nil {
+		Error(c, err)
+		return
+	}
+	if err := h.guard.CheckRole(actor, req.Role, dom); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err := rbac.AddRoleForUserWithWindow(user, req.Role, dom, rbac.GrantWindow{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil})
 	if err != nil {
-		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
+		Error(c, err)
 		return
 	}
 	if ok {
@@ -95,12 +195,14 @@ func (h *RBACHandler) AddRoleForUser(c *gin.Context) {
 
 // GetRolesForUser godoc
 // @Summary 获取用户角色
-// @Description 获取指定用户的所有角色
+// @Description 获取指定用户在租户域中的角色，包含全局域中分配的角色
 // @Tags RBAC权限管理
 // @Produce json
 // @Param user_id path string true "用户ID"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
 // @Success 200 {object} res.Response{data=[]string} "获取成功"
-// @Router /rbac/role/{user_id} [get]
+// @Router /rbac/users/{user_id}/roles [get]
+// @Router /rbac/roles/{user_id} [get]
 // @Security Bearer
 func (h *RBACHandler) GetRolesForUser(c *gin.Context) {
 	userID := c.Param("user_id")
@@ -108,7 +210,11 @@ func (h *RBACHandler) GetRolesForUser(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, "用户ID不能为空")
 		return
 	}
-	roles, err := rbac.GetRolesForUser(userID)
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	roles, err := rbac.GetRolesForUser(userID, dom)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -118,7 +224,7 @@ func (h *RBACHandler) GetRolesForUser(c *gin.Context) {
 
 // AddDepartmentForUser godoc
 // @Summary 为用户分配部门
-// @Description 为指定用户分配部门
+// @Description 为指定用户分配部门，有效期的含义与分配角色相同
 // @Tags RBAC权限管理
 // @Accept json
 // @Produce json
@@ -132,9 +238,30 @@ func (h *RBACHandler) AddDepartmentForUser(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	ok, err := rbac.AddDepartmentForUser(rbac.GetUserID(req.UserID), req.Department)
+	actor := c.GetString("subject")
+	user := rbac.GetUserID(req.UserID)
+	if err := h.guard.CheckSubject(actor, user); err != nil {
+		Error(c, err)
+		return
+	}
+	// 部门必须属于当前租户，用户必须与部门属于同一租户
+	row, err := services.Department.GetDepartmentByID(c.Request.Context(), req.DepartmentID)
 	if err != nil {
-		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
+		Error(c, err)
+		return
+	}
+	if err := h.guard.CheckUserDomain(user, rbac.GetTenantDomain(row.TenantID)); err != nil {
+		Error(c, err)
+		return
+	}
+	department := rbac.GetDepartmentSubject(row.ID)
+	if err := h.guard.CheckDepartment(actor, department); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err := rbac.AddDepartmentForUserWithWindow(user, department, rbac.GrantWindow{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil})
+	if err != nil {
+		Error(c, err)
 		return
 	}
 	if ok {
@@ -146,12 +273,13 @@ func (h *RBACHandler) AddDepartmentForUser(c *gin.Context) {
 
 // GetDepartmentsForUser godoc
 // @Summary 获取用户部门
-// @Description 获取指定用户的所有部门
+// @Description 获取指定用户直接所属的部门
 // @Tags RBAC权限管理
 // @Produce json
 // @Param user_id path string true "用户ID"
-// @Success 200 {object} res.Response{data=[]string} "获取成功"
-// @Router /rbac/department/{user_id} [get]
+// @Success 200 {object} res.Response{data=[]rbac.Department} "获取成功"
+// @Router /rbac/users/{user_id}/departments [get]
+// @Router /rbac/departments/{user_id} [get]
 // @Security Bearer
 func (h *RBACHandler) GetDepartmentsForUser(c *gin.Context) {
 	userID := c.Param("user_id")
@@ -159,22 +287,384 @@ func (h *RBACHandler) GetDepartmentsForUser(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, "用户ID不能为空")
 		return
 	}
-	departments, err := rbac.GetDepartmentsForUser(userID)
+	departments, err := services.Department.GetDepartmentsForSubject(c.Request.Context(), userID)
 	if err != nil {
-		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
+		Error(c, err)
 		return
 	}
 	res.Success(c, departments)
 }
 
+// RemovePolicy godoc
+// @Summary 删除权限策略
+// @Description 删除租户域中的一条RBAC权限策略，cond 为空时删除无条件策略，eft 为空时删除允许策略；作用于操作者自己的拒绝策略只能由超级管理员删除
+// @Tags RBAC权限管理
+// @Accept json
+// @Produce json
+// @Param request body AddPolicyRequest true "删除策略请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "删除成功"
+// @Router /rbac/policy [delete]
+// @Security Bearer
+func (h *RBACHandler) RemovePolicy(c *gin.Context) {
+	var req AddPolicyRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	actor := c.GetString("subject")
+	if err := h.guard.CheckSubject(actor, req.Sub); err != nil {
+		Error(c, err)
+		return
+	}
+	if err := h.guard.CheckRemovePolicy(actor, req.Sub, dom, policyEffect(req.Eft)); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err := rbac.RemovePolicyRule(req.Sub, dom, req.Obj, req.Act, policyCondition(req.Cond), policyEffect(req.Eft))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if ok {
+		SuccessWithMessage(c, "策略删除成功", nil)
+	} else {
+		SuccessWithMessage(c, "策略不存在", nil)
+	}
+}
+
+// RemoveRoleForUser godoc
+// @Summary 取消用户角色
+// @Description 取消指定用户在租户域中的角色，操作者不能取消自己带有拒绝策略的角色
+// @Tags RBAC权限管理
+// @Accept json
+// @Produce json
+// @Param request body RemoveRoleForUserRequest true "取消角色请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "取消成功"
+// @Router /rbac/role [delete]
+// @Security Bearer
+func (h *RBACHandler) RemoveRoleForUser(c *gin.Context) {
+	var req RemoveRoleForUserRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	actor := c.GetString("subject")
+	user := rbac.GetUserID(req.UserID)
+	// 角色为 super_admin 或用户本身是超级管理员时都要求超级管理员
+	for _, sub := range []string{user, req.Role} {
+		if err := h.guard.CheckSubject(actor, sub); err != nil {
+			Error(c, err)
+			return
+		}
+	}
+	if err := h.guard.CheckRemoveLink(actor, user, req.Role, dom); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err := rbac.DeleteRoleForUser(user, req.Role, dom)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if ok {
+		SuccessWithMessage(c, "角色取消成功", nil)
+	} else {
+		SuccessWithMessage(c, "用户未分配该角色", nil)
+	}
+}
+
+// RemoveDepartmentForUser godoc
+// @Summary 移出部门
+// @Description 将指定用户移出部门，操作者不能将自己移出带有拒绝策略的部门
+// @Tags RBAC权限管理
+// @Accept json
+// @Produce json
+// @Param request body RemoveDepartmentForUserRequest true "移出部门请求"
+// @Success 200 {object} res.Response "移出成功"
+// @Router /rbac/department [delete]
+// @Security Bearer
+func (h *RBACHandler) RemoveDepartmentForUser(c *gin.Context) {
+	var req RemoveDepartmentForUserRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	actor := c.GetString("subject")
+	user := rbac.GetUserID(req.UserID)
+	if err := h.guard.CheckSubject(actor, user); err != nil {
+		Error(c, err)
+		return
+	}
+	department, err := services.Department.GetDepartmentByID(c.Request.Context(), req.DepartmentID)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	subject := rbac.GetDepartmentSubject(department.ID)
+	if err := h.guard.CheckRemoveLink(actor, user, subject, dom); err != nil {
+		Error(c, err)
+		return
+	}
+	ok, err = rbac.DeleteDepartmentForUser(user, subject)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if ok {
+		SuccessWithMessage(c, "部门移出成功", nil)
+	} else {
+		SuccessWithMessage(c, "用户不属于该部门", nil)
+	}
+}
+
+// ListRules godoc
+// @Summary 查询规则
+// @Description 按类型分页查询 p（权限策略）、g（用户角色）、g2（用户部门）规则，v0-v3 依次精确匹配规则的各个字段
+// @Description 只返回在租户域中生效的规则，g2 规则按其中部门所属的租户判断，超级管理员指定 domain=* 时返回所有租户的规则
+// @Description g、g2 规则同时在 windows 中按顺序返回各分配的有效期
+// @Tags RBAC权限管理
+// @Produce json
+// @Param type query string true "规则类型" Enums(p, g, g2)
+// @Param v0 query string false "第1个字段"
+// @Param v1 query string false "第2个字段"
+// @Param v2 query string false "第3个字段"
+// @Param v3 query string false "第4个字段"
+// @Param v4 query string false "第5个字段"
+// @Param v5 query string false "第6个字段"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Param expiring_within query string false "只返回在该时长内到期的 g、g2 规则，按到期时间排序，如 168h"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=vo.RuleListVO} "获取成功"
+// @Router /rbac/rules [get]
+// @Security Bearer
+func (h *RBACHandler) ListRules(c *gin.Context) {
+	var req ListRulesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	rules, err := rbac.ListRules(req.Type, req.V0, req.V1, req.V2, req.V3, req.V4, req.V5)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if rules, err = rbac.FilterRulesByDomain(req.Type, dom, rules); err != nil {
+		Error(c, err)
+		return
+	}
+	var windows []rbac.GrantWindow
+	if req.Type != rbac.PolicyRule {
+		if windows, err = rbac.GetGrantWindows(req.Type, rules); err != nil {
+			Error(c, err)
+			return
+		}
+		if req.ExpiringWithin > 0 {
+			rules, windows = expiringRules(rules, windows, time.Now().Add(req.ExpiringWithin))
+		}
+	}
+	page := max(req.Page, 1)
+	pageSize := req.PageSize
+	if pageSize == 0 {
+		pageSize = 20
+	}
+	start := min((page-1)*pageSize, len(rules))
+	end := min(start+pageSize, len(rules))
+	list := vo.RuleListVO{
+		Rules:    rules[start:end],
+		Total:    len(rules),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if windows != nil {
+		list.Windows = windows[start:end]
+	}
+	Success(c, list)
+}
+
+// expiringRules 筛选在 deadline 之前到期的分配，按到期时间排序
+func expiringRules(rules [][]string, windows []rbac.GrantWindow, deadline time.Time) ([][]string, []rbac.GrantWindow) {
+	var indexes []int
+	for i, window := range windows {
+		if window.ValidUntil != nil && window.ValidUntil.Before(deadline) {
+			indexes = append(indexes, i)
+		}
+	}
+	slices.SortStableFunc(indexes, func(a, b int) int {
+		return windows[a].ValidUntil.Compare(*windows[b].ValidUntil)
+	})
+	expiring := make([][]string, 0, len(indexes))
+	expiringWindows := make([]rbac.GrantWindow, 0, len(indexes))
+	for _, i := range indexes {
+		expiring = append(expiring, rules[i])
+		expiringWindows = append(expiringWindows, windows[i])
+	}
+	return expiring, expiringWindows
+}
+
+// RemoveRules godoc
+// @Summary 批量删除规则
+// @Description 批量删除同一类型的规则，规则必须属于租户域，g2 规则中的部门必须属于该租户；不能删除作用于操作者自己的拒绝策略，也不能解除操作者与带有拒绝策略的角色或部门的关系
+// @Tags RBAC权限管理
+// @Accept json
+// @Produce json
+// @Param request body RemoveRulesRequest true "删除规则请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response "删除成功"
+// @Router /rbac/rules [delete]
+// @Security Bearer
+func (h *RBACHandler) RemoveRules(c *gin.Context) {
+	var req RemoveRulesRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	domains, err := rbac.RulesDomains(req.Type, req.Rules)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	actor := c.GetString("subject")
+	for i, rule := range req.Rules {
+		if dom != rbac.AllDomains && domains[i] != dom {
+			Error(c, res.ErrInsufficientPermissions.WithMessage("不能删除其他租户或全局域的规则"))
+			return
+		}
+		// p 规则只有第一个字段是主体，g 规则的两端都可能是超级管理员
+		subjects := rule[:min(len(rule), 2)]
+		if req.Type == rbac.PolicyRule {
+			subjects = rule[:min(len(rule), 1)]
+		}
+		for _, sub := range subjects {
+			if err := h.guard.CheckSubject(actor, sub); err != nil {
+				Error(c, err)
+				return
+			}
+		}
+		if err := h.checkRemoveRule(actor, req.Type, rule, domains[i]); err != nil {
+			Error(c, err)
+			return
+		}
+	}
+	ok, err = rbac.RemoveRules(req.Type, req.Rules)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if ok {
+		SuccessWithMessage(c, "规则删除成功", nil)
+	} else {
+		SuccessWithMessage(c, "规则不存在", nil)
+	}
+}
+
+// checkRemoveRule 删除拒绝策略或自己与带有拒绝策略的角色、部门的关系前的校验，ruleDom 为规则所在的域
+func (h *RBACHandler) checkRemoveRule(actor, ptype string, rule []string, ruleDom string) error {
+	switch {
+	case ptype == rbac.PolicyRule && len(rule) > 5:
+		return h.guard.CheckRemovePolicy(actor, rule[0], ruleDom, rule[5])
+	case ptype != rbac.PolicyRule && len(rule) > 1:
+		return h.guard.CheckRemoveLink(actor, rule[0], rule[1], ruleDom)
+	}
+	return nil
+}
+
+// GetUsersForRole godoc
+// @Summary 获取角色成员
+// @Description 获取在租户域中直接拥有该角色的主体，用户为用户ID，服务账号为 apikey:<id>，超级管理员指定 domain=* 时返回所有租户的主体，不在操作者数据范围内的用户不返回
+// @Tags RBAC权限管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=[]string} "获取成功"
+// @Router /rbac/role-catalog/{id}/users [get]
+// @Security Bearer
+func (h *RBACHandler) GetUsersForRole(c *gin.Context) {
+	id, ok := roleID(c)
+	if !ok {
+		return
+	}
+	role, err := services.Role.GetRoleByID(id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	users, err := rbac.GetUsersForRole(role.Name, dom)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	users, err = services.DataScope.FilterSubjects(c.Request.Context(), users)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, users)
+}
+
+// GetUsersForDepartment godoc
+// @Summary 获取部门成员
+// @Description 获取直接属于该部门的主体，不在操作者数据范围内的用户不返回
+// @Tags RBAC权限管理
+// @Produce json
+// @Param id path int true "部门ID"
+// @Success 200 {object} res.Response{data=[]string} "获取成功"
+// @Router /departments/{id}/users [get]
+// @Security Bearer
+func (h *RBACHandler) GetUsersForDepartment(c *gin.Context) {
+	id, ok := departmentID(c)
+	if !ok {
+		return
+	}
+	department, err := services.Department.GetDepartmentByID(c.Request.Context(), id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	users, err := rbac.GetUsersForDepartment(rbac.GetDepartmentSubject(department.ID))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	users, err = services.DataScope.FilterSubjects(c.Request.Context(), users)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, users)
+}
+
 // RBACEnforce godoc
 // @Summary 权限验证
-// @Description 验证用户是否有权限执行指定操作
+// @Description 验证用户在租户域中是否有权限执行指定操作，attrs 提供条件策略求值使用的属性；返回决定结果的策略以及主体经角色或部门到该策略的继承链
 // @Tags RBAC权限管理
 // @Accept json
 // @Produce json
 // @Param request body EnforceRequest true "权限验证请求"
-// @Success 200 {object} res.Response{data=map[string]bool} "验证完成"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=rbac.Explanation} "验证完成"
 // @Router /rbac/enforce [post]
 // @Security Bearer
 func (h *RBACHandler) RBACEnforce(c *gin.Context) {
@@ -183,7 +673,11 @@ func (h *RBACHandler) RBACEnforce(c *gin.Context) {
 		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
 		return
 	}
-	ok, err := rbac.Enforce(req.Sub, req.Obj, req.Act)
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	explanation, err := rbac.Explain(req.Sub, dom, req.Obj, req.Act, req.Attrs)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, err.Error())
 		return
@@ -191,8 +685,130 @@ func (h *RBACHandler) RBACEnforce(c *gin.Context) {
 	c.JSON(http.StatusOK, res.Response{
 		Code:    20000,
 		Message: "权限验证完成",
-		Data: map[string]bool{
-			"allowed": ok,
-		},
+		Data:    explanation,
 	})
 }
+
+// DryRun godoc
+// @Summary 策略变更预演
+// @Description 在当前策略的副本上应用规则变更，返回样例请求在变更前后的校验结果和依据，flipped 表示结果会改变；不会保存任何变更
+// @Tags RBAC权限管理
+// @Accept json
+// @Produce json
+// @Param request body DryRunRequest true "预演请求"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=vo.DryRunVO} "预演完成"
+// @Router /rbac/dry-run [post]
+// @Security Bearer
+func (h *RBACHandler) DryRun(c *gin.Context) {
+	var req DryRunRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	decisions, err := rbac.DryRun(dom, req.Changes, req.Requests)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	flipped := 0
+	for _, decision := range decisions {
+		if decision.Flipped {
+			flipped++
+		}
+	}
+	Success(c, vo.DryRunVO{
+		Decisions: decisions,
+		Flipped:   flipped,
+	})
+}
+
+// ExportPolicyFile godoc
+// @Summary 导出策略文件
+// @Description 将当前的角色、权限目录、角色和部门上的策略以及角色分配导出为声明式策略文件，用于比较和迁移不同环境的策略，仅超级管理员可用
+// @Tags RBAC权限管理
+// @Produce plain
+// @Param format query string false "文件格式 yaml 或 csv，默认为 yaml"
+// @Success 200 {string} string "策略文件"
+// @Router /rbac/policy-file [get]
+// @Security Bearer
+func (h *RBACHandler) ExportPolicyFile(c *gin.Context) {
+	var req PolicyFileRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
+		return
+	}
+	format := cmp.Or(req.Format, services.PolicyFormatYAML)
+	doc, err := services.PolicyFile.Export()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	data, err := services.EncodePolicyDocument(doc, format)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	contentType := "application/yaml; charset=utf-8"
+	if format == services.PolicyFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Header("Content-Disposition", "attachment; filename=policy."+format)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportPolicyFile godoc
+// @Summary 导入策略文件
+// @Description 以请求体中的声明式策略文件为准，创建或更新角色、权限、授权和角色分配，重复导入不会产生变更；prune=true 时删除文件中没有的内容（super_admin 及其分配除外）；dry_run=true 时只返回变更。仅超级管理员可用
+// @Tags RBAC权限管理
+// @Accept plain
+// @Produce json
+// @Param format query string false "文件格式 yaml 或 csv，默认为 yaml"
+// @Param prune query bool false "删除文件中没有的内容"
+// @Param dry_run query bool false "只返回变更，不做修改"
+// @Param file body string true "策略文件内容"
+// @Success 200 {object} res.Response{data=services.PolicyImportResult} "导入成功"
+// @Router /rbac/policy-file [post]
+// @Security Bearer
+func (h *RBACHandler) ImportPolicyFile(c *gin.Context) {
+	var req PolicyFileRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, validators.GetValidationError(err))
+		return
+	}
+	data, err := c.GetRawData()
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "读取策略文件失败")
+		return
+	}
+	doc, err := services.ParsePolicyDocument(data, cmp.Or(req.Format, services.PolicyFormatYAML))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	result, err := services.PolicyFile.Import(doc, req.Prune, req.DryRun)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, result)
+}
+
+// policyCondition 请求中未指定条件时为无条件策略
+func policyCondition(cond string) string {
+	if cond == "" {
+		return rbac.NoCondition
+	}
+	return cond
+}
+
+// policyEffect 请求中未指定效果时为允许策略
+func policyEffect(eft string) string {
+	if eft == "" {
+		return rbac.EffectAllow
+	}
+	return eft
+}
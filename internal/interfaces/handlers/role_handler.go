@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"gin-starter/internal/application/services"
+	"gin-starter/internal/interfaces/dto"
+	"gin-starter/internal/interfaces/vo"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	roleService *services.RoleService
+}
+
+func NewRoleHandler() *RoleHandler {
+	return &RoleHandler{
+		roleService: services.Role,
+	}
+}
+
+// CreateRole godoc
+// @Summary 创建角色
+// @Description 创建新的角色，只有已创建的角色才能分配给用户，角色目录为各租户共用，仅超级管理员可用
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateRoleRequest true "创建角色请求"
+// @Success 200 {object} res.Response{data=rbac.Role} "创建成功"
+// @Router /rbac/role-catalog [post]
+// @Security Bearer
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req dto.CreateRoleRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	role, err := h.roleService.CreateRole(req.Name, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "角色创建成功", role)
+}
+
+// GetAllRoles godoc
+// @Summary 获取所有角色
+// @Description 获取所有角色列表
+// @Tags 角色管理
+// @Produce json
+// @Success 200 {object} res.Response{data=[]rbac.Role} "获取成功"
+// @Router /rbac/role-catalog [get]
+// @Security Bearer
+func (h *RoleHandler) GetAllRoles(c *gin.Context) {
+	roles, err := h.roleService.GetAllRoles()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, roles)
+}
+
+// GetRole godoc
+// @Summary 获取角色详情
+// @Description 根据ID获取角色详情，包含在租户域中按名称显示的权限
+// @Tags 角色管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param domain query string false "租户域，默认为当前租户，超级管理员可指定其他租户或 *"
+// @Success 200 {object} res.Response{data=vo.RoleVO} "获取成功"
+// @Router /rbac/role-catalog/{id} [get]
+// @Security Bearer
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的角色ID")
+		return
+	}
+	dom, ok := domain(c)
+	if !ok {
+		return
+	}
+	role, err := h.roleService.GetRoleByID(uint(id))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	permissions, err := services.Permission.ListForSubject(role.Name, dom)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, vo.RoleVO{
+		Role: role,
+		SubjectPermissionsVO: vo.SubjectPermissionsVO{
+			Permissions: permissions.Permissions,
+			Policies:    permissions.Policies,
+		},
+	})
+}
+
+// UpdateRole godoc
+// @Summary 更新角色
+// @Description 根据ID更新角色，重命名时同步改写该角色的分配关系和权限策略，仅超级管理员可用
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param request body dto.UpdateRoleRequest true "更新角色请求"
+// @Success 200 {object} res.Response{data=rbac.Role} "更新成功"
+// @Router /rbac/role-catalog/{id} [put]
+// @Security Bearer
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的角色ID")
+		return
+	}
+	var req dto.UpdateRoleRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	role, err := h.roleService.UpdateRole(uint(id), req.Name, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "角色更新成功", role)
+}
+
+// SetDataScope godoc
+// @Summary 设置角色数据范围
+// @Description 设置持有该角色的用户在用户列表中能看到的数据：all 全部、dept 本部门、dept_and_children 本部门及下级部门、self 仅本人、custom 自定义部门；多个角色的数据范围取并集，角色为各租户共用，仅超级管理员可用
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param request body dto.SetDataScopeRequest true "设置数据范围请求"
+// @Success 200 {object} res.Response{data=rbac.Role} "设置成功"
+// @Router /rbac/role-catalog/{id}/data-scope [put]
+// @Security Bearer
+func (h *RoleHandler) SetDataScope(c *gin.Context) {
+	id, ok := roleID(c)
+	if !ok {
+		return
+	}
+	var req dto.SetDataScopeRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	role, err := services.DataScope.SetRoleDataScope(c.Request.Context(), id, req.DataScope, req.DepartmentIDs)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "数据范围设置成功", role)
+}
+
+// DeleteRole godoc
+// @Summary 删除角色
+// @Description 根据ID删除角色，同时移除该角色的分配关系和权限策略，仅超级管理员可用
+// @Tags 角色管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Success 200 {object} res.Response "删除成功"
+// @Router /rbac/role-catalog/{id} [delete]
+// @Security Bearer
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的角色ID")
+		return
+	}
+	if err := h.roleService.DeleteRole(uint(id)); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "角色删除成功", nil)
+}
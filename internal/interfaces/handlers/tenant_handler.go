@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"gin-starter/internal/application/services"
+	"gin-starter/internal/interfaces/dto"
+	"gin-starter/pkg/utils/res"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantHandler struct {
+	tenantService *services.TenantService
+}
+
+func NewTenantHandler() *TenantHandler {
+	return &TenantHandler{
+		tenantService: services.Tenant,
+	}
+}
+
+// CreateTenant godoc
+// @Summary 创建租户
+// @Description 创建新的租户，租户ID即Casbin中的域
+// @Tags 租户管理
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateTenantRequest true "创建租户请求"
+// @Success 200 {object} res.Response{data=models.Tenant} "创建成功"
+// @Router /tenants [post]
+// @Security Bearer
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req dto.CreateTenantRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	tenant, err := h.tenantService.CreateTenant(req.Name, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "租户创建成功", tenant)
+}
+
+// GetAllTenants godoc
+// @Summary 获取所有租户
+// @Description 获取所有租户列表
+// @Tags 租户管理
+// @Produce json
+// @Success 200 {object} res.Response{data=[]models.Tenant} "获取成功"
+// @Router /tenants [get]
+// @Security Bearer
+func (h *TenantHandler) GetAllTenants(c *gin.Context) {
+	tenants, err := h.tenantService.GetAllTenants()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, tenants)
+}
+
+// GetTenant godoc
+// @Summary 获取租户详情
+// @Description 根据ID获取租户详情
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Success 200 {object} res.Response{data=models.Tenant} "获取成功"
+// @Router /tenants/{id} [get]
+// @Security Bearer
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+	tenant, err := h.tenantService.GetTenantByID(id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, tenant)
+}
+
+// UpdateTenant godoc
+// @Summary 更新租户
+// @Description 根据ID更新租户
+// @Tags 租户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "租户ID"
+// @Param request body dto.UpdateTenantRequest true "更新租户请求"
+// @Success 200 {object} res.Response{data=models.Tenant} "更新成功"
+// @Router /tenants/{id} [put]
+// @Security Bearer
+func (h *TenantHandler) UpdateTenant(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+	var req dto.UpdateTenantRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	tenant, err := h.tenantService.UpdateTenant(id, req.Name, req.Description)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "租户更新成功", tenant)
+}
+
+// DeleteTenant godoc
+// @Summary 删除租户
+// @Description 根据ID删除租户，同时移除该租户域中的策略和角色分配，默认租户和仍有用户或部门的租户不能删除
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Success 200 {object} res.Response "删除成功"
+// @Router /tenants/{id} [delete]
+// @Security Bearer
+func (h *TenantHandler) DeleteTenant(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+	if err := h.tenantService.DeleteTenant(id); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "租户删除成功", nil)
+}
+
+// GetTenantUsers godoc
+// @Summary 获取租户用户
+// @Description 获取属于该租户的用户
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Success 200 {object} res.Response{data=[]models.User} "获取成功"
+// @Router /tenants/{id}/users [get]
+// @Security Bearer
+func (h *TenantHandler) GetTenantUsers(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+	users, err := h.tenantService.GetTenantUsers(id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, users)
+}
+
+// MoveUser godoc
+// @Summary 将用户移到租户
+// @Description 将用户移到该租户，用户在原租户中的角色会被移除，已登录的会话全部失效
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Param user_id path int true "用户ID"
+// @Success 200 {object} res.Response "移动成功"
+// @Router /tenants/{id}/users/{user_id} [put]
+// @Security Bearer
+func (h *TenantHandler) MoveUser(c *gin.Context) {
+	id, ok := tenantID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的用户ID")
+		return
+	}
+	if err := h.tenantService.MoveUser(uint(userID), id); err != nil {
+		Error(c, err)
+		return
+	}
+	SuccessWithMessage(c, "用户移动成功", nil)
+}
+
+// tenantID 解析路径中的租户ID
+func tenantID(c *gin.Context) (uint, bool) {
+	return pathID(c, "无效的租户ID")
+}
@@ -2,22 +2,39 @@ package handlers
 
 import (
 	"gin-starter/internal/application/services"
+	"gin-starter/internal/domain/models"
 	"gin-starter/internal/interfaces/dto"
+	"gin-starter/internal/interfaces/vo"
+	"gin-starter/pkg/utils/converter"
 	"gin-starter/pkg/utils/jwt"
 	"gin-starter/pkg/utils/res"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// oidcFlowCookie 保存第三方登录流程状态的 Cookie
+	oidcFlowCookie = "oidc_flow"
+	// oidcFlowCookieTTL 第三方登录流程 Cookie 的有效期
+	oidcFlowCookieTTL = 10 * time.Minute
+)
+
 type UserHandler struct {
-	userService services.UserService
+	userService    services.UserService
+	tokenService   services.TokenService
+	sessionService *services.SessionService
+	accountService services.AccountService
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
-		userService: services.UserService{},
+		userService:    services.UserService{},
+		tokenService:   services.TokenService{},
+		sessionService: services.Session,
+		accountService: services.AccountService{},
 	}
 }
 
@@ -37,7 +54,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.CreateUser(req.Username, req.Email, req.Password)
+	user, err := h.userService.CreateUser(c.Request.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
 		Error(c, err)
 		return
@@ -55,7 +72,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 // @Router /users [get]
 // @Security Bearer
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	users, err := h.userService.GetAllUsers()
+	users, err := h.userService.GetAllUsers(c.Request.Context())
 	if err != nil {
 		Error(c, err)
 		return
@@ -79,7 +96,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(uint(id))
+	user, err := h.userService.GetUserByID(c.Request.Context(), uint(id))
 	if err != nil {
 		res.ErrNotFound.ThrowWithMessage(c, "用户不存在")
 		return
@@ -111,7 +128,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.UpdateUser(uint(id), req.Username, req.Email)
+	user, err := h.userService.UpdateUser(c.Request.Context(), uint(id), req.Username, req.Email)
 	if err != nil {
 		Error(c, err)
 		return
@@ -136,7 +153,7 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.DeleteUser(uint(id))
+	err = h.userService.DeleteUser(c.Request.Context(), uint(id))
 	if err != nil {
 		Error(c, err)
 		return
@@ -161,7 +178,7 @@ func (h *UserHandler) ActivateUser(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.ActivateUser(uint(id))
+	err = h.userService.ActivateUser(c.Request.Context(), uint(id))
 	if err != nil {
 		Error(c, err)
 		return
@@ -186,7 +203,7 @@ func (h *UserHandler) DeactivateUser(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.DeactivateUser(uint(id))
+	err = h.userService.DeactivateUser(c.Request.Context(), uint(id))
 	if err != nil {
 		Error(c, err)
 		return
@@ -195,9 +212,39 @@ func (h *UserHandler) DeactivateUser(c *gin.Context) {
 	SuccessWithMessage(c, "用户停用成功", nil)
 }
 
+// UnlockUser godoc
+// @Summary 解除登录锁定
+// @Description 清除用户因连续登录失败产生的锁定
+// @Tags 用户管理
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} res.Response "解锁成功"
+// @Router /users/{id}/unlock [post]
+// @Security Bearer
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的用户ID")
+		return
+	}
+
+	// 只能操作当前租户的用户
+	if _, err := h.userService.GetUserByID(c.Request.Context(), uint(id)); err != nil {
+		Error(c, err)
+		return
+	}
+
+	if err := services.Lockout.Unlock(uint(id)); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "用户已解锁", nil)
+}
+
 // ChangeEmail godoc
 // @Summary 修改邮箱
-// @Description 根据ID修改用户邮箱
+// @Description 根据ID修改用户邮箱，新邮箱验证通过后生效
 // @Tags 用户管理
 // @Accept json
 // @Produce json
@@ -218,13 +265,13 @@ func (h *UserHandler) ChangeEmail(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.ChangeEmail(uint(id), req.Email)
+	err = h.userService.ChangeEmail(c.Request.Context(), uint(id), req.Email)
 	if err != nil {
 		Error(c, err)
 		return
 	}
 
-	SuccessWithMessage(c, "邮箱修改成功", nil)
+	SuccessWithMessage(c, "验证邮件已发送至新邮箱", nil)
 }
 
 // Login godoc
@@ -234,7 +281,7 @@ func (h *UserHandler) ChangeEmail(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body dto.LoginRequest true "登录请求"
-// @Success 200 {object} res.Response{data=dto.LoginResponse} "登录成功"
+// @Success 200 {object} res.Response{data=vo.LoginResponse} "登录成功"
 // @Router /users/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	var req dto.LoginRequest
@@ -242,24 +289,465 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.AuthenticateUser(req.Username, req.Password)
+	user, err := h.userService.AuthenticateUser(req.Username, req.Password, c.ClientIP())
 	if err != nil {
-		res.ErrInvalidCredentials.ThrowWithMessage(c, "用户名或密码错误")
+		Error(c, err)
+		return
+	}
+
+	h.completeLogin(c, user, false)
+}
+
+// completeLogin 密码或第三方认证通过后完成登录，启用了双因素认证且尚未验证时返回挑战令牌
+func (h *UserHandler) completeLogin(c *gin.Context, user *models.User, mfa bool) {
+	if user.MFAEnabled && !mfa {
+		mfaToken, err := services.MFA.CreateChallenge(user)
+		if err != nil {
+			res.ErrInternalServer.ThrowWithMessage(c, "Token生成失败")
+			return
+		}
+		c.JSON(http.StatusOK, res.Response{
+			Code:    20000,
+			Message: "请输入双因素认证验证码",
+			Data: vo.LoginResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+			},
+		})
 		return
 	}
 
-	token, err := jwt.GenerateToken(user.ID, user.Username)
+	h.loginSuccess(c, user, mfa)
+}
+
+// LoginMFA godoc
+// @Summary 双因素认证登录
+// @Description 使用登录返回的 mfa_token 和TOTP验证码（或恢复码）完成登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body dto.MFALoginRequest true "双因素认证登录请求"
+// @Success 200 {object} res.Response{data=vo.LoginResponse} "登录成功"
+// @Router /users/login/mfa [post]
+func (h *UserHandler) LoginMFA(c *gin.Context) {
+	var req dto.MFALoginRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+
+	user, err := services.MFA.VerifyChallenge(req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	h.loginSuccess(c, user, true)
+}
+
+// OIDCLogin godoc
+// @Summary 第三方登录
+// @Description 跳转到 OpenID Connect 身份提供方登录，使用授权码 + PKCE 流程
+// @Tags 认证
+// @Success 302 "跳转到身份提供方"
+// @Router /users/oidc/login [get]
+func (h *UserHandler) OIDCLogin(c *gin.Context) {
+	authRequest, err := services.OIDC.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, authRequest.FlowToken, int(oidcFlowCookieTTL.Seconds()), "/users/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authRequest.URL)
+}
+
+// OIDCCallback godoc
+// @Summary 第三方登录回调
+// @Description 身份提供方回调地址，校验授权结果后签发令牌；按邮箱关联已有用户或自动创建用户，并按声明同步角色和部门
+// @Tags 认证
+// @Produce json
+// @Param code query string true "授权码"
+// @Param state query string true "状态"
+// @Success 200 {object} res.Response{data=vo.LoginResponse} "登录成功"
+// @Router /users/oidc/callback [get]
+func (h *UserHandler) OIDCCallback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		res.ErrOIDCLogin.ThrowWithMessage(c, "身份提供方拒绝了登录: "+errCode)
+		return
+	}
+	flowToken, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		res.ErrOIDCLogin.ThrowWithMessage(c, "登录状态无效或已过期，请重新登录")
+		return
+	}
+	// 流程令牌只能使用一次
+	c.SetCookie(oidcFlowCookie, "", -1, "/users/oidc", "", c.Request.TLS != nil, true)
+
+	result, err := services.OIDC.Callback(c.Request.Context(), flowToken, c.Query("state"), c.Query("code"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	h.completeLogin(c, result.User, result.MFA)
+}
+
+// loginSuccess 签发令牌对并返回登录响应
+func (h *UserHandler) loginSuccess(c *gin.Context, user *models.User, mfa bool) {
+	pair, err := h.tokenService.IssueTokenPair(user, c.ClientIP(), c.Request.UserAgent(), mfa)
 	if err != nil {
 		res.ErrInternalServer.ThrowWithMessage(c, "Token生成失败")
 		return
 	}
 
+	var userVO vo.UserVO
+	converter.SafeConvert(&userVO, user)
+
 	c.JSON(http.StatusOK, res.Response{
 		Code:    20000,
 		Message: "登录成功",
-		Data: dto.LoginResponse{
-			Token: token,
-			User:  user,
+		Data: vo.LoginResponse{
+			Token:            pair.AccessToken,
+			ExpiresAt:        pair.AccessExpiresAt.Unix(),
+			RefreshToken:     pair.RefreshToken,
+			RefreshExpiresAt: pair.RefreshExpiresAt.Unix(),
+			User:             &userVO,
 		},
 	})
 }
+
+// RefreshToken godoc
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌，刷新令牌每次使用后都会轮换，重复使用将吊销整个会话
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body dto.RefreshTokenRequest true "刷新令牌请求"
+// @Success 200 {object} res.Response{data=vo.TokenResponse} "刷新成功"
+// @Router /users/token/refresh [post]
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req dto.RefreshTokenRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+
+	pair, err := h.tokenService.RefreshTokenPair(req.RefreshToken)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "刷新成功", vo.TokenResponse{
+		Token:            pair.AccessToken,
+		ExpiresAt:        pair.AccessExpiresAt.Unix(),
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt.Unix(),
+	})
+}
+
+// Logout godoc
+// @Summary 退出登录
+// @Description 吊销当前访问令牌及其所属会话
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} res.Response "退出成功"
+// @Router /users/logout [post]
+// @Security Bearer
+func (h *UserHandler) Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(*jwt.Claims)
+
+	if err := h.sessionService.RevokeToken(claims); err != nil {
+		Error(c, err)
+		return
+	}
+	if claims.SessionID != "" {
+		if err := h.sessionService.RevokeSession(claims.UserID, claims.SessionID); err != nil {
+			Error(c, err)
+			return
+		}
+	}
+
+	SuccessWithMessage(c, "退出成功", nil)
+}
+
+// LogoutAll godoc
+// @Summary 退出所有设备
+// @Description 吊销当前用户的全部会话
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} res.Response "退出成功"
+// @Router /users/logout/all [post]
+// @Security Bearer
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	claims := c.MustGet("claims").(*jwt.Claims)
+
+	if err := h.sessionService.RevokeToken(claims); err != nil {
+		Error(c, err)
+		return
+	}
+	if err := h.sessionService.RevokeAllSessions(claims.UserID); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "已退出所有设备", nil)
+}
+
+// GetSessions godoc
+// @Summary 获取登录会话
+// @Description 获取当前用户的有效登录会话
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} res.Response{data=[]models.Session} "获取成功"
+// @Router /users/sessions [get]
+// @Security Bearer
+func (h *UserHandler) GetSessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	sessions, err := h.sessionService.ListSessions(userID)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, sessions)
+}
+
+// RevokeSession godoc
+// @Summary 注销会话
+// @Description 注销当前用户的指定登录会话
+// @Tags 认证
+// @Produce json
+// @Param session_id path string true "会话ID"
+// @Success 200 {object} res.Response "注销成功"
+// @Router /users/sessions/{session_id} [delete]
+// @Security Bearer
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	if err := h.sessionService.RevokeSession(userID, c.Param("session_id")); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "会话已注销", nil)
+}
+
+// ForgotPassword godoc
+// @Summary 忘记密码
+// @Description 向邮箱发送密码重置链接，邮箱未注册时同样返回成功
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body dto.ForgotPasswordRequest true "忘记密码请求"
+// @Success 200 {object} res.Response "发送成功"
+// @Router /users/password/forgot [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(req.Email); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "如果该邮箱已注册，重置邮件将很快送达", nil)
+}
+
+// ResetPassword godoc
+// @Summary 重置密码
+// @Description 使用邮件中的令牌重置密码，成功后所有设备需重新登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body dto.ResetPasswordRequest true "重置密码请求"
+// @Success 200 {object} res.Response "重置成功"
+// @Router /users/password/reset [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+
+	if err := h.accountService.ResetPassword(req.Token, req.Password); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "密码重置成功", nil)
+}
+
+// VerifyEmail godoc
+// @Summary 验证邮箱
+// @Description 使用邮件中的令牌验证邮箱，待验证的新邮箱在此时生效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body dto.VerifyEmailRequest true "验证邮箱请求"
+// @Success 200 {object} res.Response "验证成功"
+// @Router /users/email/verify [post]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req dto.VerifyEmailRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(req.Token); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "邮箱验证成功", nil)
+}
+
+// ResendEmailVerification godoc
+// @Summary 重新发送验证邮件
+// @Description 向当前用户的待验证邮箱重新发送验证邮件
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} res.Response "发送成功"
+// @Router /users/email/resend [post]
+// @Security Bearer
+func (h *UserHandler) ResendEmailVerification(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	if err := h.accountService.SendEmailVerification(userID); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "验证邮件已发送", nil)
+}
+
+// EnrollMFA godoc
+// @Summary 绑定双因素认证
+// @Description 生成TOTP密钥和 otpauth URI，需调用确认接口后才会生效
+// @Tags 双因素认证
+// @Produce json
+// @Success 200 {object} res.Response{data=vo.MFAEnrollmentResponse} "获取成功"
+// @Router /users/mfa/enroll [post]
+// @Security Bearer
+func (h *UserHandler) EnrollMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	enrollment, err := services.MFA.Enroll(userID)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, vo.MFAEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+// ConfirmMFA godoc
+// @Summary 确认绑定双因素认证
+// @Description 使用TOTP验证码确认绑定，返回的恢复码只展示一次；当前会话刷新令牌后即携带 mfa 声明
+// @Tags 双因素认证
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "验证码请求"
+// @Success 200 {object} res.Response{data=vo.RecoveryCodesResponse} "绑定成功"
+// @Router /users/mfa/confirm [post]
+// @Security Bearer
+func (h *UserHandler) ConfirmMFA(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	claims := c.MustGet("claims").(*jwt.Claims)
+
+	codes, err := services.MFA.Confirm(claims.UserID, claims.SessionID, req.Code)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "双因素认证已启用，请刷新令牌", vo.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA godoc
+// @Summary 关闭双因素认证
+// @Description 使用TOTP验证码或恢复码关闭双因素认证
+// @Tags 双因素认证
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "验证码请求"
+// @Success 200 {object} res.Response "关闭成功"
+// @Router /users/mfa [delete]
+// @Security Bearer
+func (h *UserHandler) DisableMFA(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	userID := c.MustGet("user_id").(uint)
+
+	if err := services.MFA.Disable(userID, req.Code); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "双因素认证已关闭", nil)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary 重新生成恢复码
+// @Description 使用TOTP验证码重新生成恢复码，旧恢复码全部失效
+// @Tags 双因素认证
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "验证码请求"
+// @Success 200 {object} res.Response{data=vo.RecoveryCodesResponse} "生成成功"
+// @Router /users/mfa/recovery-codes [post]
+// @Security Bearer
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := Bind(c, &req); err != nil {
+		return
+	}
+	userID := c.MustGet("user_id").(uint)
+
+	codes, err := services.MFA.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, vo.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetMFA godoc
+// @Summary 重置双因素认证
+// @Description 管理员重置用户的双因素认证，该用户的全部会话同时失效
+// @Tags 用户管理
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} res.Response "重置成功"
+// @Router /users/{id}/mfa/reset [post]
+// @Security Bearer
+func (h *UserHandler) ResetMFA(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		res.ErrInvalidParam.ThrowWithMessage(c, "无效的用户ID")
+		return
+	}
+
+	// 只能操作当前租户的用户
+	if _, err := h.userService.GetUserByID(c.Request.Context(), uint(id)); err != nil {
+		Error(c, err)
+		return
+	}
+
+	if err := services.MFA.Reset(uint(id)); err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithMessage(c, "双因素认证已重置", nil)
+}
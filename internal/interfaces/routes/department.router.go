@@ -1,29 +1,47 @@
 package routes
 
 import (
+	"gin-starter/internal/application/services/rbac"
 	"gin-starter/internal/interfaces/handlers"
+	"gin-starter/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 type DepartmentRouter struct {
-	deptHandler handlers.DepartmentHandler
+	deptHandler       handlers.DepartmentHandler
+	permissionHandler handlers.PermissionHandler
+	rbacHandler       handlers.RBACHandler
 }
 
 func NewDepartmentRouter() *DepartmentRouter {
 	return &DepartmentRouter{
-		deptHandler: *handlers.NewDepartmentHandler(),
+		deptHandler:       *handlers.NewDepartmentHandler(),
+		permissionHandler: *handlers.NewPermissionHandler(),
+		rbacHandler:       *handlers.NewRBACHandler(),
 	}
 }
 
 func (dr *DepartmentRouter) RegisterRoutes(router *gin.RouterGroup) {
 	departmentGroup := router.Group("/departments")
+	departmentGroup.Use(middleware.AuthMiddleware())
 	{
-		departmentGroup.POST("", dr.deptHandler.CreateDepartment)
 		departmentGroup.GET("", dr.deptHandler.GetAllDepartments)
 		departmentGroup.GET("/:id", dr.deptHandler.GetDepartment)
-		departmentGroup.PUT("/:id", dr.deptHandler.UpdateDepartment)
-		departmentGroup.DELETE("/:id", dr.deptHandler.DeleteDepartment)
 		departmentGroup.GET("/tree", dr.deptHandler.GetDepartmentTree)
 	}
+
+	// 修改部门及其成员和权限需要权限管理权限
+	manageGroup := router.Group("/departments")
+	manageGroup.Use(middleware.AuthMiddleware())
+	manageGroup.Use(middleware.PermissionMiddleware(rbac.ManageResource, rbac.ManageAction))
+	{
+		manageGroup.POST("", dr.deptHandler.CreateDepartment)
+		manageGroup.PUT("/:id", dr.deptHandler.UpdateDepartment)
+		manageGroup.DELETE("/:id", dr.deptHandler.DeleteDepartment)
+		manageGroup.GET("/:id/users", dr.rbacHandler.GetUsersForDepartment)
+		manageGroup.GET("/:id/permissions", dr.permissionHandler.GetDepartmentPermissions)
+		manageGroup.POST("/:id/permissions", dr.permissionHandler.GrantDepartmentPermissions)
+		manageGroup.DELETE("/:id/permissions/:name", dr.permissionHandler.RevokeDepartmentPermission)
+	}
 }
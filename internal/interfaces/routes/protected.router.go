@@ -1,7 +1,6 @@
 package routes
 
 import (
-	"gin-starter/internal/application/services/rbac"
 	"gin-starter/internal/middleware"
 	"gin-starter/pkg/utils/res"
 
@@ -24,7 +23,7 @@ func (pr *ProtectedRouter) RegisterRoutes(router *gin.RouterGroup) {
 
 	adminGroup := router.Group("/admin")
 	adminGroup.Use(middleware.AuthMiddleware())
-	adminGroup.Use(middleware.RoleMiddleware(rbac.GetRBAC(), "admin"))
+	adminGroup.Use(middleware.RoleMiddleware("admin"))
 	{
 		adminGroup.GET("/users", getUsers)
 		adminGroup.DELETE("/users/:id", deleteUser)
@@ -32,7 +31,7 @@ func (pr *ProtectedRouter) RegisterRoutes(router *gin.RouterGroup) {
 
 	departmentGroup := router.Group("/department")
 	departmentGroup.Use(middleware.AuthMiddleware())
-	departmentGroup.Use(middleware.DepartmentMiddleware(rbac.GetRBAC(), "IT"))
+	departmentGroup.Use(middleware.DepartmentMiddleware("IT"))
 	{
 		departmentGroup.GET("/resources", getDepartmentResources)
 	}
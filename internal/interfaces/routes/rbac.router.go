@@ -1,29 +1,70 @@
 package routes
 
 import (
+	"gin-starter/internal/application/services/rbac"
 	"gin-starter/internal/interfaces/handlers"
+	"gin-starter/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RBACRouter struct {
-	rabcHandler handlers.RBACHandler
+	rabcHandler       handlers.RBACHandler
+	roleHandler       handlers.RoleHandler
+	permissionHandler handlers.PermissionHandler
 }
 
 func NewRBACRouter() *RBACRouter {
 	return &RBACRouter{
-		rabcHandler: *handlers.NewRBACHandler(),
+		rabcHandler:       *handlers.NewRBACHandler(),
+		roleHandler:       *handlers.NewRoleHandler(),
+		permissionHandler: *handlers.NewPermissionHandler(),
 	}
 }
 
 func (rr *RBACRouter) RegisterRoutes(router *gin.RouterGroup) {
+	// 权限管理接口需要登录并拥有专用的管理权限，具体授予操作另有防越权校验
 	rbacGroup := router.Group("/rbac")
+	rbacGroup.Use(middleware.AuthMiddleware())
+	rbacGroup.Use(middleware.PermissionMiddleware(rbac.ManageResource, rbac.ManageAction))
 	{
 		rbacGroup.POST("/policy", rr.rabcHandler.AddPolicy)
+		rbacGroup.DELETE("/policy", rr.rabcHandler.RemovePolicy)
 		rbacGroup.POST("/role", rr.rabcHandler.AddRoleForUser)
+		rbacGroup.DELETE("/role", rr.rabcHandler.RemoveRoleForUser)
+		rbacGroup.GET("/users/:user_id/roles", rr.rabcHandler.GetRolesForUser)
+		// 旧路径，保留兼容
 		rbacGroup.GET("/roles/:user_id", rr.rabcHandler.GetRolesForUser)
 		rbacGroup.POST("/department", rr.rabcHandler.AddDepartmentForUser)
+		rbacGroup.DELETE("/department", rr.rabcHandler.RemoveDepartmentForUser)
+		rbacGroup.GET("/users/:user_id/departments", rr.rabcHandler.GetDepartmentsForUser)
+		// 旧路径，保留兼容
 		rbacGroup.GET("/departments/:user_id", rr.rabcHandler.GetDepartmentsForUser)
 		rbacGroup.POST("/enforce", rr.rabcHandler.RBACEnforce)
+		rbacGroup.POST("/dry-run", rr.rabcHandler.DryRun)
+		rbacGroup.GET("/rules", rr.rabcHandler.ListRules)
+		rbacGroup.DELETE("/rules", rr.rabcHandler.RemoveRules)
+		// 策略文件会修改全局的角色和权限目录，只允许超级管理员导入导出
+		rbacGroup.GET("/policy-file", middleware.SuperAdminMiddleware(), rr.rabcHandler.ExportPolicyFile)
+		rbacGroup.POST("/policy-file", middleware.SuperAdminMiddleware(), rr.rabcHandler.ImportPolicyFile)
+
+		// 角色和权限目录是所有租户共用的，只允许超级管理员修改，包括角色的数据范围
+		// 角色目录不使用 /roles，该路径保留给按用户查询角色的旧接口
+		rbacGroup.POST("/role-catalog", middleware.SuperAdminMiddleware(), rr.roleHandler.CreateRole)
+		rbacGroup.GET("/role-catalog", rr.roleHandler.GetAllRoles)
+		rbacGroup.GET("/role-catalog/:id", rr.roleHandler.GetRole)
+		rbacGroup.PUT("/role-catalog/:id", middleware.SuperAdminMiddleware(), rr.roleHandler.UpdateRole)
+		rbacGroup.DELETE("/role-catalog/:id", middleware.SuperAdminMiddleware(), rr.roleHandler.DeleteRole)
+		rbacGroup.PUT("/role-catalog/:id/data-scope", middleware.SuperAdminMiddleware(), rr.roleHandler.SetDataScope)
+		rbacGroup.GET("/role-catalog/:id/users", rr.rabcHandler.GetUsersForRole)
+		rbacGroup.GET("/role-catalog/:id/permissions", rr.permissionHandler.GetRolePermissions)
+		rbacGroup.POST("/role-catalog/:id/permissions", rr.permissionHandler.GrantRolePermissions)
+		rbacGroup.DELETE("/role-catalog/:id/permissions/:name", rr.permissionHandler.RevokeRolePermission)
+
+		rbacGroup.POST("/permissions", middleware.SuperAdminMiddleware(), rr.permissionHandler.CreatePermission)
+		rbacGroup.GET("/permissions", rr.permissionHandler.GetAllPermissions)
+		rbacGroup.GET("/permissions/:id", rr.permissionHandler.GetPermission)
+		rbacGroup.PUT("/permissions/:id", middleware.SuperAdminMiddleware(), rr.permissionHandler.UpdatePermission)
+		rbacGroup.DELETE("/permissions/:id", middleware.SuperAdminMiddleware(), rr.permissionHandler.DeletePermission)
 	}
 }
@@ -0,0 +1,599 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gin-starter/internal/application/services"
+	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	rbacModels "gin-starter/internal/domain/models/rbac"
+	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/database/dbtest"
+	"gin-starter/internal/middleware"
+	"gin-starter/pkg/utils/res"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rbacFixture 权限管理接口测试使用的数据
+// root 为超级管理员；manager 在默认租户中拥有 /rbac manage、editor 角色和部门 A；plain 没有任何角色
+// target 是默认租户中的普通用户，outsider 属于另一个租户
+type rbacFixture struct {
+	engine  *gin.Engine
+	tokens  map[string]string
+	users   map[string]uint
+	deptA   uint
+	deptB   uint
+	tenant2 uint
+}
+
+func setupRBACRoutes(t *testing.T) *rbacFixture {
+	t.Helper()
+	dbtest.Open(t)
+	if err := services.Tenant.EnsureDefaultTenant(); err != nil {
+		t.Fatalf("EnsureDefaultTenant: %v", err)
+	}
+	if err := rbac.InitRBAC(); err != nil {
+		t.Fatalf("InitRBAC: %v", err)
+	}
+	tenant2, err := services.Tenant.CreateTenant("acme", "")
+	if err != nil {
+		t.Fatalf("CreateTenant: %v", err)
+	}
+	db := database.GetDB()
+	for _, role := range []string{rbac.SuperAdminRole, "rbac_admin", "editor", "auditor"} {
+		if err := db.Create(&rbacModels.Role{Name: role}).Error; err != nil {
+			t.Fatalf("create role: %v", err)
+		}
+	}
+
+	f := &rbacFixture{tokens: map[string]string{}, users: map[string]uint{}, tenant2: tenant2.ID}
+	for _, name := range []string{"root", "manager", "plain", "target", "outsider"} {
+		user := &models.User{Username: name, Email: name + "@example.com", Password: "-", IsActive: true, TenantID: models.DefaultTenantID}
+		if name == "outsider" {
+			user.TenantID = tenant2.ID
+		}
+		if err := database.WithoutTenant(db).Create(user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		pair, err := services.Token.IssueTokenPair(user, "127.0.0.1", "test", true)
+		if err != nil {
+			t.Fatalf("IssueTokenPair: %v", err)
+		}
+		f.users[name] = user.ID
+		f.tokens[name] = pair.AccessToken
+	}
+
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	for i, name := range []string{"A", "B"} {
+		department, err := services.Department.CreateDepartment(ctx, name, "", nil)
+		if err != nil {
+			t.Fatalf("CreateDepartment: %v", err)
+		}
+		if i == 0 {
+			f.deptA = department.ID
+		} else {
+			f.deptB = department.ID
+		}
+	}
+
+	must := func(_ bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	must(rbac.AddRoleForUser(rbac.GetUserID(f.users["root"]), rbac.SuperAdminRole, rbac.AllDomains))
+	must(rbac.AddRoleForUser(rbac.GetUserID(f.users["manager"]), "rbac_admin", dom))
+	must(rbac.AddRoleForUser(rbac.GetUserID(f.users["manager"]), "editor", dom))
+	must(rbac.AddDepartmentForUser(rbac.GetUserID(f.users["manager"]), rbac.GetDepartmentSubject(f.deptA)))
+	must(rbac.AddPolicy("rbac_admin", rbac.AllDomains, rbac.ManageResource, rbac.ManageAction))
+	must(rbac.AddPolicy("rbac_admin", rbac.AllDomains, "/articles/*", "GET|POST"))
+	must(rbac.AddPolicyRule("rbac_admin", dom, "/articles/secret", "POST", rbac.NoCondition, rbac.EffectDeny))
+
+	gin.SetMode(gin.TestMode)
+	f.engine = gin.New()
+	NewRBACRouter().RegisterRoutes(f.engine.Group(""))
+	return f
+}
+
+// do 以指定用户发送请求并返回业务码，user 为空时不携带令牌
+func (f *rbacFixture) do(t *testing.T, user, method, path string, body any) int {
+	t.Helper()
+	return f.request(t, user, method, path, body, nil)
+}
+
+// request 以指定用户发送请求，返回业务码并在 data 不为 nil 时解析响应数据
+func (f *rbacFixture) request(t *testing.T, user, method, path string, body, data any) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.Header.Set("Authorization", "Bearer "+f.tokens[user])
+	}
+	w := httptest.NewRecorder()
+	f.engine.ServeHTTP(w, req)
+	resp := res.Response{Data: &json.RawMessage{}}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: invalid response %q", method, path, w.Body.String())
+	}
+	if data != nil {
+		if err := json.Unmarshal(*resp.Data.(*json.RawMessage), data); err != nil {
+			t.Fatalf("%s %s: invalid data %q", method, path, w.Body.String())
+		}
+	}
+	return resp.Code
+}
+
+func TestRBACRoutesRequireManagePermission(t *testing.T) {
+	f := setupRBACRoutes(t)
+	cases := []struct {
+		name, user, method, path string
+		want                     int
+	}{
+		{"no token", "", http.MethodGet, "/rbac/rules?type=g", res.ErrTokenRequired.Code},
+		{"no token on write", "", http.MethodPost, "/rbac/role", res.ErrTokenRequired.Code},
+		{"without manage permission", "plain", http.MethodGet, "/rbac/rules?type=g", res.ErrForbidden.Code},
+		{"without manage permission on write", "plain", http.MethodPost, "/rbac/policy", res.ErrForbidden.Code},
+		{"with manage permission", "manager", http.MethodGet, "/rbac/rules?type=g", 20000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := f.do(t, tc.user, tc.method, tc.path, nil); got != tc.want {
+				t.Fatalf("code = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRBACRoutesBlockEscalation(t *testing.T) {
+	f := setupRBACRoutes(t)
+	denied := res.ErrInsufficientPermissions.Code
+	cases := []struct {
+		name, method, path string
+		body               any
+		want               int
+	}{
+		// CheckSubject
+		{"modify super admin", http.MethodPost, "/rbac/role",
+			map[string]any{"user_id": f.users["root"], "role": "editor"}, denied},
+		{"add policy to super_admin", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": rbac.SuperAdminRole, "obj": "/articles/1", "act": "GET"}, denied},
+		// ResolveDomain
+		{"other tenant domain", http.MethodPost, fmt.Sprintf("/rbac/role?domain=%d", f.tenant2),
+			map[string]any{"user_id": f.users["target"], "role": "editor"}, denied},
+		{"global domain", http.MethodPost, "/rbac/policy?domain=*",
+			map[string]any{"sub": "editor", "obj": "/articles/1", "act": "GET"}, denied},
+		// CheckUserDomain
+		{"user from another tenant", http.MethodPost, "/rbac/role",
+			map[string]any{"user_id": f.users["outsider"], "role": "editor"}, res.ErrInvalidParam.Code},
+		// CheckRole
+		{"role not held", http.MethodPost, "/rbac/role",
+			map[string]any{"user_id": f.users["target"], "role": "auditor"}, denied},
+		{"grant super_admin", http.MethodPost, "/rbac/role",
+			map[string]any{"user_id": f.users["target"], "role": rbac.SuperAdminRole}, denied},
+		// CheckDepartment
+		{"department not joined", http.MethodPost, "/rbac/department",
+			map[string]any{"user_id": f.users["target"], "department_id": f.deptB}, denied},
+		// CheckPolicy
+		{"resource not held", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/reports/*", "act": "GET"}, denied},
+		{"broader action", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/articles/*", "act": "*"}, denied},
+		{"action matched only as substring", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/articles/1", "act": "GETX"}, denied},
+		{"broader resource", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "*", "act": "GET"}, denied},
+		{"allow overlapping own deny", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/articles/secret", "act": "POST"}, denied},
+		// 在自己的权限范围内可以授予
+		{"grant held role", http.MethodPost, "/rbac/role",
+			map[string]any{"user_id": f.users["target"], "role": "editor"}, 20000},
+		{"grant held department", http.MethodPost, "/rbac/department",
+			map[string]any{"user_id": f.users["target"], "department_id": f.deptA}, 20000},
+		{"grant covered policy", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/articles/1", "act": "GET"}, 20000},
+		{"deny within own permissions", http.MethodPost, "/rbac/policy",
+			map[string]any{"sub": "editor", "obj": "/articles/2", "act": "POST", "eft": "deny"}, 20000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := f.do(t, "manager", tc.method, tc.path, tc.body); got != tc.want {
+				t.Fatalf("code = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRBACRoutesSuperAdminBypassesGuard(t *testing.T) {
+	f := setupRBACRoutes(t)
+	body := map[string]any{"user_id": f.users["target"], "role": "auditor"}
+	if got := f.do(t, "root", http.MethodPost, "/rbac/role", body); got != 20000 {
+		t.Fatalf("code = %d, want 20000", got)
+	}
+}
+
+func TestRBACRoutesCatalogRequiresSuperAdmin(t *testing.T) {
+	f := setupRBACRoutes(t)
+	var editor rbacModels.Role
+	if err := database.GetDB().Where("name = ?", "editor").First(&editor).Error; err != nil {
+		t.Fatal(err)
+	}
+	permission := map[string]any{"name": "article.read", "resource": "/articles/*", "action": "GET"}
+	cases := []struct {
+		name, method, path string
+		body               any
+	}{
+		{"create role", http.MethodPost, "/rbac/role-catalog", map[string]any{"name": "writer"}},
+		{"update role", http.MethodPut, fmt.Sprintf("/rbac/role-catalog/%d", editor.ID), map[string]any{"name": "author"}},
+		{"delete role", http.MethodDelete, fmt.Sprintf("/rbac/role-catalog/%d", editor.ID), nil},
+		{"set role data scope", http.MethodPut, fmt.Sprintf("/rbac/role-catalog/%d/data-scope", editor.ID), map[string]any{"data_scope": "self"}},
+		{"create permission", http.MethodPost, "/rbac/permissions", permission},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := f.do(t, "manager", tc.method, tc.path, tc.body); got != res.ErrForbidden.Code {
+				t.Fatalf("manager: code = %d, want %d", got, res.ErrForbidden.Code)
+			}
+		})
+	}
+	if got := f.do(t, "root", http.MethodPost, "/rbac/permissions", permission); got != 20000 {
+		t.Fatalf("root create permission: code = %d, want 20000", got)
+	}
+	var created rbacModels.Permission
+	if err := database.GetDB().Where("name = ?", "article.read").First(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/rbac/permissions/%d", created.ID)
+	update := map[string]any{"name": "article.read", "resource": "/articles/*", "action": "GET|HEAD"}
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		if got := f.do(t, "manager", method, path, update); got != res.ErrForbidden.Code {
+			t.Fatalf("manager %s permission: code = %d, want %d", method, got, res.ErrForbidden.Code)
+		}
+	}
+	if got := f.do(t, "root", http.MethodPost, "/rbac/role-catalog", map[string]any{"name": "writer"}); got != 20000 {
+		t.Fatalf("root create role: code = %d, want 20000", got)
+	}
+	if got := f.do(t, "manager", http.MethodGet, "/rbac/role-catalog", nil); got != 20000 {
+		t.Fatalf("manager list roles: code = %d, want 20000", got)
+	}
+}
+
+func TestRBACRoutesDepartmentRulesScopedToTenant(t *testing.T) {
+	f := setupRBACRoutes(t)
+	ctx := database.WithTenant(context.Background(), f.tenant2)
+	parent, err := services.Department.CreateDepartment(ctx, "Sales", "", nil)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	child, err := services.Department.CreateDepartment(ctx, "Sales/EU", "", &parent.ID)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	outsider := rbac.GetUserID(f.users["outsider"])
+	if _, err := rbac.AddDepartmentForUser(outsider, rbac.GetDepartmentSubject(child.ID)); err != nil {
+		t.Fatal(err)
+	}
+	membership := []string{outsider, rbac.GetDepartmentSubject(child.ID)}
+	hierarchy := []string{rbac.GetDepartmentSubject(child.ID), rbac.GetDepartmentSubject(parent.ID)}
+
+	var list struct {
+		Rules [][]string `json:"rules"`
+	}
+	if got := f.request(t, "manager", http.MethodGet, "/rbac/rules?type=g2&page_size=100", nil, &list); got != 20000 {
+		t.Fatalf("list: code = %d, want 20000", got)
+	}
+	manager := []string{rbac.GetUserID(f.users["manager"]), rbac.GetDepartmentSubject(f.deptA)}
+	if len(list.Rules) != 1 || !slices.Equal(list.Rules[0], manager) {
+		t.Fatalf("manager sees %v, want only %v", list.Rules, manager)
+	}
+	if got := f.request(t, "root", http.MethodGet, "/rbac/rules?type=g2&page_size=100&domain=*", nil, &list); got != 20000 || len(list.Rules) != 3 {
+		t.Fatalf("root sees %v (code %d), want all 3 rules", list.Rules, got)
+	}
+
+	for name, rule := range map[string][]string{"membership": membership, "hierarchy": hierarchy} {
+		body := map[string]any{"type": rbac.DepartmentRule, "rules": [][]string{rule}}
+		if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", body); got != res.ErrInsufficientPermissions.Code {
+			t.Fatalf("remove %s: code = %d, want %d", name, got, res.ErrInsufficientPermissions.Code)
+		}
+	}
+	departments, err := rbac.GetDepartmentsForUser(outsider)
+	if err != nil || len(departments) != 1 {
+		t.Fatalf("outsider departments = %v, %v; want membership kept", departments, err)
+	}
+
+	body := map[string]any{"type": rbac.DepartmentRule, "rules": [][]string{manager}}
+	if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", body); got != 20000 {
+		t.Fatalf("remove own tenant rule: code = %d, want 20000", got)
+	}
+}
+
+func TestRBACRoutesProtectOwnDenies(t *testing.T) {
+	f := setupRBACRoutes(t)
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	deptA := rbac.GetDepartmentSubject(f.deptA)
+	for _, sub := range []string{deptA, "auditor"} {
+		if _, err := rbac.AddPolicyRule(sub, dom, "/articles/draft", "GET", rbac.NoCondition, rbac.EffectDeny); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manager := rbac.GetUserID(f.users["manager"])
+	ownDeny := map[string]any{"sub": "rbac_admin", "obj": "/articles/secret", "act": "POST", "eft": "deny"}
+	denied := res.ErrInsufficientPermissions.Code
+	cases := []struct {
+		name, user, method, path string
+		body                     any
+		want                     int
+	}{
+		{"deny on own role", "manager", http.MethodDelete, "/rbac/policy", ownDeny, denied},
+		{"deny on own department", "manager", http.MethodDelete, "/rbac/policy",
+			map[string]any{"sub": deptA, "obj": "/articles/draft", "act": "GET", "eft": "deny"}, denied},
+		{"deny rule on own role", "manager", http.MethodDelete, "/rbac/rules", map[string]any{"type": rbac.PolicyRule,
+			"rules": [][]string{{"rbac_admin", dom, "/articles/secret", "POST", rbac.NoCondition, rbac.EffectDeny}}}, denied},
+		{"own link to deny-bearing role", "manager", http.MethodDelete, "/rbac/role",
+			map[string]any{"user_id": f.users["manager"], "role": "rbac_admin"}, denied},
+		{"own g rule to deny-bearing role", "manager", http.MethodDelete, "/rbac/rules", map[string]any{"type": rbac.RoleRule,
+			"rules": [][]string{{manager, "rbac_admin", dom}}}, denied},
+		{"own link to deny-bearing department", "manager", http.MethodDelete, "/rbac/department",
+			map[string]any{"user_id": f.users["manager"], "department_id": f.deptA}, denied},
+		{"own g2 rule to deny-bearing department", "manager", http.MethodDelete, "/rbac/rules", map[string]any{"type": rbac.DepartmentRule,
+			"rules": [][]string{{manager, deptA}}}, denied},
+		// 不作用于自己的拒绝策略和关系可以删除
+		{"deny on role not held", "manager", http.MethodDelete, "/rbac/policy",
+			map[string]any{"sub": "auditor", "obj": "/articles/draft", "act": "GET", "eft": "deny"}, 20000},
+		{"own link without denies", "manager", http.MethodDelete, "/rbac/role",
+			map[string]any{"user_id": f.users["manager"], "role": "editor"}, 20000},
+		{"super admin removes deny", "root", http.MethodDelete, "/rbac/policy", ownDeny, 20000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := f.do(t, tc.user, tc.method, tc.path, tc.body); got != tc.want {
+				t.Fatalf("code = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRBACRoutesLegacyUserRolesPath(t *testing.T) {
+	f := setupRBACRoutes(t)
+	manager := f.users["manager"]
+	for _, path := range []string{fmt.Sprintf("/rbac/roles/%d", manager), fmt.Sprintf("/rbac/users/%d/roles", manager)} {
+		var roles []string
+		if got := f.request(t, "manager", http.MethodGet, path, nil, &roles); got != 20000 {
+			t.Fatalf("GET %s = %d, want 20000", path, got)
+		}
+		slices.Sort(roles)
+		if !slices.Equal(roles, []string{"editor", "rbac_admin"}) {
+			t.Fatalf("GET %s = %v, want the user's roles", path, roles)
+		}
+	}
+	var role rbacModels.Role
+	if err := database.GetDB().Where("name = ?", "editor").First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	var found rbacModels.Role
+	if got := f.request(t, "manager", http.MethodGet, fmt.Sprintf("/rbac/role-catalog/%d", role.ID), nil, &found); got != 20000 || found.Name != "editor" {
+		t.Fatalf("role catalog lookup = %d %q, want editor", got, found.Name)
+	}
+}
+
+func TestRBACRoutesRuleListPagination(t *testing.T) {
+	f := setupRBACRoutes(t)
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	var objects []string
+	for i := range 5 {
+		obj := fmt.Sprintf("/reports/%d", i)
+		if _, err := rbac.AddPolicy("auditor", dom, obj, "GET"); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, obj)
+	}
+
+	type ruleList struct {
+		Rules    [][]string `json:"rules"`
+		Total    int        `json:"total"`
+		Page     int        `json:"page"`
+		PageSize int        `json:"page_size"`
+	}
+	list := func(query string) ruleList {
+		t.Helper()
+		var data ruleList
+		if got := f.request(t, "manager", http.MethodGet, "/rbac/rules?type=p&v0=auditor"+query, nil, &data); got != 20000 {
+			t.Fatalf("list %q: code = %d, want 20000", query, got)
+		}
+		return data
+	}
+
+	// 分页之间不重复，合起来是全部规则
+	var seen []string
+	for page, want := range []int{2, 2, 1} {
+		data := list(fmt.Sprintf("&page=%d&page_size=2", page+1))
+		if data.Total != 5 || data.Page != page+1 || data.PageSize != 2 || len(data.Rules) != want {
+			t.Fatalf("page %d = %+v, want %d of 5 rules", page+1, data, want)
+		}
+		for _, rule := range data.Rules {
+			if rule[0] != "auditor" || rule[1] != dom {
+				t.Fatalf("page %d contains %v, want only auditor rules", page+1, rule)
+			}
+			seen = append(seen, rule[2])
+		}
+	}
+	slices.Sort(seen)
+	if !slices.Equal(seen, objects) {
+		t.Fatalf("pages contain %v, want %v", seen, objects)
+	}
+	if data := list("&page=4&page_size=2"); data.Total != 5 || len(data.Rules) != 0 {
+		t.Fatalf("page past the end = %+v, want no rules", data)
+	}
+	if data := list(""); data.Page != 1 || data.PageSize != 20 || len(data.Rules) != 5 {
+		t.Fatalf("default page = %+v, want all 5 rules", data)
+	}
+	if data := list("&v2=/reports/3"); data.Total != 1 || data.Rules[0][2] != "/reports/3" {
+		t.Fatalf("filtered by v2 = %+v, want /reports/3 only", data)
+	}
+	for _, query := range []string{"/rbac/rules?type=x", "/rbac/rules?type=p&page_size=101"} {
+		if got := f.do(t, "manager", http.MethodGet, query, nil); got != res.ErrInvalidParam.Code {
+			t.Fatalf("GET %s = %d, want %d", query, got, res.ErrInvalidParam.Code)
+		}
+	}
+
+	remove := map[string]any{"type": rbac.PolicyRule, "rules": [][]string{
+		{"auditor", dom, "/reports/0", "GET"},
+		{"auditor", dom, "/reports/1", "GET"},
+	}}
+	if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", remove); got != 20000 {
+		t.Fatalf("remove rules: code = %d, want 20000", got)
+	}
+	if data := list(""); data.Total != 3 {
+		t.Fatalf("after removal = %+v, want 3 rules", data)
+	}
+	// 删除已不存在的规则不报错，也不影响其他规则
+	if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", remove); got != 20000 {
+		t.Fatalf("remove missing rules: code = %d, want 20000", got)
+	}
+	if data := list(""); data.Total != 3 {
+		t.Fatalf("after removing missing rules = %+v, want 3 rules", data)
+	}
+	empty := map[string]any{"type": rbac.PolicyRule, "rules": [][]string{}}
+	if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", empty); got != res.ErrInvalidParam.Code {
+		t.Fatalf("remove no rules: code = %d, want %d", got, res.ErrInvalidParam.Code)
+	}
+}
+
+func TestRBACRoutesListExpiringGrants(t *testing.T) {
+	f := setupRBACRoutes(t)
+	dom := rbac.GetTenantDomain(models.DefaultTenantID)
+	now := time.Now().Truncate(time.Second)
+	in := func(d time.Duration) rbac.GrantWindow {
+		until := now.Add(d)
+		return rbac.GrantWindow{ValidUntil: &until}
+	}
+	target, plain := rbac.GetUserID(f.users["target"]), rbac.GetUserID(f.users["plain"])
+	grants := []struct {
+		user, role, dom string
+		window          rbac.GrantWindow
+	}{
+		{target, "editor", dom, in(2 * time.Hour)},
+		{plain, "auditor", dom, in(30 * time.Minute)},
+		{plain, "editor", dom, in(48 * time.Hour)},
+		{rbac.GetUserID(f.users["outsider"]), "editor", rbac.GetTenantDomain(f.tenant2), in(time.Hour)},
+	}
+	for _, grant := range grants {
+		if _, err := rbac.AddRoleForUserWithWindow(grant.user, grant.role, grant.dom, grant.window); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deptB := rbac.GetDepartmentSubject(f.deptB)
+	if _, err := rbac.AddDepartmentForUserWithWindow(target, deptB, in(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	type ruleList struct {
+		Rules   [][]string         `json:"rules"`
+		Windows []rbac.GrantWindow `json:"windows"`
+		Total   int                `json:"total"`
+	}
+	list := func(query string) ruleList {
+		t.Helper()
+		var data ruleList
+		if got := f.request(t, "manager", http.MethodGet, "/rbac/rules?"+query, nil, &data); got != 20000 {
+			t.Fatalf("list %q: code = %d, want 20000", query, got)
+		}
+		if len(data.Windows) != len(data.Rules) {
+			t.Fatalf("list %q returned %d windows for %d rules", query, len(data.Windows), len(data.Rules))
+		}
+		return data
+	}
+	expect := func(data ruleList, rules [][]string, windows []rbac.GrantWindow) {
+		t.Helper()
+		if data.Total != len(rules) || !slices.EqualFunc(data.Rules, rules, slices.Equal) {
+			t.Fatalf("rules = %v (total %d), want %v", data.Rules, data.Total, rules)
+		}
+		for i, window := range windows {
+			if !data.Windows[i].Equal(window) {
+				t.Fatalf("window of %v = %+v, want %+v", rules[i], data.Windows[i], window)
+			}
+		}
+	}
+
+	// 只返回当前租户中在时限内到期的分配，最先到期的在前；长期有效和其他租户的分配不返回
+	expect(list("type=g&expiring_within=24h"),
+		[][]string{{plain, "auditor", dom}, {target, "editor", dom}},
+		[]rbac.GrantWindow{grants[1].window, grants[0].window})
+	expect(list("type=g&expiring_within=24h&v0="+target), [][]string{{target, "editor", dom}}, []rbac.GrantWindow{grants[0].window})
+	expect(list("type=g2&expiring_within=2h"), [][]string{{target, deptB}}, []rbac.GrantWindow{in(time.Hour)})
+	expect(list("type=g&expiring_within=1m"), nil, nil)
+
+	// 不限时长时长期有效的分配同样返回，两个时间均为空
+	all := list("type=g")
+	if all.Total <= 3 {
+		t.Fatalf("all grants = %+v, want permanent grants as well", all)
+	}
+	for i, rule := range all.Rules {
+		if rule[0] == rbac.GetUserID(f.users["manager"]) && !all.Windows[i].Permanent() {
+			t.Fatalf("window of permanent grant %v = %+v", rule, all.Windows[i])
+		}
+	}
+	if got := f.do(t, "manager", http.MethodGet, "/rbac/rules?type=g&expiring_within=soon", nil); got != res.ErrInvalidParam.Code {
+		t.Fatalf("invalid duration: code = %d, want %d", got, res.ErrInvalidParam.Code)
+	}
+
+	// 删除的分配不再出现在到期列表中
+	remove := map[string]any{"type": rbac.RoleRule, "rules": [][]string{{plain, "auditor", dom}}}
+	if got := f.do(t, "manager", http.MethodDelete, "/rbac/rules", remove); got != 20000 {
+		t.Fatalf("remove rules: code = %d, want 20000", got)
+	}
+	expect(list("type=g&expiring_within=24h"), [][]string{{target, "editor", dom}}, []rbac.GrantWindow{grants[0].window})
+}
+
+func TestDepartmentMiddlewareAdmitsSubDepartments(t *testing.T) {
+	f := setupRBACRoutes(t)
+	ctx := database.WithTenant(context.Background(), models.DefaultTenantID)
+	child, err := services.Department.CreateDepartment(ctx, "A/1", "", &f.deptA)
+	if err != nil {
+		t.Fatalf("CreateDepartment: %v", err)
+	}
+	if _, err := rbac.AddDepartmentForUser(rbac.GetUserID(f.users["target"]), rbac.GetDepartmentSubject(child.ID)); err != nil {
+		t.Fatal(err)
+	}
+	probe := f.engine.Group("/probe", middleware.AuthMiddleware())
+	probe.GET("/a", middleware.DepartmentMiddleware("A"), func(c *gin.Context) { res.Success(c, nil) })
+	probe.GET("/child", middleware.DepartmentMiddleware("A/1"), func(c *gin.Context) { res.Success(c, nil) })
+	probe.GET("/b", middleware.DepartmentMiddleware("B"), func(c *gin.Context) { res.Success(c, nil) })
+
+	cases := []struct {
+		user, path string
+		want       int
+	}{
+		{"manager", "/probe/a", 20000},
+		{"target", "/probe/a", 20000}, // A/1 的成员同样属于 A
+		{"target", "/probe/child", 20000},
+		{"manager", "/probe/child", res.ErrForbidden.Code}, // 上级部门的成员不属于下级部门
+		{"target", "/probe/b", res.ErrForbidden.Code},
+		{"plain", "/probe/a", res.ErrForbidden.Code},
+		{"root", "/probe/b", 20000},
+	}
+	for _, tc := range cases {
+		if got := f.do(t, tc.user, http.MethodGet, tc.path, nil); got != tc.want {
+			t.Fatalf("%s GET %s = %d, want %d", tc.user, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"gin-starter/internal/interfaces/handlers"
+	"gin-starter/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantRouter struct {
+	tenantHandler handlers.TenantHandler
+}
+
+func NewTenantRouter() *TenantRouter {
+	return &TenantRouter{
+		tenantHandler: *handlers.NewTenantHandler(),
+	}
+}
+
+func (tr *TenantRouter) RegisterRoutes(router *gin.RouterGroup) {
+	// 租户管理跨越所有租户，只有超级管理员可以访问
+	tenantGroup := router.Group("/tenants")
+	tenantGroup.Use(middleware.AuthMiddleware())
+	tenantGroup.Use(middleware.SuperAdminMiddleware())
+	{
+		tenantGroup.POST("", tr.tenantHandler.CreateTenant)
+		tenantGroup.GET("", tr.tenantHandler.GetAllTenants)
+		tenantGroup.GET("/:id", tr.tenantHandler.GetTenant)
+		tenantGroup.PUT("/:id", tr.tenantHandler.UpdateTenant)
+		tenantGroup.DELETE("/:id", tr.tenantHandler.DeleteTenant)
+		tenantGroup.GET("/:id/users", tr.tenantHandler.GetTenantUsers)
+		tenantGroup.PUT("/:id/users/:user_id", tr.tenantHandler.MoveUser)
+	}
+}
@@ -10,12 +10,14 @@ import (
 
 // UserRouter 使用中间件简化处理的路由
 type UserRouter struct {
-	userHandler handlers.UserHandler
+	userHandler   handlers.UserHandler
+	apiKeyHandler handlers.APIKeyHandler
 }
 
 func NewUserRouter() *UserRouter {
 	return &UserRouter{
-		userHandler: *handlers.NewUserHandler(),
+		userHandler:   *handlers.NewUserHandler(),
+		apiKeyHandler: *handlers.NewAPIKeyHandler(),
 	}
 }
 
@@ -28,29 +30,114 @@ func (ur *UserRouter) RegisterRoutes(router *gin.RouterGroup) {
 			ur.userHandler.CreateUser,
 		)
 
-		userGroup.GET("", ur.userHandler.GetAllUsers)
+		userGroup.POST("/login",
+			middleware.BindRequest(&dto.LoginRequest{}),
+			ur.userHandler.Login,
+		)
+
+		userGroup.POST("/login/mfa",
+			middleware.BindRequest(&dto.MFALoginRequest{}),
+			ur.userHandler.LoginMFA,
+		)
+
+		userGroup.GET("/oidc/login", ur.userHandler.OIDCLogin)
+
+		userGroup.GET("/oidc/callback", ur.userHandler.OIDCCallback)
+
+		userGroup.POST("/token/refresh",
+			middleware.BindRequest(&dto.RefreshTokenRequest{}),
+			ur.userHandler.RefreshToken,
+		)
+
+		userGroup.POST("/password/forgot",
+			middleware.BindRequest(&dto.ForgotPasswordRequest{}),
+			ur.userHandler.ForgotPassword,
+		)
+
+		userGroup.POST("/password/reset",
+			middleware.BindRequest(&dto.ResetPasswordRequest{}),
+			ur.userHandler.ResetPassword,
+		)
+
+		userGroup.POST("/email/verify",
+			middleware.BindRequest(&dto.VerifyEmailRequest{}),
+			ur.userHandler.VerifyEmail,
+		)
+	}
+
+	// 以下路由不要求令牌已通过双因素认证，保证被强制启用的用户能够完成绑定或退出登录
+	mfaGroup := router.Group("/users")
+	mfaGroup.Use(middleware.MFAEnrollmentAuthMiddleware())
+	{
+		mfaGroup.POST("/logout", ur.userHandler.Logout)
+
+		mfaGroup.POST("/logout/all", ur.userHandler.LogoutAll)
+
+		mfaGroup.POST("/mfa/enroll", ur.userHandler.EnrollMFA)
+
+		mfaGroup.POST("/mfa/confirm",
+			middleware.BindRequest(&dto.MFACodeRequest{}),
+			ur.userHandler.ConfirmMFA,
+		)
+	}
+
+	// 以下路由只需要登录，用于管理当前用户自己的会话和账号，不接受API密钥
+	sessionGroup := router.Group("/users")
+	sessionGroup.Use(middleware.UserAuthMiddleware())
+	{
+		sessionGroup.GET("/sessions", ur.userHandler.GetSessions)
+
+		sessionGroup.DELETE("/sessions/:session_id", ur.userHandler.RevokeSession)
+
+		sessionGroup.POST("/email/resend", ur.userHandler.ResendEmailVerification)
+
+		sessionGroup.DELETE("/mfa",
+			middleware.BindRequest(&dto.MFACodeRequest{}),
+			ur.userHandler.DisableMFA,
+		)
+
+		sessionGroup.POST("/mfa/recovery-codes",
+			middleware.BindRequest(&dto.MFACodeRequest{}),
+			ur.userHandler.RegenerateRecoveryCodes,
+		)
+
+		sessionGroup.GET("/api-keys", ur.apiKeyHandler.GetAPIKeys)
 
-		userGroup.GET("/:id", ur.userHandler.GetUser)
+		sessionGroup.POST("/api-keys",
+			middleware.BindRequest(&dto.CreateAPIKeyRequest{}),
+			ur.apiKeyHandler.CreateAPIKey,
+		)
+
+		sessionGroup.DELETE("/api-keys/:key_id", ur.apiKeyHandler.RevokeAPIKey)
+	}
+
+	// 以下路由需要登录并通过Casbin策略校验
+	authorizedGroup := router.Group("/users")
+	authorizedGroup.Use(middleware.AuthMiddleware())
+	authorizedGroup.Use(middleware.AuthorizationMiddleware())
+	{
+		authorizedGroup.GET("", ur.userHandler.GetAllUsers)
+
+		authorizedGroup.GET("/:id", ur.userHandler.GetUser)
 
-		userGroup.PUT("/:id",
+		authorizedGroup.PUT("/:id",
 			middleware.BindRequest(&dto.UpdateUserRequest{}),
 			ur.userHandler.UpdateUser,
 		)
 
-		userGroup.DELETE("/:id", ur.userHandler.DeleteUser)
+		authorizedGroup.DELETE("/:id", ur.userHandler.DeleteUser)
 
-		userGroup.POST("/:id/activate", ur.userHandler.ActivateUser)
+		authorizedGroup.POST("/:id/activate", ur.userHandler.ActivateUser)
 
-		userGroup.POST("/:id/deactivate", ur.userHandler.DeactivateUser)
+		authorizedGroup.POST("/:id/deactivate", ur.userHandler.DeactivateUser)
 
-		userGroup.PUT("/:id/email",
+		authorizedGroup.POST("/:id/unlock", ur.userHandler.UnlockUser)
+
+		authorizedGroup.PUT("/:id/email",
 			middleware.BindRequest(&dto.ChangeEmailRequest{}),
 			ur.userHandler.ChangeEmail,
 		)
 
-		userGroup.POST("/login",
-			middleware.BindRequest(&dto.LoginRequest{}),
-			ur.userHandler.Login,
-		)
+		authorizedGroup.POST("/:id/mfa/reset", ur.userHandler.ResetMFA)
 	}
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"gin-starter/internal/interfaces/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WellKnownRouter struct {
+	jwksHandler handlers.JWKSHandler
+}
+
+func NewWellKnownRouter() *WellKnownRouter {
+	return &WellKnownRouter{
+		jwksHandler: *handlers.NewJWKSHandler(),
+	}
+}
+
+func (wr *WellKnownRouter) RegisterRoutes(router *gin.RouterGroup) {
+	wellKnownGroup := router.Group("/.well-known")
+	{
+		wellKnownGroup.GET("/jwks.json", wr.jwksHandler.GetJWKS)
+	}
+}
@@ -10,18 +10,24 @@ import (
 
 // fieldNameMap 字段名称中英文映射
 var fieldNameMap = map[string]string{
-	"Username":    "用户名",
-	"Password":    "密码",
-	"Email":       "邮箱",
-	"Name":        "名称",
-	"Description": "描述",
-	"ParentID":    "父级ID",
-	"UserID":      "用户ID",
-	"Role":        "角色",
-	"Department":  "部门",
-	"Sub":         "主体",
-	"Obj":         "对象",
-	"Act":         "操作",
+	"Username":     "用户名",
+	"Password":     "密码",
+	"Email":        "邮箱",
+	"Name":         "名称",
+	"Description":  "描述",
+	"ParentID":     "父级ID",
+	"UserID":       "用户ID",
+	"Role":         "角色",
+	"Department":   "部门",
+	"Sub":          "主体",
+	"Obj":          "对象",
+	"Act":          "操作",
+	"RefreshToken": "刷新令牌",
+	"Token":        "令牌",
+	"MFAToken":     "双因素认证令牌",
+	"Code":         "验证码",
+	"Scopes":       "范围",
+	"Roles":        "角色",
 }
 
 // getFieldName 获取字段中文名称
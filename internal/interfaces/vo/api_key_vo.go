@@ -0,0 +1,22 @@
+package vo
+
+import "time"
+
+// APIKeyVO API密钥视图对象
+type APIKeyVO struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"`
+	Scopes         []string   `json:"scopes"`
+	ServiceAccount bool       `json:"service_account"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyResponse 创建API密钥响应，Key 只返回这一次
+type CreateAPIKeyResponse struct {
+	APIKeyVO
+	Key string `json:"key"`
+}
@@ -0,0 +1,35 @@
+package vo
+
+import (
+	rbacService "gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models/rbac"
+)
+
+// SubjectPermissionsVO 角色或部门的权限视图对象
+// Permissions 为权限目录中的命名权限，Policies 为无法对应到目录的原始策略 [sub, dom, obj, act, cond, eft]
+type SubjectPermissionsVO struct {
+	Permissions []*rbac.Permission `json:"permissions"`
+	Policies    [][]string         `json:"policies"`
+}
+
+// RoleVO 角色视图对象
+type RoleVO struct {
+	*rbac.Role
+	SubjectPermissionsVO
+}
+
+// RuleListVO 规则分页列表视图对象
+// Windows 只在查询 g、g2 规则时返回，与 Rules 一一对应，长期有效的分配两个时间均为空
+type RuleListVO struct {
+	Rules    [][]string                `json:"rules"`
+	Windows  []rbacService.GrantWindow `json:"windows,omitempty"`
+	Total    int                       `json:"total"`
+	Page     int                       `json:"page"`
+	PageSize int                       `json:"page_size"`
+}
+
+// DryRunVO 策略变更预演视图对象，Flipped 为结果会改变的请求数量
+type DryRunVO struct {
+	Decisions []rbacService.Decision `json:"decisions"`
+	Flipped   int                    `json:"flipped"`
+}
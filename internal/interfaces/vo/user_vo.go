@@ -4,13 +4,15 @@ import "time"
 
 // UserVO 用户视图对象
 type UserVO struct {
-	ID        uint      `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FullName  string    `json:"full_name"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uint      `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	FullName      string    `json:"full_name"`
+	TenantID      uint      `json:"tenant_id"`
+	IsActive      bool      `json:"is_active"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // UserListVO 用户列表视图对象
@@ -20,8 +22,32 @@ type UserListVO struct {
 }
 
 // LoginResponse 登录响应VO
+// 启用双因素认证的用户第一步只返回 MFAToken，需调用 /users/login/mfa 完成登录
 type LoginResponse struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expires_at"`
-	User      UserVO `json:"user"`
+	Token            string  `json:"token,omitempty"`
+	ExpiresAt        int64   `json:"expires_at,omitempty"`
+	RefreshToken     string  `json:"refresh_token,omitempty"`
+	RefreshExpiresAt int64   `json:"refresh_expires_at,omitempty"`
+	MFARequired      bool    `json:"mfa_required"`
+	MFAToken         string  `json:"mfa_token,omitempty"`
+	User             *UserVO `json:"user,omitempty"`
+}
+
+// MFAEnrollmentResponse 双因素认证绑定响应VO
+type MFAEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse 恢复码响应VO
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TokenResponse 刷新令牌响应VO
+type TokenResponse struct {
+	Token            string `json:"token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
 }
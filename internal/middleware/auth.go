@@ -1,20 +1,55 @@
 package middleware
 
 import (
+	"errors"
+	"gin-starter/internal/application/services"
 	"gin-starter/internal/application/services/rbac"
+	"gin-starter/internal/domain/models"
+	"gin-starter/internal/infra/database"
 	"gin-starter/pkg/utils/jwt"
 	"gin-starter/pkg/utils/res"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware 认证中间件
+// AuthMiddleware 认证中间件，接受访问令牌和API密钥
+// 属于必须启用双因素认证角色的用户，令牌未通过双因素认证时会被拒绝
 func AuthMiddleware() gin.HandlerFunc {
+	return authenticate(true, true)
+}
+
+// UserAuthMiddleware 只接受用户访问令牌的认证中间件，用于会话、API密钥等账号自身的管理接口
+func UserAuthMiddleware() gin.HandlerFunc {
+	return authenticate(true, false)
+}
+
+// MFAEnrollmentAuthMiddleware 双因素认证绑定接口使用的认证中间件，不要求令牌已通过双因素认证
+func MFAEnrollmentAuthMiddleware() gin.HandlerFunc {
+	return authenticate(false, false)
+}
+
+// authenticate 解析并校验访问令牌或API密钥
+func authenticate(enforceMFA, allowAPIKey bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从请求头中获取Authorization字段
+		// API密钥可以通过 X-API-Key 或 Authorization: ApiKey ... 传递
 		authHeader := c.GetHeader("Authorization")
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" && strings.HasPrefix(authHeader, "ApiKey ") {
+			apiKey = strings.TrimPrefix(authHeader, "ApiKey ")
+		}
+		if apiKey != "" {
+			if !allowAPIKey {
+				res.ErrForbidden.ThrowWithMessage(c, "该接口不支持API密钥访问")
+				return
+			}
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
+		// 从请求头中获取Authorization字段
 		if authHeader == "" {
 			res.ErrTokenRequired.ThrowWithMessage(c, "未提供认证信息")
 			return
@@ -36,24 +71,167 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 校验令牌是否被吊销、用户是否已停用或删除
+		if err := services.Session.ValidateClaims(claims); err != nil {
+			throwAuthError(c, err)
+			return
+		}
+
+		// 引入租户之前签发的令牌不携带租户，属于默认租户
+		tenantID := claims.TenantID
+		if tenantID == 0 {
+			tenantID = models.DefaultTenantID
+		}
+
+		if enforceMFA && !claims.MFA {
+			// 无法确定角色时拒绝请求，不能跳过双因素认证
+			required, err := services.MFA.IsRequired(claims.UserID, rbac.GetTenantDomain(tenantID))
+			if err != nil {
+				res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
+				return
+			}
+			if required {
+				res.ErrMFARequired.ThrowWithMessage(c, "当前角色必须启用双因素认证")
+				return
+			}
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		setPrincipal(c, claims.UserID, rbac.GetUserID(claims.UserID), tenantID)
+		c.Set("claims", claims)
 
 		// 继续处理请求
 		c.Next()
 	}
 }
 
+// authenticateAPIKey 校验API密钥及其范围，Casbin主体为所属用户或服务账号
+func authenticateAPIKey(c *gin.Context, raw string) {
+	key, err := services.APIKey.Authenticate(raw)
+	if err != nil {
+		throwAuthError(c, err)
+		return
+	}
+	if !services.APIKey.Allows(key, c.Request.Method, c.Request.URL.Path) {
+		res.ErrForbidden.ThrowWithMessage(c, "API密钥无权访问该接口")
+		return
+	}
+	c.Set("user_id", key.UserID)
+	c.Set("username", key.User.Username)
+	setPrincipal(c, key.UserID, services.APIKey.Subject(key), key.User.TenantID)
+	c.Set("api_key", key)
+	c.Next()
+}
+
+// setPrincipal 记录请求的主体和所属租户：Casbin主体写入 subject，域写入 domain
+// 租户ID和操作者写入请求上下文，用于数据隔离和数据范围
+func setPrincipal(c *gin.Context, userID uint, sub string, tenantID uint) {
+	dom := rbac.GetTenantDomain(tenantID)
+	c.Set("subject", sub)
+	c.Set("tenant_id", tenantID)
+	c.Set("domain", dom)
+	ctx := database.WithTenant(c.Request.Context(), tenantID)
+	ctx = services.WithActor(ctx, services.Actor{UserID: userID, Subject: sub, Domain: dom})
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// throwAuthError 输出认证失败的业务异常
+func throwAuthError(c *gin.Context, err error) {
+	var businessErr *res.BusinessError
+	if errors.As(err, &businessErr) {
+		businessErr.ThrowWithMessage(c, businessErr.Message)
+		return
+	}
+	res.ErrInternalServer.ThrowWithMessage(c, "认证状态校验失败")
+}
+
+// AuthorizationMiddleware 基于策略的权限中间件
+// 使用请求路径和方法调用Casbin校验，策略对象支持 keyMatch2 模式（如 /users/:id、/users/*），操作支持正则（如 GET|POST）
+// 主体和域由认证中间件写入，主体通常为用户ID，服务账号API密钥为 apikey:<id>，域为用户所属租户
+func AuthorizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := c.GetString("subject")
+		if subject == "" {
+			res.ErrUnauthorized.ThrowWithMessage(c, "用户未认证")
+			return
+		}
+		allowed, err := enforce(c, subject, c.Request.URL.Path, c.Request.Method)
+		if err != nil {
+			res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
+			return
+		}
+		if !allowed {
+			res.ErrForbidden.ThrowWithMessage(c, "权限不足")
+			return
+		}
+		c.Next()
+	}
+}
+
+// PermissionMiddleware 校验固定的资源和操作，用于不按请求路径授权的专用权限
+func PermissionMiddleware(resource, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := c.GetString("subject")
+		if subject == "" {
+			res.ErrUnauthorized.ThrowWithMessage(c, "用户未认证")
+			return
+		}
+		allowed, err := enforce(c, subject, resource, action)
+		if err != nil {
+			res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
+			return
+		}
+		if !allowed {
+			res.ErrForbidden.ThrowWithMessage(c, "权限不足")
+			return
+		}
+		c.Next()
+	}
+}
+
+// enforce 按请求属性校验权限，条件策略可以引用以下属性：
+// sub.id、sub.subject、sub.tenant_id、sub.username；env.ip、env.method、env.path、env.hour、env.weekday（0为周日）、env.time（HH:MM）；
+// 以及注册的解析器提供的资源和主体属性
+func enforce(c *gin.Context, sub, obj, act string) (bool, error) {
+	dom := c.GetString("domain")
+	now := time.Now()
+	params := make(map[string]string, len(c.Params))
+	for _, param := range c.Params {
+		params[param.Key] = param.Value
+	}
+	attrs, err := rbac.ResolveAttributes(c.Request.Context(), sub, dom, obj, params, rbac.Attributes{
+		Sub: map[string]any{
+			"id":        c.GetUint("user_id"),
+			"subject":   sub,
+			"tenant_id": c.GetUint("tenant_id"),
+			"username":  c.GetString("username"),
+		},
+		Env: map[string]any{
+			"ip":      c.ClientIP(),
+			"method":  c.Request.Method,
+			"path":    c.Request.URL.Path,
+			"hour":    now.Hour(),
+			"weekday": int(now.Weekday()),
+			"time":    now.Format("15:04"),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return rbac.EnforceWithAttributes(sub, dom, obj, act, attrs)
+}
+
 // RoleMiddleware 验证用户身份中间件
-func RoleMiddleware(rbacService *rbac.RBACService, requiredRole string) gin.HandlerFunc {
+func RoleMiddleware(requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
+		subject := c.GetString("subject")
+		if subject == "" {
 			res.ErrUnauthorized.ThrowWithMessage(c, "用户未认证")
 			return
 		}
-		allowed, err := rbac.Enforce(rbac.GetUserID(userID.(uint)), "*", "*")
+		allowed, err := rbac.Enforce(subject, c.GetString("domain"), "*", "*")
 		if err != nil {
 			res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
 			return
@@ -62,7 +240,7 @@ func RoleMiddleware(rbacService *rbac.RBACService, requiredRole string) gin.Hand
 			c.Next()
 			return
 		}
-		roles, err := rbac.GetRolesForUser(rbac.GetUserID(userID.(uint)))
+		roles, err := rbac.GetRolesForUser(subject, c.GetString("domain"))
 		if err != nil {
 			res.ErrInternalServer.ThrowWithMessage(c, "角色获取失败")
 			return
@@ -75,15 +253,36 @@ func RoleMiddleware(rbacService *rbac.RBACService, requiredRole string) gin.Hand
 	}
 }
 
-// DepartmentMiddleware 验证用户部门中间件
-func DepartmentMiddleware(rbacService *rbac.RBACService, requiredDepartment string) gin.HandlerFunc {
+// SuperAdminMiddleware 只允许超级管理员访问，用于跨租户的平台管理接口
+func SuperAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := c.GetString("subject")
+		if subject == "" {
+			res.ErrUnauthorized.ThrowWithMessage(c, "用户未认证")
+			return
+		}
+		super, err := rbac.IsSuperAdmin(subject)
+		if err != nil {
+			res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
+			return
+		}
+		if !super {
+			res.ErrForbidden.ThrowWithMessage(c, "权限不足")
+			return
+		}
+		c.Next()
+	}
+}
+
+// DepartmentMiddleware 验证用户部门中间件，requiredDepartment 为部门名称
+func DepartmentMiddleware(requiredDepartment string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
+		subject := c.GetString("subject")
+		if subject == "" {
 			res.ErrUnauthorized.ThrowWithMessage(c, "用户未认证")
 			return
 		}
-		allowed, err := rbac.Enforce(rbac.GetUserID(userID.(uint)), "*", "*")
+		allowed, err := rbac.Enforce(subject, c.GetString("domain"), "*", "*")
 		if err != nil {
 			res.ErrInternalServer.ThrowWithMessage(c, "权限验证失败")
 			return
@@ -92,12 +291,15 @@ func DepartmentMiddleware(rbacService *rbac.RBACService, requiredDepartment stri
 			c.Next()
 			return
 		}
-		departments, err := rbac.GetDepartmentsForUser(rbac.GetUserID(userID.(uint)))
+		// 下级部门的成员同样属于上级部门
+		departments, err := rbac.GetImplicitDepartmentsForUser(subject)
 		if err != nil {
 			res.ErrInternalServer.ThrowWithMessage(c, "部门获取失败")
 			return
 		}
-		if !slices.Contains(departments, requiredDepartment) {
+		// 部门按名称配置，每次请求时解析为部门主体，部门不存在时拒绝访问
+		department, err := rbac.GetDepartmentSubjectByName(c.Request.Context(), requiredDepartment)
+		if err != nil || !slices.Contains(departments, department) {
 			res.ErrForbidden.ThrowWithMessage(c, "权限不足")
 			return
 		}
@@ -1,23 +1,31 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"gin-starter/config"
 	_ "gin-starter/docs"
+	"gin-starter/internal/application/services"
 	"gin-starter/internal/application/services/rbac"
 	"gin-starter/internal/infra/database"
+	"gin-starter/internal/infra/mail"
 	"gin-starter/internal/infra/ofs"
 	"gin-starter/internal/interfaces/routes"
 	"gin-starter/internal/interfaces/validators"
 	"gin-starter/internal/middleware"
 	"gin-starter/pkg/utils"
+	"gin-starter/pkg/utils/jwt"
 	"log"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// defaultPolicyFile 迁移时导入的默认策略文件
+const defaultPolicyFile = "policy.yaml"
+
 // @title gin-starter api docs
 // @version 1.0
 // @description gin-starter api docs
@@ -54,26 +62,98 @@ func main() {
 	database.InitDatabase()
 	// 初始化s3
 	ofs.InitOfs()
+	// 初始化邮件
+	mail.InitMail()
+	// 策略文件的导入导出，见 runPolicyCommand
+	if len(args) > 0 && args[0] == "policy" {
+		initRBAC()
+		if err := runPolicyCommand(args[1:]); err != nil {
+			utils.Log.Fatalf("策略文件命令执行失败: %v", err)
+		}
+		return
+	}
 	if runMigration {
 		utils.Log.Info("执行数据库迁移...")
 		database.AutoMigrate()
 
-		if err := rbac.InitRBAC(); err != nil {
-			utils.Log.Fatalf("RBAC服务初始化失败: %v", err)
+		if err := services.Tenant.EnsureDefaultTenant(); err != nil {
+			utils.Log.Fatalf("租户数据初始化失败: %v", err)
 		}
+		initRBAC()
 
-		rbac.AddPolicy("admin", "/users/*", "*")
-		rbac.AddPolicy("user", "/users/:id", "GET")
-		rbac.AddPolicy("super_admin", "*", "*")
-		rbac.AddRoleForUser("1", "admin")
+		// 超级管理员角色和策略在匹配器中直接引用，总是创建
+		if err := services.Role.EnsureRole(rbac.SuperAdminRole, "超级管理员"); err != nil {
+			utils.Log.Fatalf("角色数据初始化失败: %v", err)
+		}
+		if err := services.Role.ImportRolesFromPolicies(); err != nil {
+			utils.Log.Fatalf("角色数据初始化失败: %v", err)
+		}
+		if err := services.Department.MigrateSubjects(); err != nil {
+			utils.Log.Fatalf("部门主体迁移失败: %v", err)
+		}
+		if err := services.Department.SyncHierarchy(); err != nil {
+			utils.Log.Fatalf("部门层级同步失败: %v", err)
+		}
+		rbac.AddPolicy(rbac.SuperAdminRole, rbac.AllDomains, "*", "*")
+
+		// 其余初始角色、权限和授权在策略文件中声明，可通过 --policy=<文件> 指定
+		policyPath, specified := defaultPolicyFile, false
+		for _, arg := range args {
+			if path, ok := strings.CutPrefix(arg, "--policy="); ok {
+				policyPath, specified = path, true
+			}
+		}
+		if _, err := os.Stat(policyPath); err == nil || specified {
+			if _, err := importPolicyFile(policyPath, false, false); err != nil {
+				utils.Log.Fatalf("策略文件导入失败: %v", err)
+			}
+		} else {
+			utils.Log.Warnf("策略文件 %s 不存在，跳过导入", policyPath)
+		}
+		// 超级管理员只能由超级管理员授予，第一个超级管理员通过迁移参数 --super-admin=<用户ID> 指定
+		for _, arg := range args {
+			if userID, ok := strings.CutPrefix(arg, "--super-admin="); ok {
+				if _, err := rbac.AddRoleForUser(userID, rbac.SuperAdminRole, rbac.AllDomains); err != nil {
+					utils.Log.Fatalf("超级管理员初始化失败: %v", err)
+				}
+			}
+		}
 		rbac.SavePolicy()
 
 		utils.Log.Info("数据库迁移完成")
 		return
 	}
 
-	if err := rbac.InitRBAC(); err != nil {
-		utils.Log.Fatalf("RBAC服务初始化失败: %v", err)
+	// 只有服务进程监听其他实例的策略变更，迁移和策略命令只发送通知
+	if watcher := initRBAC(); watcher != nil {
+		watcher.Listen()
+		defer watcher.Close()
+	}
+	rbac.StartGrantSweeper(config.AppConfig.RBAC.GrantSweepInterval, func(err error) {
+		utils.Log.Errorf("过期分配清理失败: %v", err)
+	})
+	// 条件策略中可以引用的资源属性，如 obj.id == sub.id 表示只能访问自己
+	rbac.RegisterObjectResolver("/users/:id", services.User.ObjectAttributes)
+	rbac.RegisterObjectResolver("/users/:id/*", services.User.ObjectAttributes)
+
+	// 初始化JWT签名密钥
+	if err := jwt.Init(config.AppConfig.JWT, config.AppConfig.Server.Environment); err != nil {
+		utils.Log.Fatalf("JWT初始化失败: %v", err)
+	}
+	if keyManager := jwt.GetKeyManager(); keyManager != nil {
+		keyManager.StartRotation(func(err error) {
+			utils.Log.Errorf("JWT密钥轮换失败: %v", err)
+		})
+	}
+
+	// 初始化用户名密码认证后端
+	if err := services.InitAuthenticators(); err != nil {
+		utils.Log.Fatalf("认证后端初始化失败: %v", err)
+	}
+	if slices.Contains(config.AppConfig.Auth.Backends, "ldap") {
+		services.LDAP.StartSync(func(err error) {
+			utils.Log.Errorf("LDAP同步失败: %v", err)
+		})
 	}
 
 	r := gin.New()
@@ -85,7 +165,9 @@ func main() {
 	routerManager.RegisterRouter(routes.NewUserRouter())
 	routerManager.RegisterRouter(routes.NewRBACRouter())
 	routerManager.RegisterRouter(routes.NewDepartmentRouter())
+	routerManager.RegisterRouter(routes.NewTenantRouter())
 	routerManager.RegisterRouter(routes.NewProtectedRouter())
+	routerManager.RegisterRouter(routes.NewWellKnownRouter())
 	routerManager.SetupRoutes(r)
 
 	addr := fmt.Sprintf("%s:%s", config.AppConfig.Server.Host, config.AppConfig.Server.Port)
@@ -100,3 +182,86 @@ func main() {
 
 	utils.Log.Success("服务启动完成")
 }
+
+// initRBAC 初始化RBAC服务，启用策略同步时返回监听器
+func initRBAC() *rbac.PolicyWatcher {
+	if err := rbac.InitRBAC(); err != nil {
+		utils.Log.Fatalf("RBAC服务初始化失败: %v", err)
+	}
+	if !config.AppConfig.RBAC.Watcher {
+		return nil
+	}
+	watcher, err := rbac.EnableWatcher(config.AppConfig.RBAC.WatcherChannel, func(err error) {
+		utils.Log.Errorf("策略同步失败: %v", err)
+	})
+	if err != nil {
+		utils.Log.Fatalf("策略同步初始化失败: %v", err)
+	}
+	return watcher
+}
+
+// runPolicyCommand 执行策略文件命令
+//
+//	policy import <文件> [--prune] [--dry-run]
+//	policy export [--format=yaml|csv] [--output=<文件>]
+func runPolicyCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: policy import <文件> [--prune] [--dry-run] | policy export [--format=yaml|csv] [--output=<文件>]")
+	}
+	switch args[0] {
+	case "import":
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			return fmt.Errorf("缺少策略文件路径")
+		}
+		result, err := importPolicyFile(args[1], slices.Contains(args, "--prune"), slices.Contains(args, "--dry-run"))
+		if err != nil {
+			return err
+		}
+		output, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+	case "export":
+		format, output := services.PolicyFormatYAML, ""
+		for _, arg := range args[1:] {
+			if value, ok := strings.CutPrefix(arg, "--output="); ok {
+				output = value
+				format = services.PolicyFormat(value)
+			}
+		}
+		for _, arg := range args[1:] {
+			if value, ok := strings.CutPrefix(arg, "--format="); ok {
+				format = value
+			}
+		}
+		doc, err := services.PolicyFile.Export()
+		if err != nil {
+			return err
+		}
+		data, err := services.EncodePolicyDocument(doc, format)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(output, data, 0o644)
+	}
+	return fmt.Errorf("未知的策略文件命令: %s", args[0])
+}
+
+// importPolicyFile 按扩展名解析并导入策略文件
+func importPolicyFile(path string, prune, dryRun bool) (*services.PolicyImportResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := services.ParsePolicyDocument(data, services.PolicyFormat(path))
+	if err != nil {
+		return nil, err
+	}
+	return services.PolicyFile.Import(doc, prune, dryRun)
+}
@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 一次性操作令牌用途
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeEmailVerify   = "email_verify"
+	PurposeMFAChallenge  = "mfa_challenge"
+)
+
+// MaxActionTokenTTL 操作令牌和第三方登录状态令牌的最长有效期
+// 被替换的签名密钥至少保留到该时长之后才删除，超过该时长的令牌无法保证签名密钥仍在
+const MaxActionTokenTTL = 24 * time.Hour
+
+// ActionClaims 一次性操作令牌声明，如密码重置、邮箱验证
+// 令牌本身带签名和过期时间，是否已使用由服务端按 jti 记录
+type ActionClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	Email   string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenType 令牌类型，与访问令牌区分
+func (c *ActionClaims) TokenType() string {
+	return "action+jwt"
+}
+
+// GenerateActionToken 生成一次性操作令牌，返回令牌、jti 和过期时间
+func GenerateActionToken(userID uint, purpose, email string, ttl time.Duration) (string, string, time.Time, error) {
+	if ttl > MaxActionTokenTTL {
+		return "", "", time.Time{}, fmt.Errorf("操作令牌有效期不能超过 %s", MaxActionTokenTTL)
+	}
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	expirationTime := time.Now().Add(ttl)
+	claims := &ActionClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    Issuer,
+		},
+	}
+	tokenString, err := SignClaims(claims)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return tokenString, tokenID, expirationTime, nil
+}
+
+// ParseActionToken 解析一次性操作令牌并校验用途
+func ParseActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+	if err := ParseClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("令牌用途不匹配")
+	}
+	return claims, nil
+}
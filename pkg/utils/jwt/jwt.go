@@ -1,64 +1,192 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"gin-starter/config"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Claims 自定义声明结构体
+// RegisteredClaims.ID 即 jti，用于单个令牌的吊销；SessionID 关联服务端会话；MFA 表示已通过双因素认证
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	TenantID  uint   `json:"tid,omitempty"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	MFA       bool   `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT Token
-func GenerateToken(userID uint, username string) (string, error) {
+// Issuer 令牌签发者
+const Issuer = "gin-starter"
+
+var (
+	// algorithm 当前签名算法，未初始化时使用 HS256
+	algorithm = "HS256"
+	// keyManager 非对称算法的密钥管理器
+	keyManager *KeyManager
+)
+
+// Init 根据配置初始化签名算法与密钥
+// 生产环境使用 HMAC 算法时拒绝默认密钥
+func Init(cfg config.JWTConfig, environment string) error {
+	alg := cfg.Algorithm
+	if alg == "" {
+		alg = "HS256"
+	}
+	if jwt.GetSigningMethod(alg) == nil {
+		return fmt.Errorf("不支持的签名算法: %s", alg)
+	}
+
+	if isHMAC(alg) {
+		if cfg.Secret == "" {
+			return errors.New("未配置JWT密钥")
+		}
+		if cfg.Secret == config.DefaultJWTSecret && environment == "production" {
+			return errors.New("生产环境禁止使用默认JWT密钥，请配置 jwt.secret 或改用非对称算法")
+		}
+		algorithm = alg
+		keyManager = nil
+		return nil
+	}
+
+	// 同一组密钥还签发操作令牌和第三方登录状态令牌，旧密钥按其中最长的有效期保留
+	tokenTTL := max(config.GetJWTAccessTokenTTL(), MaxActionTokenTTL)
+	manager, err := NewKeyManager(alg, &FileKeyStore{Dir: cfg.KeyDir}, cfg.RotationInterval, tokenTTL)
+	if err != nil {
+		return fmt.Errorf("JWT密钥加载失败: %v", err)
+	}
+	algorithm = alg
+	keyManager = manager
+	return nil
+}
+
+// GetKeyManager 获取密钥管理器，HMAC 算法时为 nil
+func GetKeyManager() *KeyManager {
+	return keyManager
+}
+
+// GetJWKS 获取公钥集合，HMAC 算法不公开任何密钥
+func GetJWKS() (*JWKSet, error) {
+	if keyManager == nil {
+		return &JWKSet{Keys: []JWK{}}, nil
+	}
+	return keyManager.JWKS()
+}
+
+// typedClaims 声明自身令牌类型的声明，类型写入 typ 头，防止不同用途的令牌混用
+type typedClaims interface {
+	TokenType() string
+}
+
+// tokenType 获取声明对应的令牌类型，访问令牌为默认的 JWT
+func tokenType(claims jwt.Claims) string {
+	if typed, ok := claims.(typedClaims); ok {
+		return typed.TokenType()
+	}
+	return "JWT"
+}
+
+// SignClaims 使用当前密钥签名任意声明
+func SignClaims(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(algorithm), claims)
+	token.Header["typ"] = tokenType(claims)
+	if keyManager == nil {
+		return token.SignedString([]byte(config.GetJWTSecret()))
+	}
+	key := keyManager.Current()
+	if key == nil {
+		return "", errors.New("没有可用的签名密钥")
+	}
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.PrivateKey)
+}
+
+// ParseClaims 校验签名并解析声明，只接受当前配置的算法
+func ParseClaims(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != tokenType(claims) {
+			return nil, fmt.Errorf("令牌类型不匹配: %s", typ)
+		}
+		if keyManager == nil {
+			return []byte(config.GetJWTSecret()), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key := keyManager.Lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("未知的密钥: %s", kid)
+		}
+		return key.PublicKey(), nil
+	}, jwt.WithValidMethods([]string{algorithm}), jwt.WithIssuer(Issuer))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// GenerateToken 生成JWT Token，返回Token及其过期时间
+func GenerateToken(userID, tenantID uint, username, sessionID string, mfa bool) (string, time.Time, error) {
 	// 设置Token过期时间
-	expirationTime := time.Now().Add(24 * time.Hour) // Token 24小时后过期
+	expirationTime := time.Now().Add(config.GetJWTAccessTokenTTL())
+
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
 	// 创建声明
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		TenantID:  tenantID,
+		Username:  username,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "gin-starter",
+			Issuer:    Issuer,
 		},
 	}
 
-	// 创建Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
 	// 签名Token
-	tokenString, err := token.SignedString([]byte(config.GetJWTSecret()))
+	tokenString, err := SignClaims(claims)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
-	return tokenString, nil
+	return tokenString, expirationTime, nil
 }
 
 // ParseToken 解析JWT Token
 func ParseToken(tokenString string) (*Claims, error) {
-	// 解析Token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.GetJWTSecret()), nil
-	})
-
-	if err != nil {
+	claims := &Claims{}
+	if err := ParseClaims(tokenString, claims); err != nil {
 		return nil, err
 	}
+	return claims, nil
+}
 
-	// 验证Token
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
-	}
+// isHMAC 是否为对称签名算法
+func isHMAC(alg string) bool {
+	return strings.HasPrefix(alg, "HS")
+}
 
-	return nil, errors.New("invalid token")
+// newTokenID 生成令牌唯一标识(jti)
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
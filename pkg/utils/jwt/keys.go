@@ -0,0 +1,400 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SigningKey 非对称签名密钥
+type SigningKey struct {
+	KID        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+}
+
+// PublicKey 获取公钥
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+// KeyStore 密钥持久化接口
+// 多实例部署时应让所有实例共享同一存储（如共享卷），否则各实例签发的令牌互相无法校验
+type KeyStore interface {
+	Load() ([]*SigningKey, error)
+	Save(key *SigningKey) error
+	Delete(kid string) error
+}
+
+// FileKeyStore 基于目录的密钥存储，每个密钥保存为 <kid>.pem
+type FileKeyStore struct {
+	Dir string
+}
+
+// Load 读取目录中的全部密钥
+func (s *FileKeyStore) Load() ([]*SigningKey, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []*SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("密钥文件格式错误: %s", entry.Name())
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("密钥解析失败 %s: %v", entry.Name(), err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("不支持的密钥类型: %s", entry.Name())
+		}
+		createdAt, err := time.Parse(time.RFC3339, block.Headers["Created"])
+		if err != nil {
+			return nil, fmt.Errorf("密钥创建时间无效: %s", entry.Name())
+		}
+		keys = append(keys, &SigningKey{
+			KID:        strings.TrimSuffix(entry.Name(), ".pem"),
+			Algorithm:  block.Headers["Algorithm"],
+			PrivateKey: signer,
+			CreatedAt:  createdAt,
+		})
+	}
+	return keys, nil
+}
+
+// Save 保存密钥
+func (s *FileKeyStore) Save(key *SigningKey) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type: "PRIVATE KEY",
+		Headers: map[string]string{
+			"Algorithm": key.Algorithm,
+			// 保留纳秒，同一秒内生成的密钥仍能按创建顺序排列
+			"Created": key.CreatedAt.UTC().Format(time.RFC3339Nano),
+		},
+		Bytes: der,
+	})
+	return os.WriteFile(filepath.Join(s.Dir, key.KID+".pem"), data, 0600)
+}
+
+// Delete 删除密钥
+func (s *FileKeyStore) Delete(kid string) error {
+	err := os.Remove(filepath.Join(s.Dir, kid+".pem"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// JWKSMaxAge JWKS 响应允许被缓存的时长
+// 新密钥发布满一个缓存周期后才用于签名，保证离线校验方缓存的公钥集合中已包含该密钥
+const JWKSMaxAge = 5 * time.Minute
+
+// lookupReloadInterval 校验时遇到未知 kid 重新加载存储的最小间隔，防止伪造的 kid 频繁触发读盘
+const lookupReloadInterval = 10 * time.Second
+
+// KeyManager 管理签名密钥的生成、轮换与淘汰
+// 已发布满 JWKSMaxAge 的最新密钥用于签名；被替换的旧密钥在其签发的令牌全部过期前仍可用于校验
+type KeyManager struct {
+	mu           sync.RWMutex
+	algorithm    string
+	store        KeyStore
+	rotation     time.Duration
+	tokenTTL     time.Duration
+	publishDelay time.Duration
+	keys         []*SigningKey
+	lastReload   time.Time
+}
+
+// NewKeyManager 创建密钥管理器并加载已有密钥，没有可用密钥时自动生成
+// tokenTTL 为该密钥签发的各类令牌中最长的有效期，决定旧密钥的保留时长
+func NewKeyManager(algorithm string, store KeyStore, rotation, tokenTTL time.Duration) (*KeyManager, error) {
+	m := &KeyManager{
+		algorithm:    algorithm,
+		store:        store,
+		rotation:     rotation,
+		tokenTTL:     tokenTTL,
+		publishDelay: JWKSMaxAge,
+	}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	if m.Current() == nil {
+		if err := m.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Current 当前用于签名的密钥，即已发布满一个缓存周期的最新密钥
+// 所有密钥都尚在发布期内时（如首次启动）使用最早的密钥
+func (m *KeyManager) Current() *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 {
+		return nil
+	}
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if time.Since(m.keys[i].CreatedAt) >= m.publishDelay {
+			return m.keys[i]
+		}
+	}
+	return m.keys[0]
+}
+
+// latest 最新生成的密钥，可能仍在发布期内
+func (m *KeyManager) latest() *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return m.keys[len(m.keys)-1]
+}
+
+// Lookup 根据 kid 查找校验密钥
+// 找不到时重新加载存储，共享存储时其他实例刚生成的密钥也能校验；重新加载有最小间隔限制
+func (m *KeyManager) Lookup(kid string) *SigningKey {
+	if key := m.find(kid); key != nil {
+		return key
+	}
+	m.mu.Lock()
+	due := time.Since(m.lastReload) >= lookupReloadInterval
+	if due {
+		m.lastReload = time.Now()
+	}
+	m.mu.Unlock()
+	if !due || m.reload() != nil {
+		return nil
+	}
+	return m.find(kid)
+}
+
+// find 在已加载的密钥中查找 kid
+func (m *KeyManager) find(kid string) *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, key := range m.keys {
+		if key.KID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// Keys 获取所有仍然有效的密钥
+func (m *KeyManager) Keys() []*SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*SigningKey(nil), m.keys...)
+}
+
+// Rotate 生成新密钥并立即发布到 JWKS，发布满 JWKSMaxAge 后才用于签名
+func (m *KeyManager) Rotate() error {
+	key, err := generateSigningKey(m.algorithm)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Save(key); err != nil {
+		return err
+	}
+	return m.reload()
+}
+
+// RotateIfDue 当前密钥超过轮换周期时生成新密钥，并清理已无令牌依赖的旧密钥
+// 先从存储重新加载，共享存储时其他实例已轮换的密钥不会重复生成
+func (m *KeyManager) RotateIfDue() error {
+	if err := m.reload(); err != nil {
+		return err
+	}
+	// 以最新密钥计算，尚在发布期内的新密钥不会触发重复轮换
+	latest := m.latest()
+	if latest == nil || (m.rotation > 0 && time.Since(latest.CreatedAt) >= m.rotation) {
+		if err := m.Rotate(); err != nil {
+			return err
+		}
+	}
+	return m.prune()
+}
+
+// StartRotation 按轮换周期在后台检查密钥
+func (m *KeyManager) StartRotation(onError func(error)) {
+	if m.rotation <= 0 {
+		return
+	}
+	interval := min(m.rotation/10, time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := m.RotateIfDue(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// reload 从存储加载当前算法的密钥，按创建时间排序
+func (m *KeyManager) reload() error {
+	loaded, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	keys := make([]*SigningKey, 0, len(loaded))
+	for _, key := range loaded {
+		if key.Algorithm == m.algorithm {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	m.mu.Lock()
+	m.keys = keys
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// prune 删除被替换且其签发令牌已全部过期的密钥
+func (m *KeyManager) prune() error {
+	keys := m.Keys()
+	for i := 0; i < len(keys)-1; i++ {
+		// 旧密钥在下一个密钥发布期结束、开始签名时停止签名
+		retiredAt := keys[i+1].CreatedAt.Add(m.publishDelay)
+		if time.Since(retiredAt) > m.tokenTTL+time.Minute {
+			if err := m.store.Delete(keys[i].KID); err != nil {
+				return err
+			}
+		}
+	}
+	return m.reload()
+}
+
+// generateSigningKey 按算法生成新密钥
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &SigningKey{
+		KID:        now.UTC().Format("20060102150405") + "-" + hex.EncodeToString(suffix),
+		Algorithm:  algorithm,
+		PrivateKey: signer,
+		CreatedAt:  now,
+	}, nil
+}
+
+// JWK 单个公钥的 JSON Web Key 表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 导出所有有效公钥
+func (m *KeyManager) JWKS() (*JWKSet, error) {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range m.Keys() {
+		jwk, err := toJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// toJWK 将公钥转换为 JWK
+func toJWK(key *SigningKey) (JWK, error) {
+	jwk := JWK{Kid: key.KID, Use: "sig", Alg: key.Algorithm}
+	switch pub := key.PublicKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// 未压缩点格式: 0x04 || X || Y
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, errors.New("不支持的公钥类型")
+	}
+	return jwk, nil
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestKeyManager(t *testing.T) (*KeyManager, *FileKeyStore) {
+	t.Helper()
+	store := &FileKeyStore{Dir: t.TempDir()}
+	m, err := NewKeyManager("ES256", store, time.Hour, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	return m, store
+}
+
+func TestRotatedKeyPublishedBeforeSigning(t *testing.T) {
+	m, _ := newTestKeyManager(t)
+	first := m.Current()
+	if err := m.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if got := m.Current(); got.KID != first.KID {
+		t.Fatalf("new key used for signing before it was published: %s", got.KID)
+	}
+	jwks, err := m.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS: %v", err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+	}
+
+	m.publishDelay = 0
+	if got := m.Current(); got.KID == first.KID {
+		t.Fatal("published key not used for signing")
+	}
+}
+
+func TestLookupReloadsUnknownKID(t *testing.T) {
+	m, store := newTestKeyManager(t)
+	// 模拟共享存储中另一个实例生成的密钥
+	saveKey := func() string {
+		key, err := generateSigningKey("ES256")
+		if err != nil {
+			t.Fatalf("generateSigningKey: %v", err)
+		}
+		if err := store.Save(key); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		return key.KID
+	}
+
+	m.lastReload = time.Time{}
+	if m.Lookup(saveKey()) == nil {
+		t.Fatal("key generated by another instance not found after reload")
+	}
+	// 重新加载有最小间隔
+	if m.Lookup(saveKey()) != nil {
+		t.Fatal("store reloaded again within the rate limit")
+	}
+}
+
+func TestPruneKeepsKeysForLongestTokenTTL(t *testing.T) {
+	store := &FileKeyStore{Dir: t.TempDir()}
+	old, err := generateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("generateSigningKey: %v", err)
+	}
+	// 替换旧密钥的新密钥在一小时前已开始签名
+	old.CreatedAt = time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	replacement, err := generateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("generateSigningKey: %v", err)
+	}
+	replacement.CreatedAt = time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, key := range []*SigningKey{old, replacement} {
+		if err := store.Save(key); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// 访问令牌早已过期，但旧密钥签发的操作令牌仍可能有效
+	m, err := NewKeyManager("ES256", store, 0, max(15*time.Minute, MaxActionTokenTTL))
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if err := m.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if m.Lookup(old.KID) == nil {
+		t.Fatal("retired key pruned while action tokens it signed may still be valid")
+	}
+}
@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCStateClaims 第三方登录流程的状态声明
+// 令牌保存在 HttpOnly Cookie 中，PKCE verifier 不会出现在跳转地址里
+type OIDCStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// TokenType 令牌类型，与访问令牌区分
+func (c *OIDCStateClaims) TokenType() string {
+	return "oidc-state+jwt"
+}
+
+// GenerateOIDCState 生成第三方登录流程状态令牌
+func GenerateOIDCState(state, nonce, verifier string, ttl time.Duration) (string, error) {
+	if ttl > MaxActionTokenTTL {
+		return "", fmt.Errorf("状态令牌有效期不能超过 %s", MaxActionTokenTTL)
+	}
+	claims := &OIDCStateClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    Issuer,
+		},
+	}
+	return SignClaims(claims)
+}
+
+// ParseOIDCState 解析第三方登录流程状态令牌
+func ParseOIDCState(tokenString string) (*OIDCStateClaims, error) {
+	claims := &OIDCStateClaims{}
+	if err := ParseClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -95,6 +95,16 @@ var (
 	ErrInvalidToken       = NewBusinessError(400006, "无效的Token")
 	ErrTokenRequired      = NewBusinessError(400007, "未提供认证信息")
 	ErrTokenFormat        = NewBusinessError(400008, "认证信息格式错误")
+	ErrInvalidRefresh     = NewBusinessError(400011, "无效的刷新令牌")
+	ErrRefreshReused      = NewBusinessError(400012, "刷新令牌已被使用，相关会话已失效")
+	ErrTokenRevoked       = NewBusinessError(400013, "Token已失效")
+	ErrInvalidActionToken = NewBusinessError(400014, "链接无效或已过期")
+	ErrMFARequired        = NewBusinessError(400015, "需要完成双因素认证")
+	ErrInvalidMFACode     = NewBusinessError(400016, "验证码错误")
+	ErrAccountLocked      = NewBusinessError(400017, "账号已锁定，请稍后再试")
+	ErrTooManyAttempts    = NewBusinessError(400018, "登录尝试过于频繁，请稍后再试")
+	ErrInvalidAPIKey      = NewBusinessError(400019, "无效的API密钥")
+	ErrOIDCLogin          = NewBusinessError(400020, "第三方登录失败")
 
 	// 用户相关错误
 	ErrUserNotFound      = NewBusinessError(400101, "用户不存在")
@@ -102,7 +112,10 @@ var (
 	ErrInvalidPassword   = NewBusinessError(400103, "密码错误")
 	ErrEmailAlreadyUsed  = NewBusinessError(400104, "邮箱已被使用")
 	ErrUsernameTaken     = NewBusinessError(400105, "用户名已存在")
+	ErrUserInactive      = NewBusinessError(400106, "用户已停用")
 
 	// 权限相关错误
 	ErrInsufficientPermissions = NewBusinessError(400009, "权限不足")
+	ErrRoleNotFound            = NewBusinessError(400201, "角色不存在")
+	ErrRoleAlreadyExists       = NewBusinessError(400202, "角色已存在")
 )
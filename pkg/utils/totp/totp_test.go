@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录B中 SHA1 的密钥 "12345678901234567890" 的 Base32 编码
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors RFC 6238 附录B的 SHA1 测试向量，验证码取8位结果的后6位
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := GenerateCode(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("GenerateCode(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("GenerateCode(%d) = %s, want %s", v.unix, code, v.code)
+		}
+	}
+	// 密钥忽略大小写和首尾空白
+	if code, _ := GenerateCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", Step(time.Unix(59, 0))); code != "287082" {
+		t.Fatalf("GenerateCode with a lowercase secret = %s, want 287082", code)
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	cases := []struct {
+		name string
+		at   time.Time
+		code string
+		ok   bool
+	}{
+		{"current step", now, "050471", true},
+		{"previous step within skew", now.Add(Period * time.Second), "050471", true},
+		{"next step within skew", now.Add(-Period * time.Second), "050471", true},
+		{"outside skew", now.Add(2 * Period * time.Second), "050471", false},
+		{"wrong code", now, "123456", false},
+		{"wrong length", now, "50471", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, ok := Validate(rfcSecret, tc.code, tc.at, 1)
+			if ok != tc.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tc.ok)
+			}
+			if ok && matched != step {
+				t.Fatalf("matched step %d, want %d", matched, step)
+			}
+		})
+	}
+}